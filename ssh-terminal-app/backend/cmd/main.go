@@ -6,7 +6,12 @@ import (
 	"ssh-terminal-app/internal/crypto"
 	"ssh-terminal-app/internal/database"
 	"ssh-terminal-app/internal/handlers"
+	"ssh-terminal-app/internal/ldapauth"
+	"ssh-terminal-app/internal/mail"
 	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"ssh-terminal-app/internal/ratelimit"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -17,6 +22,9 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
 	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
 	if err := crypto.InitEncryption(); err != nil {
 		log.Fatalf("Failed to initialize encryption: %v", err)
 	}
@@ -24,10 +32,42 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer database.CloseDB()
+	if err := models.InitRepository(); err != nil {
+		log.Fatalf("Failed to initialize repository: %v", err)
+	}
+
+	if err := models.CloseStaleSSHSessions(); err != nil {
+		log.Printf("Failed to close stale SSH sessions: %v", err)
+	}
+	if err := models.InitSettings(); err != nil {
+		log.Fatalf("Failed to initialize settings: %v", err)
+	}
+	if err := models.InitAdmins(); err != nil {
+		log.Fatalf("Failed to initialize admins: %v", err)
+	}
 
 	middleware.InitJWT()
+	if err := ratelimit.Init(); err != nil {
+		log.Fatalf("Failed to configure rate limits: %v", err)
+	}
 
-	handlers.InitGoogleOAuth()
+	handlers.InitOIDC()
+	if err := mail.InitMail(); err != nil {
+		log.Fatalf("Failed to configure mail: %v", err)
+	}
+	if err := ldapauth.InitLDAP(); err != nil {
+		log.Fatalf("Failed to configure LDAP: %v", err)
+	}
+	handlers.InitWebAuthn()
+	if err := handlers.InitSSHPool(); err != nil {
+		log.Fatalf("Failed to configure SSH client pool: %v", err)
+	}
+	if err := handlers.InitSSHKeepalive(); err != nil {
+		log.Fatalf("Failed to configure SSH keepalives: %v", err)
+	}
+	if err := handlers.InitTerminalLimits(); err != nil {
+		log.Fatalf("Failed to configure terminal limits: %v", err)
+	}
 
 	ginMode := os.Getenv("GIN_MODE")
 	if ginMode == "" {
@@ -36,13 +76,24 @@ func main() {
 	gin.SetMode(ginMode)
 
 	r := gin.Default()
+	// Per-IP rate limits depend on the client address, so forwarded headers
+	// are only honoured from proxies on private networks unless configured.
+	trustedProxies := []string{"127.0.0.1", "::1", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+	if v := os.Getenv("TRUSTED_PROXIES"); v == "none" {
+		trustedProxies = nil
+	} else if v != "" {
+		trustedProxies = strings.Split(v, ",")
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	frontendURL := os.Getenv("FRONTEND_URL")
 	if frontendURL == "" {
 		frontendURL = "http://localhost:5173"
 	}
 
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{frontendURL, "http://localhost:5173", "http://localhost:8080"},
+		AllowOrigins:     handlers.AllowedOrigins(),
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
@@ -53,31 +104,122 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	authLimit := middleware.RateLimit("auth", ratelimit.AuthIP, middleware.ByIP)
+	connectLimit := middleware.RateLimit("connect", ratelimit.ConnectUser, middleware.ByUser)
+	connectIPLimit := middleware.RateLimit("connect-ip", ratelimit.ConnectIP, middleware.ByIP)
+
 	api := r.Group("/api")
 	{
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", handlers.Register)
-			auth.POST("/login", handlers.Login)
+			auth.POST("/register", middleware.RateLimit("register", ratelimit.RegisterIP, middleware.ByIP), handlers.Register)
+			auth.POST("/login", middleware.RateLimit("login", ratelimit.LoginIP, middleware.ByIP), handlers.Login)
 			auth.GET("/google", handlers.GoogleLogin)
 			auth.GET("/google/callback", handlers.GoogleCallback)
+			auth.GET("/oidc/providers", handlers.GetOIDCProviders)
+			auth.GET("/oidc/:provider/login", handlers.OIDCLogin)
+			auth.GET("/oidc/:provider/callback", handlers.OIDCCallback)
+			auth.POST("/exchange", authLimit, handlers.ExchangeAuthCode)
+			auth.POST("/verify-email", authLimit, handlers.VerifyEmail)
+			auth.POST("/verify-email/resend", authLimit, handlers.ResendVerificationEmail)
+			auth.POST("/forgot-password", authLimit, handlers.ForgotPassword)
+			auth.POST("/reset-password", authLimit, handlers.ResetPassword)
+			auth.POST("/change-password", middleware.AuthMiddleware(), authLimit, handlers.ChangePassword)
+			auth.GET("/identities", middleware.AuthMiddleware(), handlers.GetUserIdentities)
+			auth.POST("/refresh", handlers.Refresh)
 			auth.POST("/logout", handlers.Logout)
 			auth.GET("/me", middleware.AuthMiddleware(), handlers.GetMe)
+			auth.GET("/sessions", middleware.AuthMiddleware(), handlers.GetAuthSessions)
+			auth.DELETE("/sessions/:id", middleware.AuthMiddleware(), handlers.RevokeAuthSession)
+			auth.POST("/sessions/revoke-others", middleware.AuthMiddleware(), handlers.RevokeOtherAuthSessions)
+
+			mfa := auth.Group("/mfa")
+			{
+				mfa.POST("/verify", authLimit, handlers.VerifyMFA)
+				mfa.POST("/enroll", authLimit, handlers.BeginMFAEnrollment)
+				mfa.POST("/enroll/confirm", authLimit, handlers.ConfirmMFAEnrollment)
+				mfa.GET("", middleware.AuthMiddleware(), handlers.GetMFAStatus)
+				mfa.POST("/totp/setup", middleware.AuthMiddleware(), handlers.SetupTOTP)
+				mfa.POST("/totp/confirm", middleware.AuthMiddleware(), handlers.ConfirmTOTP)
+				mfa.POST("/totp/disable", authLimit, middleware.AuthMiddleware(), handlers.DisableTOTP)
+				mfa.POST("/recovery-codes", authLimit, middleware.AuthMiddleware(), handlers.RegenerateRecoveryCodes)
+			}
+
+			webauthn := auth.Group("/webauthn")
+			{
+				webauthn.POST("/login/begin", authLimit, handlers.BeginWebAuthnLogin)
+				webauthn.POST("/login/finish", handlers.FinishWebAuthnLogin)
+				webauthn.POST("/mfa/begin", authLimit, handlers.BeginWebAuthnMFA)
+				webauthn.POST("/mfa/finish", handlers.FinishWebAuthnMFA)
+				webauthn.POST("/register/begin", middleware.AuthMiddleware(), handlers.BeginWebAuthnRegistration)
+				webauthn.POST("/register/finish", middleware.AuthMiddleware(), handlers.FinishWebAuthnRegistration)
+				webauthn.GET("/credentials", middleware.AuthMiddleware(), handlers.GetWebAuthnCredentials)
+				webauthn.PUT("/credentials/:id", middleware.AuthMiddleware(), handlers.RenameWebAuthnCredential)
+				webauthn.DELETE("/credentials/:id", middleware.AuthMiddleware(), handlers.DeleteWebAuthnCredential)
+			}
 		}
 
+		read := middleware.AuthMiddleware(models.ScopeConnectionsRead)
+		write := middleware.AuthMiddleware(models.ScopeConnectionsWrite)
+
 		ssh := api.Group("/ssh")
-		ssh.Use(middleware.AuthMiddleware())
 		{
-			ssh.GET("/connections", handlers.GetConnections)
-			ssh.GET("/connections/:id", handlers.GetConnection)
-			ssh.POST("/connections", handlers.CreateConnection)
-			ssh.PUT("/connections/:id", handlers.UpdateConnection)
-			ssh.DELETE("/connections/:id", handlers.DeleteConnection)
-			ssh.POST("/connections/:id/test", handlers.TestConnection)
+			ssh.GET("/connections", read, handlers.GetConnections)
+			ssh.GET("/connections/:id", read, handlers.GetConnection)
+			ssh.POST("/connections", write, handlers.CreateConnection)
+			ssh.PUT("/connections/:id", write, handlers.UpdateConnection)
+			ssh.DELETE("/connections/:id", write, handlers.DeleteConnection)
+			ssh.POST("/connections/:id/test", connectIPLimit, read, connectLimit, handlers.TestConnection)
+			ssh.POST("/connections/:id/exec", connectIPLimit, middleware.AuthMiddleware(models.ScopeExec), connectLimit, handlers.ExecCommand)
+			ssh.GET("/connections/:id/stats", read, handlers.GetConnectionStats)
+			ssh.PUT("/connections/:id/favorite", write, handlers.AddFavorite)
+			ssh.DELETE("/connections/:id/favorite", write, handlers.RemoveFavorite)
+
+			ssh.GET("/recents", read, handlers.GetRecentConnections)
+
+			ssh.GET("/templates", read, handlers.GetTemplates)
+			ssh.GET("/templates/:id", read, handlers.GetTemplate)
+			ssh.POST("/templates", write, handlers.CreateTemplate)
+			ssh.PUT("/templates/:id", write, handlers.UpdateTemplate)
+			ssh.DELETE("/templates/:id", write, handlers.DeleteTemplate)
+
+			ssh.GET("/tags", read, handlers.GetTags)
+
+			ssh.GET("/folders", read, handlers.GetFolders)
+			ssh.POST("/folders", write, handlers.CreateFolder)
+			ssh.PUT("/folders/:id", write, handlers.UpdateFolder)
+			ssh.DELETE("/folders/:id", write, handlers.DeleteFolder)
+		}
+
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), middleware.RequireAdmin())
+		{
+			admin.GET("/users", handlers.AdminListUsers)
+			admin.GET("/users/:id", handlers.AdminGetUser)
+			admin.POST("/users/:id/disable", handlers.AdminDisableUser)
+			admin.POST("/users/:id/enable", handlers.AdminEnableUser)
+			admin.POST("/users/:id/logout", handlers.AdminLogoutUser)
+			admin.POST("/users/:id/reset-mfa", handlers.AdminResetMFA)
+			admin.PUT("/users/:id/role", handlers.AdminSetUserRole)
+			admin.DELETE("/users/:id", handlers.AdminDeleteUser)
+
+			admin.GET("/terminals", handlers.AdminGetTerminals)
+			admin.GET("/session-policy", handlers.AdminGetSessionPolicy)
+			admin.PUT("/session-policy", handlers.AdminSetSessionPolicy)
+			admin.PUT("/teams/:id/session-policy", handlers.AdminSetTeamSessionPolicy)
+		}
+
+		tokens := api.Group("/tokens")
+		tokens.Use(middleware.AuthMiddleware())
+		{
+			tokens.GET("", handlers.GetAPITokens)
+			tokens.POST("", handlers.CreateAPIToken)
+			tokens.DELETE("/:id", handlers.DeleteAPIToken)
 		}
 	}
 
-	r.GET("/ws/ssh/:id", handlers.HandleWebSocketTerminal)
+	r.GET("/ws/ssh/:id", connectIPLimit, middleware.AuthMiddleware(models.ScopeTerminal), connectLimit, handlers.HandleWebSocketTerminal)
+	r.GET("/ws/mux", connectIPLimit, middleware.AuthMiddleware(models.ScopeTerminal), handlers.HandleWebSocketMux)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -87,6 +229,7 @@ func main() {
 	log.Printf("Server starting on port %s", port)
 	log.Printf("Frontend URL: %s", frontendURL)
 	log.Printf("Google OAuth configured: %v", os.Getenv("GOOGLE_CLIENT_ID") != "")
+	log.Printf("OIDC providers configured: %v", handlers.OIDCProviderNames())
 
 	if err := r.Run(":" + port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"ssh-terminal-app/internal/database"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  status      list migrations and whether they are applied
+  up [n]      apply the next n pending migrations (default: all)
+  down [n]    roll back the last n applied migrations (default: 1)`
+
+// runMigrate implements the "migrate" subcommand and returns the exit code.
+func runMigrate(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	steps := 0
+	if args[0] == "down" {
+		steps = 1
+	}
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid step count %q\n", args[1])
+			return 2
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "status", "up", "down":
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err := database.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer database.CloseDB()
+
+	switch args[0] {
+	case "status":
+		states, err := database.MigrationStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migration status: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range states {
+			appliedAt := "-"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, s.Status, appliedAt)
+		}
+		w.Flush()
+
+	case "up":
+		applied, err := database.MigrateUp(steps)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		rolledBack, err := database.MigrateDown(steps)
+		for _, m := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Rollback failed: %v\n", err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("no applied migrations")
+		}
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	// Appendix B lists 8-digit codes; a 6-digit code is their last six digits.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(rfc6238Secret, TOTPCounter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := TOTPCounter(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"one step behind", -1, true},
+		{"one step ahead", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := TOTPCode(rfc6238Secret, current+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counter, ok := ValidateTOTP(rfc6238Secret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("ValidateTOTP ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && counter != current+tt.offset {
+				t.Errorf("ValidateTOTP counter = %d, want %d", counter, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		code string
+		ok   bool
+	}{
+		{"050471", true},
+		{" 050 471 ", true},
+		{"50471", false},
+		{"0050471", false},
+		{"050472", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(rfc6238Secret, tt.code, now); ok != tt.ok {
+			t.Errorf("ValidateTOTP(%q) ok = %v, want %v", tt.code, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+)
+
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+var DB *sql.DB
+
+// Driver is the backend DB talks to. Queries in this codebase use ?
+// placeholders on both; the PostgreSQL connection rewrites them.
+var Driver = DriverSQLite
+
+// Open connects to the database selected by DATABASE_DRIVER without touching
+// its schema.
+func Open() error {
+	Driver = os.Getenv("DATABASE_DRIVER")
+	if Driver == "" {
+		Driver = DriverSQLite
+	}
+
+	var err error
+	switch Driver {
+	case DriverSQLite:
+		DB, err = openSQLite()
+	case DriverPostgres:
+		DB, err = openPostgres()
+	default:
+		return fmt.Errorf("unknown DATABASE_DRIVER %q", Driver)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = DB.Ping(); err != nil {
+		return err
+	}
+
+	log.Printf("Database connected successfully (%s)", Driver)
+	return nil
+}
+
+// InitDB opens the database and applies pending migrations. With
+// DB_AUTO_MIGRATE=false it refuses to start on an outdated schema instead,
+// leaving migrations to the "migrate" command.
+func InitDB() error {
+	if err := Open(); err != nil {
+		return err
+	}
+
+	if os.Getenv("DB_AUTO_MIGRATE") == "false" {
+		states, err := MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			switch s.Status {
+			case "pending":
+				return fmt.Errorf("%w: run \"server migrate up\"", ErrPendingMigrations)
+			case "modified":
+				return fmt.Errorf("%w: %d_%s", ErrMigrationModified, s.Version, s.Name)
+			case "missing":
+				return fmt.Errorf("%w: %d_%s", ErrUnknownMigration, s.Version, s.Name)
+			}
+		}
+		return nil
+	}
+
+	if _, err := MigrateUp(0); err != nil {
+		return err
+	}
+	log.Println("Database migrations completed")
+	return nil
+}
+
+func CloseDB() {
+	if DB != nil {
+		DB.Close()
+	}
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// legacyColumns were added with ALTER TABLE before versioned migrations, so
+// databases from that time may lack any of them.
+var legacyColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"ssh_connections", "folder_id", "INTEGER"},
+	{"ssh_connections", "last_used_at", "DATETIME"},
+	{"ssh_connections", "template_id", "INTEGER"},
+	{"ssh_connections", "overrides", "TEXT"},
+	{"ssh_connections", "jump_connection_id", "INTEGER"},
+	{"ssh_connections", "term_type", "TEXT"},
+	{"ssh_connections", "variables", "TEXT"},
+	{"ssh_sessions", "status", "TEXT NOT NULL DEFAULT 'active'"},
+	{"ssh_sessions", "error_message", "TEXT"},
+	{"users", "totp_secret_encrypted", "TEXT"},
+	{"users", "totp_enabled_at", "DATETIME"},
+	{"users", "totp_last_counter", "INTEGER"},
+	{"users", "webauthn_user_handle", "TEXT"},
+	{"users", "email_verified_at", "DATETIME"},
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+	{"users", "disabled_at", "DATETIME"},
+}
+
+// adoptLegacySchema brings a SQLite database created before schema_migrations
+// existed up to the baseline migration and records it as applied, so the
+// numbered migrations can take over from there.
+func adoptLegacySchema(baseline Migration) error {
+	err := inMigrationTx(func(tx *sql.Tx) error {
+		// Accounts that predate email verification keep working as verified
+		hadEmailVerification, err := columnExists(tx, "users", "email_verified_at")
+		if err != nil {
+			return err
+		}
+
+		for _, col := range legacyColumns {
+			if err := addColumnIfMissing(tx, col.table, col.column, col.definition); err != nil {
+				log.Printf("Migration error: %v\nColumn: %s.%s", err, col.table, col.column)
+				return err
+			}
+		}
+
+		// Creates the tables and indexes the database does not have yet
+		if _, err := tx.Exec(baseline.Up); err != nil {
+			return err
+		}
+
+		if !hadEmailVerification {
+			if _, err := tx.Exec(`UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL`); err != nil {
+				return err
+			}
+		}
+
+		if err := migrateGoogleIdentities(tx); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)`,
+			baseline.Version, baseline.Name, baseline.Checksum,
+		)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Adopted existing database schema as migration %d_%s", baseline.Version, baseline.Name)
+	return nil
+}
+
+// migrateGoogleIdentities moves the legacy users.google_id links into
+// user_identities and drops the google_id and auth_provider columns.
+func migrateGoogleIdentities(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "users", "google_id")
+	if err != nil || !exists {
+		return err
+	}
+
+	statements := []string{
+		`INSERT OR IGNORE INTO user_identities (user_id, provider, subject, email, created_at)
+		SELECT id, 'google', google_id, email, created_at FROM users WHERE google_id IS NOT NULL AND google_id != ''`,
+		`DROP INDEX IF EXISTS idx_users_google_id`,
+		`ALTER TABLE users DROP COLUMN google_id`,
+		`ALTER TABLE users DROP COLUMN auth_provider`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	log.Println("Migrated Google accounts to user_identities")
+	return nil
+}
+
+func tableExists(table string) (bool, error) {
+	var n int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	return n > 0, err
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// addColumnIfMissing adds the column to an existing table. Missing tables are
+// left to the baseline migration, which creates them complete.
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	var tables int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		return nil
+	}
+
+	exists, err := columnExists(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
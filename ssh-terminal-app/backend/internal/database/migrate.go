@@ -0,0 +1,392 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var (
+	ErrMigrationModified = errors.New("applied migration has been modified")
+	ErrUnknownMigration  = errors.New("database has a migration this build does not know about")
+	ErrPendingMigrations = errors.New("database has pending migrations")
+)
+
+// Migration is one numbered schema change. Up and Down are run in a single
+// transaction each.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationState describes a migration as seen by the database.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Status is "applied", "pending", "modified" (the file changed after it
+	// was applied) or "missing" (applied but not part of this build).
+	Status string
+}
+
+type appliedMigration struct {
+	version   int
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Migrations returns the embedded migrations of the current driver ordered by
+// version. Each driver keeps its own copy under migrations/<driver>.
+func Migrations() ([]Migration, error) {
+	dir := path.Join("migrations", Driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func ensureMigrationsTable() error {
+	timestamp := "DATETIME"
+	if Driver == DriverPostgres {
+		timestamp = "TIMESTAMPTZ"
+	}
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at ` + timestamp + ` DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+func appliedMigrations() (map[int]appliedMigration, error) {
+	rows, err := DB.Query(`SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[a.version] = a
+	}
+	return applied, rows.Err()
+}
+
+// loadMigrationState reads the embedded migrations and what the database has
+// applied, adopting a database created before versioned migrations.
+func loadMigrationState() ([]Migration, map[int]appliedMigration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ensureMigrationsTable(); err != nil {
+		return nil, nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(applied) == 0 && Driver == DriverSQLite {
+		legacy, err := tableExists("users")
+		if err != nil {
+			return nil, nil, err
+		}
+		if legacy {
+			if err := adoptLegacySchema(migrations[0]); err != nil {
+				return nil, nil, fmt.Errorf("adopt existing schema: %w", err)
+			}
+			if applied, err = appliedMigrations(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return migrations, applied, nil
+}
+
+// MigrationStatus lists every known or applied migration in version order.
+func MigrationStatus() ([]MigrationState, error) {
+	migrations, applied, err := loadMigrationState()
+	if err != nil {
+		return nil, err
+	}
+
+	states := []MigrationState{}
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+		state := MigrationState{Version: m.Version, Name: m.Name, Status: "pending"}
+		if a, ok := applied[m.Version]; ok {
+			state.AppliedAt = &a.appliedAt
+			state.Status = "applied"
+			if a.checksum != m.Checksum {
+				state.Status = "modified"
+			}
+		}
+		states = append(states, state)
+	}
+	for _, a := range applied {
+		if !known[a.version] {
+			appliedAt := a.appliedAt
+			states = append(states, MigrationState{Version: a.version, Name: a.name, AppliedAt: &appliedAt, Status: "missing"})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// verifyApplied refuses to touch a database whose history no longer matches
+// the embedded migrations.
+func verifyApplied(migrations []Migration, applied map[int]appliedMigration) error {
+	known := map[int]Migration{}
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	for version, a := range applied {
+		m, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: %d_%s", ErrUnknownMigration, version, a.name)
+		}
+		if a.checksum != m.Checksum {
+			return fmt.Errorf("%w: %d_%s", ErrMigrationModified, version, m.Name)
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies up to steps pending migrations, or all of them when steps
+// is 0. It returns the migrations that were applied.
+func MigrateUp(steps int) ([]Migration, error) {
+	unlock, err := lockMigrations()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	migrations, applied, err := loadMigrationState()
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyApplied(migrations, applied); err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		err := inMigrationTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(
+				`INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)`,
+				m.Version, m.Name, m.Checksum,
+			)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %d_%s", m.Version, m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the last steps applied migrations, newest first.
+func MigrateDown(steps int) ([]Migration, error) {
+	unlock, err := lockMigrations()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	migrations, applied, err := loadMigrationState()
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyApplied(migrations, applied); err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return done, fmt.Errorf("migration %d_%s cannot be rolled back", m.Version, m.Name)
+		}
+		err := inMigrationTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback %d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Rolled back migration %d_%s", m.Version, m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// migrationLockID is the PostgreSQL advisory lock held while migrating.
+const migrationLockID = 7_243_001
+
+// lockMigrations keeps replicas starting at the same time from applying the
+// same migration twice. SQLite needs nothing extra: the database file is
+// locked by each migration's transaction.
+func lockMigrations() (func(), error) {
+	if Driver != DriverPostgres {
+		return func() {}, nil
+	}
+
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock(?)`, migrationLockID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(ctx, `SELECT pg_advisory_unlock(?)`, migrationLockID)
+		conn.Close()
+	}, nil
+}
+
+// inMigrationTx runs fn in a transaction. On SQLite foreign key enforcement
+// is off meanwhile, so a migration can rebuild a table the way SQLite
+// requires for most ALTERs; integrity is checked before committing instead.
+func inMigrationTx(fn func(tx *sql.Tx) error) error {
+	if Driver == DriverPostgres {
+		tx, err := DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The pragma is a no-op inside a transaction, so it is set on the
+	// connection first and restored before the connection goes back to the pool.
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return err
+	}
+	violation := rows.Next()
+	var table, parent string
+	var rowID sql.NullInt64
+	var fkID int
+	if violation {
+		err = rows.Scan(&table, &rowID, &parent, &fkID)
+	}
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	if violation {
+		return fmt.Errorf("foreign key violation: %s row %d references missing %s", table, rowID.Int64, parent)
+	}
+
+	return tx.Commit()
+}
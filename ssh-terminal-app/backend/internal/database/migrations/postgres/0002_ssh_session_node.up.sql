@@ -0,0 +1,3 @@
+-- Terminal sessions record the replica running them, so a restarting node
+-- only closes the sessions it left behind.
+ALTER TABLE ssh_sessions ADD COLUMN node TEXT;
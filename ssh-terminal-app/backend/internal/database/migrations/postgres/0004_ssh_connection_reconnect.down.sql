@@ -0,0 +1,3 @@
+ALTER TABLE ssh_connections DROP COLUMN session_name;
+ALTER TABLE ssh_connections DROP COLUMN session_manager;
+ALTER TABLE ssh_connections DROP COLUMN auto_reconnect;
@@ -0,0 +1,8 @@
+-- PTY and shell settings of a connection. Modes and environment variables
+-- are stored as JSON objects.
+ALTER TABLE ssh_connections ADD COLUMN initial_cols INTEGER;
+ALTER TABLE ssh_connections ADD COLUMN initial_rows INTEGER;
+ALTER TABLE ssh_connections ADD COLUMN terminal_modes TEXT;
+ALTER TABLE ssh_connections ADD COLUMN environment TEXT;
+ALTER TABLE ssh_connections ADD COLUMN startup_command TEXT;
+ALTER TABLE ssh_connections ADD COLUMN working_directory TEXT;
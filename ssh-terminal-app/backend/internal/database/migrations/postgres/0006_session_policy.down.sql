@@ -0,0 +1,4 @@
+ALTER TABLE ssh_connections DROP COLUMN max_session_duration;
+ALTER TABLE ssh_connections DROP COLUMN idle_timeout;
+ALTER TABLE teams DROP COLUMN max_session_duration;
+ALTER TABLE teams DROP COLUMN idle_timeout;
@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS app_settings;
+DROP TABLE IF EXISTS rate_limits;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS auth_exchange_codes;
+DROP TABLE IF EXISTS user_tokens;
+DROP TABLE IF EXISTS user_teams;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS webauthn_ceremonies;
+DROP TABLE IF EXISTS webauthn_credentials;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS auth_sessions;
+DROP TABLE IF EXISTS ssh_templates;
+DROP TABLE IF EXISTS ssh_favorites;
+DROP TABLE IF EXISTS ssh_connection_tags;
+DROP TABLE IF EXISTS ssh_folders;
+DROP TABLE IF EXISTS ssh_sessions;
+DROP TABLE IF EXISTS ssh_connections;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS users;
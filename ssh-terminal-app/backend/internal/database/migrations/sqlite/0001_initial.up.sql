@@ -0,0 +1,263 @@
+-- Baseline schema. Databases created before versioned migrations are
+-- brought to this state by adoptLegacySchema and then stamped as version 1.
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT UNIQUE NOT NULL,
+    password_hash TEXT,
+    name TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    totp_secret_encrypted TEXT,
+    totp_enabled_at DATETIME,
+    totp_last_counter INTEGER,
+    webauthn_user_handle TEXT,
+    email_verified_at DATETIME,
+    role TEXT NOT NULL DEFAULT 'user',
+    disabled_at DATETIME
+);
+
+-- External identities (OIDC subjects) linked to users
+CREATE TABLE IF NOT EXISTS user_identities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_login_at DATETIME,
+    UNIQUE(provider, subject),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- SSH Connections table
+CREATE TABLE IF NOT EXISTS ssh_connections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    host TEXT NOT NULL,
+    port INTEGER NOT NULL DEFAULT 22,
+    username TEXT NOT NULL,
+    auth_type TEXT NOT NULL DEFAULT 'password',
+    password_encrypted TEXT,
+    private_key_encrypted TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    folder_id INTEGER,
+    last_used_at DATETIME,
+    template_id INTEGER,
+    overrides TEXT,
+    jump_connection_id INTEGER,
+    term_type TEXT,
+    variables TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Sessions table
+CREATE TABLE IF NOT EXISTS ssh_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    connection_id INTEGER NOT NULL,
+    started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    ended_at DATETIME,
+    status TEXT NOT NULL DEFAULT 'active',
+    error_message TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (connection_id) REFERENCES ssh_connections(id) ON DELETE CASCADE
+);
+
+-- Connection folders
+CREATE TABLE IF NOT EXISTS ssh_folders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    parent_id INTEGER,
+    name TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES ssh_folders(id) ON DELETE CASCADE
+);
+
+-- Connection tags
+CREATE TABLE IF NOT EXISTS ssh_connection_tags (
+    connection_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (connection_id, tag),
+    FOREIGN KEY (connection_id) REFERENCES ssh_connections(id) ON DELETE CASCADE
+);
+
+-- Per-user favorite connections
+CREATE TABLE IF NOT EXISTS ssh_favorites (
+    user_id INTEGER NOT NULL,
+    connection_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, connection_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (connection_id) REFERENCES ssh_connections(id) ON DELETE CASCADE
+);
+
+-- Connection templates
+CREATE TABLE IF NOT EXISTS ssh_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    port INTEGER,
+    username TEXT,
+    auth_type TEXT,
+    password_encrypted TEXT,
+    private_key_encrypted TEXT,
+    jump_connection_id INTEGER,
+    term_type TEXT,
+    variables TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Login sessions, one per device
+CREATE TABLE IF NOT EXISTS auth_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    user_agent TEXT,
+    ip_address TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME,
+    revoke_reason TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Rotating refresh tokens; the session is the token family
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    FOREIGN KEY (session_id) REFERENCES auth_sessions(id) ON DELETE CASCADE
+);
+
+-- Single-use MFA recovery codes
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    used_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- WebAuthn authenticators (passkeys and security keys)
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    credential_id TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    credential TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- In-flight WebAuthn ceremonies, consumed by their finish step
+CREATE TABLE IF NOT EXISTS webauthn_ceremonies (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER,
+    purpose TEXT NOT NULL,
+    session_data TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Teams, currently populated from directory group membership
+CREATE TABLE IF NOT EXISTS teams (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_teams (
+    user_id INTEGER NOT NULL,
+    team_id INTEGER NOT NULL,
+    source TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, team_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE
+);
+
+-- Single-use email verification and password reset tokens
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    purpose TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- One-time codes handing an identity provider login over to the frontend
+CREATE TABLE IF NOT EXISTS auth_exchange_codes (
+    code_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Personal access tokens for the REST API
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    prefix TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    last_used_at DATETIME,
+    last_used_ip TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Rate limit buckets and login lockouts when RATE_LIMIT_STORE=sqlite
+CREATE TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    tokens REAL NOT NULL DEFAULT 0,
+    count INTEGER NOT NULL DEFAULT 0,
+    until DATETIME,
+    updated_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+-- Instance-wide settings managed at runtime
+CREATE TABLE IF NOT EXISTS app_settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_ssh_connections_user_id ON ssh_connections(user_id);
+CREATE INDEX IF NOT EXISTS idx_ssh_sessions_user_id ON ssh_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_user_id ON auth_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ssh_folders_name ON ssh_folders(user_id, COALESCE(parent_id, 0), name);
+CREATE INDEX IF NOT EXISTS idx_ssh_connection_tags_tag ON ssh_connection_tags(tag);
+
+CREATE INDEX IF NOT EXISTS idx_ssh_connections_folder_id ON ssh_connections(folder_id);
+CREATE INDEX IF NOT EXISTS idx_ssh_sessions_connection_id ON ssh_sessions(connection_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_ssh_connections_template_id ON ssh_connections(template_id);
+CREATE INDEX IF NOT EXISTS idx_ssh_templates_user_id ON ssh_templates(user_id);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_teams_team_id ON user_teams(team_id);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id, purpose);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_webauthn_user_handle ON users(webauthn_user_handle);
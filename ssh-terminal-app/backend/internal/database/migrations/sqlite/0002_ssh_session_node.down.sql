@@ -0,0 +1 @@
+ALTER TABLE ssh_sessions DROP COLUMN node;
@@ -0,0 +1,2 @@
+ALTER TABLE ssh_connections DROP COLUMN keepalive_max_missed;
+ALTER TABLE ssh_connections DROP COLUMN keepalive_interval;
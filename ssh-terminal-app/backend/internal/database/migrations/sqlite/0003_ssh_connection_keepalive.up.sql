@@ -0,0 +1,3 @@
+-- Per-connection keepalive settings; NULL uses the server default.
+ALTER TABLE ssh_connections ADD COLUMN keepalive_interval INTEGER;
+ALTER TABLE ssh_connections ADD COLUMN keepalive_max_missed INTEGER;
@@ -0,0 +1,5 @@
+-- Connections can re-dial a dropped SSH connection and run the shell in a
+-- named tmux or screen session, so a reconnect picks up where it left off.
+ALTER TABLE ssh_connections ADD COLUMN auto_reconnect BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE ssh_connections ADD COLUMN session_manager TEXT;
+ALTER TABLE ssh_connections ADD COLUMN session_name TEXT;
@@ -0,0 +1,6 @@
+ALTER TABLE ssh_connections DROP COLUMN working_directory;
+ALTER TABLE ssh_connections DROP COLUMN startup_command;
+ALTER TABLE ssh_connections DROP COLUMN environment;
+ALTER TABLE ssh_connections DROP COLUMN terminal_modes;
+ALTER TABLE ssh_connections DROP COLUMN initial_rows;
+ALTER TABLE ssh_connections DROP COLUMN initial_cols;
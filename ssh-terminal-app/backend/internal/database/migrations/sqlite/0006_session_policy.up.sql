@@ -0,0 +1,6 @@
+-- Idle timeout and maximum session duration in seconds. The strictest of the
+-- global, team and connection limits applies; NULL sets no limit.
+ALTER TABLE teams ADD COLUMN idle_timeout INTEGER;
+ALTER TABLE teams ADD COLUMN max_session_duration INTEGER;
+ALTER TABLE ssh_connections ADD COLUMN idle_timeout INTEGER;
+ALTER TABLE ssh_connections ADD COLUMN max_session_duration INTEGER;
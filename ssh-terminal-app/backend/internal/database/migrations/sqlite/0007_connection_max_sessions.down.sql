@@ -0,0 +1 @@
+ALTER TABLE ssh_connections DROP COLUMN max_sessions;
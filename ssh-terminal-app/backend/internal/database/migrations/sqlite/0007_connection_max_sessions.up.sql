@@ -0,0 +1,2 @@
+-- Cap on the open terminals of a connection; NULL uses the server default.
+ALTER TABLE ssh_connections ADD COLUMN max_sessions INTEGER;
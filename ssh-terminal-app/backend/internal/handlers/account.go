@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"ssh-terminal-app/internal/mail"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TokenInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// EmailInput names an account by its email address.
+type EmailInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+func sendVerificationEmail(user *models.User) error {
+	token, err := models.CreateUserToken(user.ID, models.UserTokenVerifyEmail, user.Email, models.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := frontendURL() + "/verify-email?token=" + url.QueryEscape(token)
+	return mail.Send(mail.Message{
+		To:      user.Email,
+		Subject: "E-posta adresinizi doğrulayın",
+		Body: fmt.Sprintf(
+			"Merhaba %s,\n\nSSH Terminal hesabınızı etkinleştirmek için e-posta adresinizi doğrulayın:\n\n%s\n\nBu bağlantı %d saat geçerlidir. Bu hesabı siz oluşturmadıysanız bu e-postayı yok sayabilirsiniz.\n",
+			user.Name, link, int(models.EmailVerificationTTL.Hours()),
+		),
+	})
+}
+
+func sendPasswordResetEmail(user *models.User) error {
+	token, err := models.CreateUserToken(user.ID, models.UserTokenResetPassword, user.Email, models.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := frontendURL() + "/reset-password?token=" + url.QueryEscape(token)
+	return mail.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Şifre sıfırlama",
+		Body: fmt.Sprintf(
+			"Merhaba %s,\n\nŞifrenizi sıfırlamak için aşağıdaki bağlantıyı kullanın:\n\n%s\n\nBu bağlantı %d dakika geçerlidir ve yalnızca bir kez kullanılabilir. Bu isteği siz yapmadıysanız bu e-postayı yok sayabilirsiniz.\n",
+			user.Name, link, int(models.PasswordResetTTL.Minutes()),
+		),
+	})
+}
+
+// requireVerifiedEmail blocks password logins of unverified accounts while
+// email verification is enforced.
+func requireVerifiedEmail(c *gin.Context, user *models.User) bool {
+	if user.IsEmailVerified() {
+		return true
+	}
+
+	required, err := models.IsEmailVerificationRequired()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account settings"})
+		return false
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                       "Please verify your email address before logging in",
+			"email_verification_required": true,
+		})
+		return false
+	}
+	return true
+}
+
+func VerifyEmail(c *gin.Context) {
+	var input TokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := models.ConsumeUserToken(input.Token, models.UserTokenVerifyEmail)
+	if errors.Is(err, models.ErrInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	if err := models.MarkEmailVerified(token.UserID, token.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerificationEmail mails a new verification link to an unverified
+// local account. Unverified accounts cannot log in while verification is
+// required, so it takes the email address rather than a session, and answers
+// like ForgotPassword whether or not there is such an account.
+func ResendVerificationEmail(c *gin.Context) {
+	var input EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := models.GetUserByEmail(strings.TrimSpace(input.Email))
+	if err == nil && user.PasswordHash != "" && !user.IsEmailVerified() {
+		if err := sendVerificationEmail(user); err != nil {
+			log.Printf("Verification email error: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an unverified account exists for this email, a verification link has been sent"})
+}
+
+// ForgotPassword mails a reset link to local accounts. It answers the same
+// way whether or not the address exists, so it cannot be used to probe for
+// accounts.
+func ForgotPassword(c *gin.Context) {
+	var input EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := models.GetUserByEmail(strings.TrimSpace(input.Email))
+	if err == nil && user.PasswordHash != "" {
+		if err := sendPasswordResetEmail(user); err != nil {
+			log.Printf("Password reset email error: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for this email, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password with a reset token and signs the user out
+// everywhere.
+func ResetPassword(c *gin.Context) {
+	var input ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Reject weak passwords before the token is spent.
+	if err := models.ValidatePassword(input.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := models.ConsumeUserToken(input.Token, models.UserTokenResetPassword)
+	if errors.Is(err, models.ErrInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := models.SetUserPassword(token.UserID, input.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	// The link reached the mailbox, which proves the address as well.
+	if err := models.MarkEmailVerified(token.UserID, token.Email); err != nil {
+		log.Printf("Mark email verified error: %v", err)
+	}
+	if err := models.RevokeAllAuthSessions(token.UserID, 0, "password_reset"); err != nil {
+		log.Printf("Revoke sessions after password reset error: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// ChangePassword replaces the password of the logged-in user and revokes
+// their other sessions.
+func ChangePassword(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+
+	var input ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.PasswordHash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This account signs in with an identity provider"})
+		return
+	}
+	if !user.CheckPassword(input.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	err := models.SetUserPassword(user.ID, input.NewPassword)
+	if errors.Is(err, models.ErrInvalidInput) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	if err := models.RevokeAllAuthSessions(user.ID, middleware.GetCurrentSessionID(c), "password_changed"); err != nil {
+		log.Printf("Revoke sessions after password change error: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type adminUserResponse struct {
+	models.AdminUser
+	LiveTerminals int `json:"live_terminals"`
+}
+
+type UserRoleInput struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// TeamSessionPolicyInput sets a team's session limits in seconds; null
+// leaves the limit to the global policy.
+type TeamSessionPolicyInput struct {
+	IdleTimeout        *int `json:"idle_timeout"`
+	MaxSessionDuration *int `json:"max_session_duration"`
+}
+
+// adminTargetUser reads the :id parameter. Admins cannot lock themselves out
+// through these endpoints, so acting on yourself is refused when notSelf is set.
+func adminTargetUser(c *gin.Context, notSelf bool) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	if notSelf && id == middleware.GetCurrentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot do this to your own account"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondAdminError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, models.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "At least one active admin must remain"})
+	case errors.Is(err, models.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Admin %s error: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// signOutMessages tells the user why their terminals were closed, by the
+// reason their sessions were revoked for.
+var signOutMessages = map[string]string{
+	"disabled":     "Account disabled by an administrator",
+	"admin_logout": "Signed out by an administrator",
+}
+
+// signOutUser revokes every session of the user and closes their open
+// terminals. It returns how many terminals were closed.
+func signOutUser(userID int64, reason string) (int, error) {
+	if err := models.RevokeAllAuthSessions(userID, 0, reason); err != nil {
+		return 0, err
+	}
+	evictUserSSHClients(userID)
+
+	message, ok := signOutMessages[reason]
+	if !ok {
+		message = "Session terminated by an administrator"
+	}
+	return terminateUserTerminals(userID, message), nil
+}
+
+// AdminListUsers lists users. Supported query parameters: q (email or name),
+// role (user|admin), status (active|disabled), cursor and limit.
+func AdminListUsers(c *gin.Context) {
+	filter := models.UserFilter{
+		Search: c.Query("q"),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+		Cursor: c.Query("cursor"),
+	}
+
+	switch filter.Role {
+	case "", models.RoleUser, models.RoleAdmin:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role. Must be 'user' or 'admin'"})
+		return
+	}
+	switch filter.Status {
+	case "", "active", "disabled":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status. Must be 'active' or 'disabled'"})
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		filter.Limit = n
+	}
+
+	page, err := models.ListUsers(filter)
+	if err == models.ErrInvalidCursor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	users := make([]adminUserResponse, len(page.Users))
+	for i, u := range page.Users {
+		users[i] = adminUserResponse{AdminUser: u, LiveTerminals: countUserTerminals(u.ID)}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":       users,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+func AdminGetUser(c *gin.Context) {
+	id, ok := adminTargetUser(c, false)
+	if !ok {
+		return
+	}
+
+	user, err := models.GetUserByID(id)
+	if err != nil {
+		respondAdminError(c, err, "fetch user")
+		return
+	}
+	teams, err := models.GetUserTeams(id)
+	if err != nil {
+		respondAdminError(c, err, "fetch user")
+		return
+	}
+	identities, err := models.GetUserIdentities(id)
+	if err != nil {
+		respondAdminError(c, err, "fetch user")
+		return
+	}
+	sessions, err := models.GetActiveAuthSessions(id)
+	if err != nil {
+		respondAdminError(c, err, "fetch user")
+		return
+	}
+	mfa, err := models.GetMFAStatus(id)
+	if err != nil {
+		respondAdminError(c, err, "fetch user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":       user,
+		"teams":      teams,
+		"identities": identities,
+		"sessions":   sessions,
+		"mfa":        mfa,
+		"terminals":  userTerminals(id),
+	})
+}
+
+// AdminDisableUser blocks the account and ends its sessions and terminals.
+func AdminDisableUser(c *gin.Context) {
+	id, ok := adminTargetUser(c, true)
+	if !ok {
+		return
+	}
+
+	user, err := models.SetUserDisabled(id, true)
+	if err != nil {
+		respondAdminError(c, err, "disable user")
+		return
+	}
+
+	closed, err := signOutUser(id, "disabled")
+	if err != nil {
+		respondAdminError(c, err, "sign out user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "terminals_closed": closed})
+}
+
+func AdminEnableUser(c *gin.Context) {
+	id, ok := adminTargetUser(c, false)
+	if !ok {
+		return
+	}
+
+	user, err := models.SetUserDisabled(id, false)
+	if err != nil {
+		respondAdminError(c, err, "enable user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// AdminLogoutUser signs the user out everywhere without disabling them.
+func AdminLogoutUser(c *gin.Context) {
+	id, ok := adminTargetUser(c, false)
+	if !ok {
+		return
+	}
+	if _, err := models.GetUserByID(id); err != nil {
+		respondAdminError(c, err, "sign out user")
+		return
+	}
+
+	closed, err := signOutUser(id, "admin_logout")
+	if err != nil {
+		respondAdminError(c, err, "sign out user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User signed out", "terminals_closed": closed})
+}
+
+// AdminResetMFA removes the user's second factors, e.g. after a lost phone.
+// Their sessions are ended so the next login goes through enrollment again
+// where MFA is required.
+func AdminResetMFA(c *gin.Context) {
+	id, ok := adminTargetUser(c, false)
+	if !ok {
+		return
+	}
+
+	if err := models.ResetUserMFA(id); err != nil {
+		respondAdminError(c, err, "reset two-factor authentication")
+		return
+	}
+	if err := models.RevokeAllAuthSessions(id, middleware.GetCurrentSessionID(c), "mfa_reset"); err != nil {
+		log.Printf("Revoke sessions after MFA reset error: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+func AdminSetUserRole(c *gin.Context) {
+	id, ok := adminTargetUser(c, true)
+	if !ok {
+		return
+	}
+
+	var input UserRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := models.SetUserRole(id, input.Role)
+	if err != nil {
+		respondAdminError(c, err, "change role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func AdminDeleteUser(c *gin.Context) {
+	id, ok := adminTargetUser(c, true)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteUser(id); err != nil {
+		respondAdminError(c, err, "delete user")
+		return
+	}
+	evictUserSSHClients(id)
+	terminateUserTerminals(id, "Account deleted by an administrator")
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// AdminGetTerminals returns the terminal limits and who holds the open
+// terminals, per connection.
+func AdminGetTerminals(c *gin.Context) {
+	holders := terminalHolders()
+	for i := range holders {
+		if user, err := models.GetUserByID(holders[i].UserID); err == nil {
+			holders[i].Email = user.Email
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"limits": gin.H{
+			"per_user":       maxTerminalsPerUser,
+			"per_connection": maxTerminalsPerConnection,
+		},
+		"users": holders,
+	})
+}
+
+// AdminGetSessionPolicy returns the global session policy and the limits of
+// every team. A user's sessions get the strictest of those that apply.
+func AdminGetSessionPolicy(c *gin.Context) {
+	policy, err := models.GetGlobalSessionPolicy()
+	if err != nil {
+		respondAdminError(c, err, "load session policy")
+		return
+	}
+	teams, err := models.GetTeamSessionPolicies()
+	if err != nil {
+		respondAdminError(c, err, "load session policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "teams": teams})
+}
+
+func AdminSetSessionPolicy(c *gin.Context) {
+	var input models.SessionPolicy
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SetGlobalSessionPolicy(input); err != nil {
+		respondAdminError(c, err, "update session policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": input})
+}
+
+func AdminSetTeamSessionPolicy(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	var input TeamSessionPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = models.SetTeamSessionPolicy(id, input.IdleTimeout, input.MaxSessionDuration)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+	if err != nil {
+		respondAdminError(c, err, "update team session policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team session policy updated"})
+}
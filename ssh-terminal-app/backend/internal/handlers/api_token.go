@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAPITokens(c *gin.Context) {
+	tokens, err := models.GetAPITokens(middleware.GetCurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens, "scopes": models.APITokenScopes})
+}
+
+// CreateAPIToken issues a personal access token. The secret is only part of
+// this response.
+func CreateAPIToken(c *gin.Context) {
+	var input models.APITokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, secret, err := models.CreateAPIToken(middleware.GetCurrentUserID(c), input)
+	if errors.Is(err, models.ErrInvalidInput) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token, "secret": secret})
+}
+
+func DeleteAPIToken(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := models.DeleteAPIToken(id, middleware.GetCurrentUserID(c)); err != nil {
+		if errors.Is(err, models.ErrAPITokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API token revoked"})
+}
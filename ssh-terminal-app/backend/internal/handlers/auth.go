@@ -1,40 +1,60 @@
 package handlers
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"os"
+	"ssh-terminal-app/internal/ldapauth"
 	"ssh-terminal-app/internal/middleware"
 	"ssh-terminal-app/internal/models"
+	"ssh-terminal-app/internal/ratelimit"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
-var googleOAuthConfig *oauth2.Config
+// startSession opens an auth session for the user and sets the access and
+// refresh token cookies.
+func startSession(c *gin.Context, user *models.User) (gin.H, error) {
+	if user.IsDisabled() {
+		return nil, models.ErrUserDisabled
+	}
+	session, refreshToken, err := models.CreateAuthSession(user.ID, c.Request.UserAgent(), c.ClientIP(), middleware.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return issueTokens(c, user, session, refreshToken)
+}
 
-func InitGoogleOAuth() {
-	googleOAuthConfig = &oauth2.Config{
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
+func issueTokens(c *gin.Context, user *models.User, session *models.AuthSession, refreshToken string) (gin.H, error) {
+	token, err := middleware.GenerateToken(user, session.ID)
+	if err != nil {
+		return nil, err
 	}
+
+	c.SetCookie("token", token, int(middleware.AccessTokenTTL.Seconds()), "/", "", false, true)
+	c.SetCookie("refresh_token", refreshToken, int(middleware.RefreshTokenTTL.Seconds()), "/api/auth", "", false, true)
+
+	return gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(middleware.AccessTokenTTL.Seconds()),
+	}, nil
 }
 
-type GoogleUserInfo struct {
-	ID            string `json:"id"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"verified_email"`
-	Name          string `json:"name"`
-	Picture       string `json:"picture"`
+// respondSessionError answers a login that could not be completed.
+func respondSessionError(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrUserDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account has been disabled"})
+		return
+	}
+	log.Printf("Login error: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+}
+
+func clearAuthCookies(c *gin.Context) {
+	c.SetCookie("token", "", -1, "/", "", false, true)
+	c.SetCookie("refresh_token", "", -1, "/api/auth", "", false, true)
 }
 
 func Register(c *gin.Context) {
@@ -50,19 +70,45 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	token, err := middleware.GenerateToken(user)
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Verification email error: %v", err)
+	}
+
+	required, err := models.IsEmailVerificationRequired()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account settings"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusCreated, gin.H{
+			"message":                     "User registered successfully. Please check your email to verify your address.",
+			"email_verification_required": true,
+			"user":                        user,
+		})
+		return
+	}
+
+	// When MFA is mandatory, a new account has to enroll before it gets a session.
+	challenge, err := mfaChallenge(user)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+	if challenge != nil {
+		challenge["message"] = "User registered successfully"
+		c.JSON(http.StatusCreated, challenge)
 		return
 	}
 
-	c.SetCookie("token", token, 60*60*24*7, "/", "", false, true)
+	response, err := startSession(c, user)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
-		"user":    user,
-		"token":   token,
-	})
+	response["message"] = "User registered successfully"
+	response["user"] = user
+	c.JSON(http.StatusCreated, response)
 }
 
 func Login(c *gin.Context) {
@@ -72,109 +118,211 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	user, err := models.GetUserByEmail(input.Email)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	account := loginAccountKey(input.Email)
+	if !allowLoginAttempt(c, account) {
 		return
 	}
 
-	if user.AuthProvider == "google" && user.PasswordHash == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Please login with Google"})
+	user, err := models.GetUserByEmail(input.Email)
+	if err != nil || user.PasswordHash == "" || !user.CheckPassword(input.Password) {
+		if ldapauth.Enabled() {
+			user, err = loginWithLDAP(input.Email, input.Password)
+			if err != nil {
+				if errors.Is(err, ldapauth.ErrInvalidCredentials) {
+					recordLoginFailure(c, account)
+				}
+				respondLDAPError(c, err)
+				return
+			}
+		} else if user != nil && user.PasswordHash == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Please login with your identity provider"})
+			return
+		} else {
+			recordLoginFailure(c, account)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
+	} else if !requireVerifiedEmail(c, user) {
 		return
 	}
+	ratelimit.RecordSuccess(account)
 
-	if !user.CheckPassword(input.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	challenge, err := mfaChallenge(user)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
 		return
 	}
 
-	token, err := middleware.GenerateToken(user)
+	response, err := startSession(c, user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		respondSessionError(c, err)
 		return
 	}
 
-	c.SetCookie("token", token, 60*60*24*7, "/", "", false, true)
+	response["message"] = "Login successful"
+	response["user"] = user
+	c.JSON(http.StatusOK, response)
+}
+
+func GetMe(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"user":    user,
-		"token":   token,
-	})
+	teams, err := models.GetUserTeams(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch teams"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user, "teams": teams})
 }
 
-func GoogleLogin(c *gin.Context) {
-	state := "random-state-token"
-	url := googleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
-	c.Redirect(http.StatusTemporaryRedirect, url)
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
-func GoogleCallback(c *gin.Context) {
-	frontendURL := os.Getenv("FRONTEND_URL")
-	if frontendURL == "" {
-		frontendURL = "http://localhost:5173"
+// Refresh exchanges a refresh token for a new access/refresh token pair.
+// Each refresh token can be used once; replaying one revokes its session.
+func Refresh(c *gin.Context) {
+	var input RefreshInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
-
-	code := c.Query("code")
-	if code == "" {
-		c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/login?error=missing_code")
+	if input.RefreshToken == "" {
+		input.RefreshToken, _ = c.Cookie("refresh_token")
+	}
+	if input.RefreshToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token required"})
 		return
 	}
 
-	token, err := googleOAuthConfig.Exchange(context.Background(), code)
+	session, refreshToken, err := models.RotateRefreshToken(input.RefreshToken, middleware.RefreshTokenTTL)
+	if errors.Is(err, models.ErrRefreshTokenReused) {
+		log.Printf("Refresh token reuse detected, session revoked")
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidRefreshToken) || errors.Is(err, models.ErrAuthSessionNotFound) {
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
 	if err != nil {
-		log.Printf("Token exchange error: %v", err)
-		c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/login?error=exchange_failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
 		return
 	}
 
-	client := googleOAuthConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+	user, err := models.GetUserByID(session.UserID)
 	if err != nil {
-		log.Printf("Userinfo error: %v", err)
-		c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/login?error=userinfo_failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if user.IsDisabled() {
+		clearAuthCookies(c)
+		respondSessionError(c, models.ErrUserDisabled)
 		return
 	}
-	defer resp.Body.Close()
 
-	var googleUser GoogleUserInfo
-	if err := json.NewDecoder(resp.Body).Decode(&googleUser); err != nil {
-		log.Printf("Decode error: %v", err)
-		c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/login?error=decode_failed")
+	response, err := issueTokens(c, user, session, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revokes the current session. It works with either a valid access
+// token or the refresh token cookie, so an expired access token can still
+// log out.
+func Logout(c *gin.Context) {
+	var sessionID int64
+	if tokenString, err := middleware.TokenFromRequest(c); err == nil {
+		if claims, err := middleware.ParseToken(tokenString); err == nil {
+			sessionID = claims.SessionID
+		}
+	}
+	if sessionID == 0 {
+		if refreshToken, err := c.Cookie("refresh_token"); err == nil && refreshToken != "" {
+			if session, err := models.FindAuthSessionByRefreshToken(refreshToken); err == nil {
+				sessionID = session.ID
+			}
+		}
+	}
+	if sessionID != 0 {
+		if err := models.RevokeAuthSessionByID(sessionID, "logout"); err != nil {
+			log.Printf("Failed to revoke session %d: %v", sessionID, err)
+		}
+	}
 
-	log.Printf("Google user: %+v", googleUser)
+	clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
 
-	user, err := models.CreateGoogleUser(googleUser.Email, googleUser.Name, googleUser.ID)
+type authSessionResponse struct {
+	models.AuthSession
+	Current bool `json:"current"`
+}
+
+func GetAuthSessions(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	currentID := middleware.GetCurrentSessionID(c)
+
+	sessions, err := models.GetActiveAuthSessions(userID)
 	if err != nil {
-		log.Printf("CreateGoogleUser error: %v", err)
-		c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/login?error=create_user_failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
 		return
 	}
 
-	jwtToken, err := middleware.GenerateToken(user)
+	response := make([]authSessionResponse, len(sessions))
+	for i, s := range sessions {
+		response[i] = authSessionResponse{AuthSession: s, Current: s.ID == currentID}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+func RevokeAuthSession(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		log.Printf("Token generation error: %v", err)
-		c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/login?error=token_failed")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := models.RevokeAuthSession(id, userID, "revoked"); err != nil {
+		if errors.Is(err, models.ErrAuthSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
 		return
 	}
 
-	c.SetCookie("token", jwtToken, 60*60*24*7, "/", "", false, true)
+	if id == middleware.GetCurrentSessionID(c) {
+		clearAuthCookies(c)
+	}
 
-	c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/auth/callback?token="+jwtToken)
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
 }
 
-func GetMe(c *gin.Context) {
-	user := middleware.GetCurrentUser(c)
-	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+func RevokeOtherAuthSessions(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	if err := models.RevokeAllAuthSessions(userID, middleware.GetCurrentSessionID(c), "revoked"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"user": user})
-}
 
-func Logout(c *gin.Context) {
-	c.SetCookie("token", "", -1, "/", "", false, true)
-	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked"})
 }
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"ssh-terminal-app/internal/ratelimit"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultExecTimeout = 30 * time.Second
+	maxExecTimeout     = 10 * time.Minute
+	maxExecOutput      = 1 << 20
+)
+
+type ExecInput struct {
+	Command string `json:"command" binding:"required"`
+	// Timeout in seconds; defaults to 30 and is capped at 600.
+	Timeout int `json:"timeout"`
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// ExecCommand runs a single non-interactive command on a connection and
+// returns its output and exit status.
+func ExecCommand(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	connID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection ID"})
+		return
+	}
+
+	var input ExecInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(input.Command) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Command is required"})
+		return
+	}
+	timeout := defaultExecTimeout
+	if input.Timeout > 0 {
+		timeout = min(time.Duration(input.Timeout)*time.Second, maxExecTimeout)
+	}
+
+	connection, err := models.GetSSHConnectionByID(connID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+		return
+	}
+
+	sshSession, err := models.StartSSHSession(userID, connection.ID)
+	if err != nil {
+		log.Printf("Failed to record SSH session: %v", err)
+	}
+	connected := false
+	var sessionErr string
+	defer func() {
+		if sshSession == nil {
+			return
+		}
+		if err := models.EndSSHSession(sshSession.ID, connected, sessionErr); err != nil {
+			log.Printf("Failed to finish SSH session: %v", err)
+		}
+	}()
+
+	client, release, err := acquireSSHClient(connection)
+	if errors.Is(err, ratelimit.ErrTooManyDials) {
+		sessionErr = err.Error()
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		sessionErr = fmt.Sprintf("SSH connection failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to connect: " + err.Error()})
+		return
+	}
+	defer release()
+	connected = true
+
+	if err := models.TouchSSHConnection(connection.ID, userID); err != nil {
+		log.Printf("Failed to record connection usage: %v", err)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		sessionErr = fmt.Sprintf("Failed to create session: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": sessionErr})
+		return
+	}
+	defer session.Close()
+
+	stdout := &limitedBuffer{max: maxExecOutput}
+	stderr := &limitedBuffer{max: maxExecOutput}
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	started := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- session.Run(input.Command) }()
+
+	var runErr error
+	timedOut := false
+	select {
+	case runErr = <-done:
+	case <-time.After(timeout):
+		timedOut = true
+		// The client may be shared, so only this session is torn down;
+		// closing it unblocks Run.
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		runErr = <-done
+	case <-c.Request.Context().Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		sessionErr = "Client went away"
+		return
+	}
+
+	exitCode := 0
+	var exitErr *ssh.ExitError
+	switch {
+	case timedOut:
+		exitCode = -1
+		sessionErr = fmt.Sprintf("Command timed out after %s", timeout)
+	case errors.As(runErr, &exitErr):
+		exitCode = exitErr.ExitStatus()
+	case runErr != nil:
+		sessionErr = fmt.Sprintf("Command failed: %v", runErr)
+		c.JSON(http.StatusBadGateway, gin.H{"error": sessionErr})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stdout":      stdout.String(),
+		"stderr":      stderr.String(),
+		"exit_code":   exitCode,
+		"timed_out":   timedOut,
+		"truncated":   stdout.truncated || stderr.truncated,
+		"duration_ms": time.Since(started).Milliseconds(),
+	})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetFolders(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	folders, err := models.GetFoldersByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch folders"})
+		return
+	}
+
+	if folders == nil {
+		folders = []models.Folder{}
+	}
+	c.JSON(http.StatusOK, gin.H{"folders": folders})
+}
+
+func CreateFolder(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	var input models.FolderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folder, err := models.CreateFolder(userID, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create folder: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Folder created successfully",
+		"folder":  folder,
+	})
+}
+
+func UpdateFolder(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	folderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
+		return
+	}
+
+	var input models.FolderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folder, err := models.UpdateFolder(folderID, userID, input)
+	if err == models.ErrFolderNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to update folder: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Folder updated successfully",
+		"folder":  folder,
+	})
+}
+
+func DeleteFolder(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	folderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
+		return
+	}
+
+	if err := models.DeleteFolder(folderID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder deleted successfully"})
+}
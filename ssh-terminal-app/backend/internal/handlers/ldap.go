@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"ssh-terminal-app/internal/ldapauth"
+	"ssh-terminal-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginWithLDAP checks the credentials against the directory and provisions
+// or updates the matching local user, including its team memberships.
+func loginWithLDAP(username, password string) (*models.User, error) {
+	entry, err := ldapauth.Authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// The directory is the authority for its users' addresses, so its email
+	// is treated as verified and may link to an existing local account.
+	user, err := models.FindOrCreateUserForIdentity(models.ExternalIdentity{
+		Provider:      "ldap",
+		Subject:       entry.ID,
+		Email:         entry.Email,
+		EmailVerified: true,
+		Name:          entry.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := models.SyncUserTeams(user.ID, models.TeamSourceLDAP, entry.Teams); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func respondLDAPError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ldapauth.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	case errors.Is(err, models.ErrInvalidInput):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		log.Printf("LDAP login error: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Directory login is unavailable"})
+	}
+}
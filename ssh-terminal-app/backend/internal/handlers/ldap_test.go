@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"ssh-terminal-app/internal/ldapauth"
+	"ssh-terminal-app/internal/ldapauth/ldaptest"
+	"ssh-terminal-app/internal/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testLDAPBaseDN = "ou=people,dc=example,dc=com"
+
+// useLDAPDirectory enables LDAP login against an in-process directory until
+// the test ends.
+func useLDAPDirectory(t *testing.T, entries ...ldaptest.Entry) *ldaptest.Directory {
+	t.Helper()
+	t.Setenv("LDAP_URL", "ldap://directory.test")
+	t.Setenv("LDAP_BASE_DN", testLDAPBaseDN)
+	t.Setenv("LDAP_TEAM_MAP", "cn=ops,ou=groups,dc=example,dc=com=>Operations")
+	if err := ldapauth.InitLDAP(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := ldaptest.NewDirectory(entries...)
+	previousDial := ldapauth.Dial
+	ldapauth.Dial = func(*ldapauth.Config) (ldapauth.Conn, error) { return dir.Dial(), nil }
+	t.Cleanup(func() {
+		ldapauth.Dial = previousDial
+		// Runs before t.Setenv restores the environment.
+		os.Unsetenv("LDAP_URL")
+		ldapauth.InitLDAP()
+	})
+	return dir
+}
+
+func ldapUser(uid, email, password string, groups ...string) ldaptest.Entry {
+	return ldaptest.Entry{
+		DN:       "uid=" + uid + "," + testLDAPBaseDN,
+		Password: password,
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {uid},
+			"mail":        {email},
+			"displayName": {"Directory " + uid},
+			"entryUUID":   {"uuid-" + email},
+			"memberOf":    groups,
+		},
+	}
+}
+
+func postLogin(r *gin.Engine, email, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.LoginInput{Email: email, Password: password})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func loginTestRouter() *gin.Engine {
+	r := gin.New()
+	r.POST("/api/auth/login", Login)
+	return r
+}
+
+func TestLDAPLoginProvisionsUser(t *testing.T) {
+	email := testEmail("ldap")
+	useLDAPDirectory(t, ldapUser("jit", email, "directory-secret", "CN=Ops,OU=Groups,DC=example,DC=com"))
+	r := loginTestRouter()
+
+	w := postLogin(r, email, "directory-secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var response struct {
+		Token string       `json:"token"`
+		User  *models.User `json:"user"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Token == "" || response.User == nil || response.User.Email != email {
+		t.Fatalf("response = %s", w.Body)
+	}
+
+	user, err := models.GetUserByEmail(email)
+	if err != nil {
+		t.Fatalf("user was not provisioned: %v", err)
+	}
+	if user.ID != response.User.ID || user.Name != "Directory jit" || user.EmailVerifiedAt == nil {
+		t.Fatalf("user = %+v", user)
+	}
+
+	identities, err := models.GetUserIdentities(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Provider != "ldap" || identities[0].Subject != "uuid-"+email {
+		t.Fatalf("identities = %+v", identities)
+	}
+
+	teams, err := models.GetUserTeams(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(teams) != 1 || teams[0].Name != "Operations" || teams[0].Source != models.TeamSourceLDAP {
+		t.Fatalf("teams = %+v", teams)
+	}
+
+	// A second login reuses the account and drops teams the user left.
+	dir := useLDAPDirectory(t, ldapUser("jit", email, "directory-secret"))
+	if w := postLogin(r, email, "directory-secret"); w.Code != http.StatusOK {
+		t.Fatalf("second login: status = %d, body %s", w.Code, w.Body)
+	}
+	if n := dir.Dials(); n != 1 {
+		t.Fatalf("directory dialed %d times", n)
+	}
+	if again, _ := models.GetUserByEmail(email); again.ID != user.ID {
+		t.Fatalf("second login created user %d, want %d", again.ID, user.ID)
+	}
+	if teams, _ := models.GetUserTeams(user.ID); len(teams) != 0 {
+		t.Fatalf("teams after leaving the group = %+v", teams)
+	}
+}
+
+func TestLDAPLoginFailuresLockAccount(t *testing.T) {
+	email := testEmail("ldap-lockout")
+	dir := useLDAPDirectory(t, ldapUser("lockout", email, "directory-secret"))
+	r := loginTestRouter()
+
+	for i := range 5 {
+		if w := postLogin(r, email, "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, body %s", i+1, w.Code, w.Body)
+		}
+	}
+	// The right password no longer reaches the directory.
+	w := postLogin(r, email, "directory-secret")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429, body %s", w.Code, w.Body)
+	}
+	if n := dir.Dials(); n != 5 {
+		t.Fatalf("directory dialed %d times, want 5", n)
+	}
+}
+
+func TestLDAPLoginRejectsEmptyPassword(t *testing.T) {
+	email := testEmail("ldap-empty")
+	dir := useLDAPDirectory(t, ldapUser("empty", email, "directory-secret"))
+
+	// An empty password would make the user bind unauthenticated.
+	if w := postLogin(loginTestRouter(), email, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	if n := dir.Dials(); n != 0 {
+		t.Fatalf("directory dialed %d times", n)
+	}
+}
+
+func TestLDAPLoginEscapesUsername(t *testing.T) {
+	email := testEmail("ldap-escape")
+	dir := useLDAPDirectory(t, ldapUser("escape", email, "directory-secret"))
+
+	if w := postLogin(loginTestRouter(), "*)(uid=*", "directory-secret"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	searches := dir.Searches()
+	if len(searches) != 1 || searches[0].Matches != 0 {
+		t.Fatalf("searches = %+v, want one matching nothing", searches)
+	}
+}
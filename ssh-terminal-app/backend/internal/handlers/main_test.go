@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"ssh-terminal-app/internal/crypto"
+	"ssh-terminal-app/internal/database"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMain runs the handler tests against a fresh SQLite database.
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "handlers-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DATABASE_DRIVER", database.DriverSQLite)
+	os.Setenv("DATABASE_PATH", filepath.Join(dir, "test.db"))
+	os.Setenv("ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+	os.Setenv("JWT_SECRET", "test-secret")
+
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+
+	if err := crypto.InitEncryption(); err != nil {
+		log.Fatal(err)
+	}
+	if err := database.InitDB(); err != nil {
+		log.Fatal(err)
+	}
+	defer database.DB.Close()
+	if err := models.InitRepository(); err != nil {
+		log.Fatal(err)
+	}
+	middleware.InitJWT()
+
+	return m.Run()
+}
+
+var testUserSeq atomic.Int64
+
+// testEmail returns an address no other test uses.
+func testEmail(prefix string) string {
+	return fmt.Sprintf("%s-%d@example.com", prefix, testUserSeq.Add(1))
+}
+
+// createTestUser registers a local account with a verified email.
+func createTestUser(t *testing.T, email, password string) *models.User {
+	t.Helper()
+	user, err := models.CreateUser(models.RegisterInput{Email: email, Password: password, Name: "Test"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := models.MarkEmailVerified(user.ID, user.Email); err != nil {
+		t.Fatalf("verify email: %v", err)
+	}
+	return user
+}
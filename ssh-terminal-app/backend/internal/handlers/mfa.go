@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"ssh-terminal-app/internal/crypto"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"ssh-terminal-app/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAVerifyInput struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFAEnrollInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code"`
+}
+
+type MFACodeInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	Password     string `json:"password"`
+}
+
+func mfaIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "SSH Terminal"
+}
+
+// mfaChallenge decides whether a login that passed the password step needs a
+// second factor. It returns nil when the login can complete right away.
+func mfaChallenge(user *models.User) (gin.H, error) {
+	if user.IsDisabled() {
+		return nil, models.ErrUserDisabled
+	}
+	methods, err := secondFactorMethods(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) > 0 {
+		token, err := middleware.GenerateMFAToken(user.ID, middleware.MFAPurposeVerify)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"mfa_required": true,
+			"mfa_token":    token,
+			"methods":      methods,
+			"expires_in":   int(middleware.MFATokenTTL.Seconds()),
+		}, nil
+	}
+
+	required, err := models.IsMFARequired()
+	if err != nil {
+		return nil, err
+	}
+	if !required {
+		return nil, nil
+	}
+
+	token, err := middleware.GenerateMFAToken(user.ID, middleware.MFAPurposeEnroll)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"mfa_enrollment_required": true,
+		"mfa_token":               token,
+		"expires_in":              int(middleware.MFATokenTTL.Seconds()),
+	}, nil
+}
+
+// secondFactorMethods lists the second factors the user has set up.
+func secondFactorMethods(userID int64) ([]string, error) {
+	var methods []string
+
+	totp, err := models.IsTOTPEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp {
+		methods = append(methods, "totp", "recovery_code")
+	}
+
+	webauthn, err := models.HasWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+	if webauthn {
+		methods = append(methods, "webauthn")
+	}
+	return methods, nil
+}
+
+// requireRemainingSecondFactor refuses to remove one of the user's second
+// factors when MFA is mandatory and it is the only one left.
+func requireRemainingSecondFactor(c *gin.Context, userID int64) bool {
+	required, err := models.IsMFARequired()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check MFA settings"})
+		return false
+	}
+	if !required {
+		return true
+	}
+
+	status, err := models.GetMFAStatus(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check MFA settings"})
+		return false
+	}
+
+	factors := status.WebAuthnCredentials
+	if status.TOTPEnabled {
+		factors++
+	}
+	if factors <= 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for all accounts"})
+		return false
+	}
+	return true
+}
+
+// checkSecondFactor accepts either a TOTP code or a recovery code.
+func checkSecondFactor(userID int64, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		return models.UseRecoveryCode(userID, recoveryCode)
+	}
+	if code == "" {
+		return models.ErrInvalidMFACode
+	}
+	return models.VerifyTOTPCode(userID, code)
+}
+
+func respondMFAError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+	case errors.Is(err, models.ErrTOTPAlreadyEnabled),
+		errors.Is(err, models.ErrTOTPNotEnabled),
+		errors.Is(err, models.ErrTOTPEnrollmentEmpty):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("MFA %s error: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// VerifyMFA completes a login with a second factor.
+func VerifyMFA(c *gin.Context) {
+	var input MFAVerifyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := middleware.ParseMFAToken(input.MFAToken, middleware.MFAPurposeVerify)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	user, err := models.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	account := mfaAccountKey(user.ID)
+	if !allowLoginAttempt(c, account) {
+		return
+	}
+	if err := checkSecondFactor(user.ID, input.Code, input.RecoveryCode); err != nil {
+		if errors.Is(err, models.ErrInvalidMFACode) {
+			recordLoginFailure(c, account)
+		}
+		respondMFAError(c, err, "verify code")
+		return
+	}
+	ratelimit.RecordSuccess(account)
+
+	response, err := startSession(c, user)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	response["message"] = "Login successful"
+	response["user"] = user
+	c.JSON(http.StatusOK, response)
+}
+
+// BeginMFAEnrollment starts TOTP enrollment during a login that requires MFA.
+func BeginMFAEnrollment(c *gin.Context) {
+	var input MFAEnrollInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := middleware.ParseMFAToken(input.MFAToken, middleware.MFAPurposeEnroll)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	user, err := models.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	beginTOTPEnrollment(c, user)
+}
+
+// ConfirmMFAEnrollment finishes enrollment during a login and completes it.
+func ConfirmMFAEnrollment(c *gin.Context) {
+	var input MFAEnrollInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := middleware.ParseMFAToken(input.MFAToken, middleware.MFAPurposeEnroll)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	user, err := models.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	codes, err := models.ConfirmTOTPEnrollment(user.ID, input.Code)
+	if err != nil {
+		respondMFAError(c, err, "enable two-factor authentication")
+		return
+	}
+
+	response, err := startSession(c, user)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	response["message"] = "Two-factor authentication enabled"
+	response["user"] = user
+	response["recovery_codes"] = codes
+	c.JSON(http.StatusOK, response)
+}
+
+func GetMFAStatus(c *gin.Context) {
+	status, err := models.GetMFAStatus(middleware.GetCurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch MFA status"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func SetupTOTP(c *gin.Context) {
+	beginTOTPEnrollment(c, middleware.GetCurrentUser(c))
+}
+
+func beginTOTPEnrollment(c *gin.Context, user *models.User) {
+	secret, err := models.BeginTOTPEnrollment(user.ID)
+	if err != nil {
+		respondMFAError(c, err, "start enrollment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": crypto.TOTPURI(mfaIssuer(), user.Email, secret),
+	})
+}
+
+func ConfirmTOTP(c *gin.Context) {
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := models.ConfirmTOTPEnrollment(middleware.GetCurrentUserID(c), input.Code)
+	if err != nil {
+		respondMFAError(c, err, "enable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP turns off TOTP. It needs the password (for local accounts) and
+// a current TOTP or recovery code.
+func DisableTOTP(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !requireRemainingSecondFactor(c, user.ID) {
+		return
+	}
+
+	if user.PasswordHash != "" && !user.CheckPassword(input.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	if err := checkSecondFactor(user.ID, input.Code, input.RecoveryCode); err != nil {
+		respondMFAError(c, err, "disable two-factor authentication")
+		return
+	}
+
+	if err := models.DisableTOTP(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes. Like DisableTOTP, it
+// needs the password (for local accounts) and a current TOTP or recovery
+// code, so that a stolen access token cannot be turned into lasting access.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user.PasswordHash != "" && !user.CheckPassword(input.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	if err := checkSecondFactor(user.ID, input.Code, input.RecoveryCode); err != nil {
+		respondMFAError(c, err, "verify code")
+		return
+	}
+
+	codes, err := models.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		respondMFAError(c, err, "generate recovery codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
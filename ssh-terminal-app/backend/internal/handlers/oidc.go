@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"ssh-terminal-app/internal/crypto"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+// oidcProvider is one configured OpenID Connect identity provider. Discovery
+// runs on first use so a provider that is down at startup does not keep the
+// server from booting; a failed discovery is retried on the next login.
+type oidcProvider struct {
+	Name        string
+	DisplayName string
+	Issuer      string
+
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	provider *oidc.Provider
+}
+
+var (
+	oidcProviders     = map[string]*oidcProvider{}
+	oidcProviderNames []string
+)
+
+const oauthStateCookie = "oauth_state"
+
+// InitOIDC loads the identity providers. OIDC_PROVIDERS lists provider names,
+// each configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and optionally _SCOPES and _DISPLAY_NAME. Google is added
+// from the GOOGLE_* variables when GOOGLE_CLIENT_ID is set.
+func InitOIDC() {
+	oidcProviders = map[string]*oidcProvider{}
+	oidcProviderNames = nil
+
+	if clientID := os.Getenv("GOOGLE_CLIENT_ID"); clientID != "" {
+		addOIDCProvider(&oidcProvider{
+			Name:         "google",
+			DisplayName:  "Google",
+			Issuer:       "https://accounts.google.com",
+			clientID:     clientID,
+			clientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			redirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
+		})
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := &oidcProvider{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			clientID:     os.Getenv(prefix + "CLIENT_ID"),
+			clientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			redirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			p.scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+		if p.DisplayName == "" {
+			p.DisplayName = name
+		}
+		if p.Issuer == "" || p.clientID == "" || p.redirectURL == "" {
+			log.Printf("OIDC provider %q skipped: %sISSUER, %sCLIENT_ID and %sREDIRECT_URL are required", name, prefix, prefix, prefix)
+			continue
+		}
+		addOIDCProvider(p)
+	}
+}
+
+func addOIDCProvider(p *oidcProvider) {
+	if len(p.scopes) == 0 {
+		p.scopes = []string{"profile", "email"}
+	}
+	if _, exists := oidcProviders[p.Name]; !exists {
+		oidcProviderNames = append(oidcProviderNames, p.Name)
+	}
+	oidcProviders[p.Name] = p
+}
+
+// client runs discovery if it has not succeeded yet and returns the OAuth2
+// config and ID token verifier for the provider.
+func (p *oidcProvider) client(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider == nil {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		provider, err := oidc.NewProvider(ctx, p.Issuer)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		scopes := []string{oidc.ScopeOpenID}
+		for _, scope := range p.scopes {
+			if scope != oidc.ScopeOpenID {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		p.provider = provider
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: p.clientID})
+		p.oauth = &oauth2.Config{
+			ClientID:     p.clientID,
+			ClientSecret: p.clientSecret,
+			RedirectURL:  p.redirectURL,
+			Scopes:       scopes,
+			Endpoint:     provider.Endpoint(),
+		}
+	}
+	return p.oauth, p.verifier, nil
+}
+
+// oidcClaims are the ID token claims used to identify the user.
+type oidcClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+}
+
+func frontendURL() string {
+	if u := os.Getenv("FRONTEND_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:5173"
+}
+
+func redirectLoginError(c *gin.Context, code string) {
+	c.Redirect(http.StatusTemporaryRedirect, frontendURL()+"/login?error="+code)
+}
+
+// GetOIDCProviders lists the providers the login page can offer.
+func GetOIDCProviders(c *gin.Context) {
+	providers := []gin.H{}
+	for _, name := range oidcProviderNames {
+		p := oidcProviders[name]
+		providers = append(providers, gin.H{
+			"name":         p.Name,
+			"display_name": p.DisplayName,
+			"login_url":    "/api/auth/oidc/" + p.Name + "/login",
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": providers})
+}
+
+func OIDCLogin(c *gin.Context) {
+	oidcLogin(c, c.Param("provider"))
+}
+
+func OIDCCallback(c *gin.Context) {
+	oidcCallback(c, c.Param("provider"))
+}
+
+// GoogleLogin and GoogleCallback keep the original Google URLs working, since
+// they are registered as redirect URIs with Google.
+func GoogleLogin(c *gin.Context) {
+	oidcLogin(c, "google")
+}
+
+func GoogleCallback(c *gin.Context) {
+	oidcCallback(c, "google")
+}
+
+func oidcLogin(c *gin.Context, name string) {
+	p, ok := oidcProviders[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	config, _, err := p.client(c.Request.Context())
+	if err != nil {
+		log.Printf("OIDC discovery for %s failed: %v", p.Name, err)
+		redirectLoginError(c, "provider_unavailable")
+		return
+	}
+
+	state, err := crypto.GenerateRandomToken(24)
+	if err != nil {
+		redirectLoginError(c, "login_failed")
+		return
+	}
+	nonce, err := crypto.GenerateRandomToken(24)
+	if err != nil {
+		redirectLoginError(c, "login_failed")
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	stateToken, err := middleware.GenerateOAuthStateToken(p.Name, state, nonce, verifier)
+	if err != nil {
+		redirectLoginError(c, "login_failed")
+		return
+	}
+	c.SetCookie(oauthStateCookie, stateToken, int(middleware.OAuthStateTTL.Seconds()), "/api/auth", "", false, true)
+
+	c.Redirect(http.StatusTemporaryRedirect, config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)))
+}
+
+func oidcCallback(c *gin.Context, name string) {
+	p, ok := oidcProviders[name]
+	if !ok {
+		redirectLoginError(c, "unknown_provider")
+		return
+	}
+
+	if e := c.Query("error"); e != "" {
+		log.Printf("OIDC %s returned error: %s %s", p.Name, e, c.Query("error_description"))
+		redirectLoginError(c, "provider_denied")
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		redirectLoginError(c, "missing_code")
+		return
+	}
+
+	// The state must match the one bound to this browser by OIDCLogin,
+	// otherwise the callback could be a forged cross-site request.
+	stateToken, _ := c.Cookie(oauthStateCookie)
+	c.SetCookie(oauthStateCookie, "", -1, "/api/auth", "", false, true)
+	loginState, err := middleware.ParseOAuthStateToken(stateToken)
+	if err != nil || loginState.Provider != p.Name ||
+		subtle.ConstantTimeCompare([]byte(loginState.State), []byte(c.Query("state"))) != 1 {
+		redirectLoginError(c, "invalid_state")
+		return
+	}
+
+	ctx := c.Request.Context()
+	config, verifier, err := p.client(ctx)
+	if err != nil {
+		log.Printf("OIDC discovery for %s failed: %v", p.Name, err)
+		redirectLoginError(c, "provider_unavailable")
+		return
+	}
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		log.Printf("OIDC %s token exchange error: %v", p.Name, err)
+		redirectLoginError(c, "exchange_failed")
+		return
+	}
+
+	identity, err := p.verifyIdentity(ctx, verifier, token, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC %s ID token error: %v", p.Name, err)
+		redirectLoginError(c, "invalid_id_token")
+		return
+	}
+
+	user, err := models.FindOrCreateUserForIdentity(*identity)
+	if errors.Is(err, models.ErrUnverifiedIdentityEmail) {
+		redirectLoginError(c, "email_not_verified")
+		return
+	}
+	if err != nil {
+		log.Printf("OIDC %s user error: %v", p.Name, err)
+		redirectLoginError(c, "create_user_failed")
+		return
+	}
+
+	// The frontend trades this code for tokens (or an MFA challenge) through
+	// ExchangeAuthCode, keeping credentials out of URLs and browser history.
+	exchangeCode, err := models.CreateAuthExchangeCode(user.ID)
+	if err != nil {
+		log.Printf("Exchange code error: %v", err)
+		redirectLoginError(c, "token_failed")
+		return
+	}
+
+	c.Redirect(http.StatusTemporaryRedirect, frontendURL()+"/auth/callback?code="+url.QueryEscape(exchangeCode))
+}
+
+// verifyIdentity checks the ID token's signature, issuer, audience, expiry and
+// nonce, then reads the user's identity from it. Providers that leave the
+// email out of the ID token are asked through the UserInfo endpoint.
+func (p *oidcProvider) verifyIdentity(ctx context.Context, verifier *oidc.IDTokenVerifier, token *oauth2.Token, nonce string) (*models.ExternalIdentity, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+
+	if claims.Email == "" {
+		info, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, fmt.Errorf("userinfo: %w", err)
+		}
+		if info.Subject != idToken.Subject {
+			return nil, errors.New("userinfo subject does not match ID token")
+		}
+		var infoClaims oidcClaims
+		if err := info.Claims(&infoClaims); err != nil {
+			return nil, err
+		}
+		claims.Email = info.Email
+		claims.EmailVerified = &info.EmailVerified
+		if claims.Name == "" {
+			claims.Name = infoClaims.Name
+		}
+	}
+
+	return &models.ExternalIdentity{
+		Provider:      p.Name,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified != nil && *claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+func GetUserIdentities(c *gin.Context) {
+	identities, err := models.GetUserIdentities(middleware.GetCurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch linked accounts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+func OIDCProviderNames() []string {
+	return oidcProviderNames
+}
+
+type ExchangeCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ExchangeAuthCode completes an identity provider login with the one-time code
+// from the callback redirect.
+func ExchangeAuthCode(c *gin.Context) {
+	var input ExchangeCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := models.TakeAuthExchangeCode(input.Code)
+	if errors.Is(err, models.ErrInvalidExchangeCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete login"})
+		return
+	}
+
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	challenge, err := mfaChallenge(user)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	response, err := startSession(c, user)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	response["message"] = "Login successful"
+	response["user"] = user
+	c.JSON(http.StatusOK, response)
+}
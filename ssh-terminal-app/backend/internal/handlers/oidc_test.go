@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"ssh-terminal-app/internal/models"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mockClientID = "test-client"
+	mockKeyID    = "test-key"
+)
+
+// mockIdP is an OpenID Connect provider serving discovery, JWKS, token and
+// userinfo endpoints. The token endpoint returns the ID token built by
+// idToken for the nonce of the last authorization request.
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	idToken   func(claims jwt.MapClaims) string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"userinfo_endpoint":                     idp.URL + "/userinfo",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": mockKeyID,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+
+		// PKCE: the verifier must match the challenge of the login
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idp.idToken(idp.claims),
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	idp.idToken = idp.sign(key)
+	return idp
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// sign returns an ID token builder signing with key.
+func (idp *mockIdP) sign(key *rsa.PrivateKey) func(jwt.MapClaims) string {
+	return func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = mockKeyID
+		signed, err := token.SignedString(key)
+		if err != nil {
+			panic(err)
+		}
+		return signed
+	}
+}
+
+// register adds the IdP as an OIDC provider of the server under name.
+func (idp *mockIdP) register(name string) {
+	addOIDCProvider(&oidcProvider{
+		Name:         name,
+		DisplayName:  name,
+		Issuer:       idp.URL,
+		clientID:     mockClientID,
+		clientSecret: "test-secret",
+		redirectURL:  "http://localhost/api/auth/oidc/" + name + "/callback",
+	})
+}
+
+func oidcTestRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/api/auth/oidc/:provider/login", OIDCLogin)
+	r.GET("/api/auth/oidc/:provider/callback", OIDCCallback)
+	return r
+}
+
+// oidcLoginFlow is a login started against the server.
+type oidcLoginFlow struct {
+	state, nonce string
+	cookie       *http.Cookie
+}
+
+func startOIDCLogin(t *testing.T, r *gin.Engine, idp *mockIdP, provider string) oidcLoginFlow {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/"+provider+"/login", nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("login: status %d", w.Code)
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), idp.URL+"/authorize") {
+		t.Fatalf("login redirects to %q", w.Header().Get("Location"))
+	}
+	query := location.Query()
+	if query.Get("client_id") != mockClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %q", location.RawQuery)
+	}
+
+	idp.mu.Lock()
+	idp.challenge = query.Get("code_challenge")
+	idp.mu.Unlock()
+
+	flow := oidcLoginFlow{state: query.Get("state"), nonce: query.Get("nonce")}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oauthStateCookie {
+			flow.cookie = c
+		}
+	}
+	if flow.cookie == nil {
+		t.Fatal("login did not set the state cookie")
+	}
+	return flow
+}
+
+// finishOIDCLogin calls the callback and returns where it redirects to.
+func finishOIDCLogin(t *testing.T, r *gin.Engine, provider, state string, cookie *http.Cookie) *url.URL {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/"+provider+"/callback?code=auth-code&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("callback: status %d", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func (idp *mockIdP) defaultClaims(nonce, subject, email string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            idp.URL,
+		"sub":            subject,
+		"aud":            mockClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          email,
+		"email_verified": true,
+		"name":           "OIDC User",
+	}
+}
+
+// loginUserID returns the user an exchange code from a successful login
+// belongs to.
+func loginUserID(t *testing.T, location *url.URL) int64 {
+	t.Helper()
+	if location.Path != "/auth/callback" {
+		t.Fatalf("login failed: redirected to %s", location)
+	}
+	userID, err := models.TakeAuthExchangeCode(location.Query().Get("code"))
+	if err != nil {
+		t.Fatalf("exchange code: %v", err)
+	}
+	return userID
+}
+
+func TestOIDCIDTokenVerification(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// modify changes the claims or the signer of the ID token
+		modify    func(idp *mockIdP, claims jwt.MapClaims)
+		wantError string
+	}{
+		{name: "valid token"},
+		{
+			name:      "signed with another key",
+			modify:    func(idp *mockIdP, _ jwt.MapClaims) { idp.idToken = idp.sign(otherKey) },
+			wantError: "invalid_id_token",
+		},
+		{
+			name:      "wrong issuer",
+			modify:    func(_ *mockIdP, c jwt.MapClaims) { c["iss"] = "https://issuer.invalid" },
+			wantError: "invalid_id_token",
+		},
+		{
+			name:      "wrong audience",
+			modify:    func(_ *mockIdP, c jwt.MapClaims) { c["aud"] = "another-client" },
+			wantError: "invalid_id_token",
+		},
+		{
+			name:      "wrong nonce",
+			modify:    func(_ *mockIdP, c jwt.MapClaims) { c["nonce"] = "replayed-nonce" },
+			wantError: "invalid_id_token",
+		},
+		{
+			name: "expired",
+			modify: func(_ *mockIdP, c jwt.MapClaims) {
+				c["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+				c["exp"] = time.Now().Add(-time.Hour).Unix()
+			},
+			wantError: "invalid_id_token",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			provider := fmt.Sprintf("verify-%d", i)
+			idp.register(provider)
+			r := oidcTestRouter()
+
+			flow := startOIDCLogin(t, r, idp, provider)
+			email := testEmail("oidc")
+			idp.claims = idp.defaultClaims(flow.nonce, "subject-"+email, email)
+			if tt.modify != nil {
+				tt.modify(idp, idp.claims)
+			}
+
+			location := finishOIDCLogin(t, r, provider, flow.state, flow.cookie)
+			if tt.wantError != "" {
+				if got := location.Query().Get("error"); got != tt.wantError {
+					t.Fatalf("error = %q, want %q (redirect %s)", got, tt.wantError, location)
+				}
+				if _, err := models.GetUserByEmail(email); err == nil {
+					t.Fatal("a user was created for a rejected token")
+				}
+				return
+			}
+
+			userID := loginUserID(t, location)
+			user, err := models.GetUserByID(userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Email != email || user.EmailVerifiedAt == nil {
+				t.Fatalf("provisioned user %+v", user)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsBadState(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.register("state")
+	r := oidcTestRouter()
+
+	tests := []struct {
+		name   string
+		state  func(flow oidcLoginFlow) string
+		cookie func(flow oidcLoginFlow) *http.Cookie
+	}{
+		{
+			name:   "state does not match",
+			state:  func(oidcLoginFlow) string { return "forged-state" },
+			cookie: func(flow oidcLoginFlow) *http.Cookie { return flow.cookie },
+		},
+		{
+			name:   "no state cookie",
+			state:  func(flow oidcLoginFlow) string { return flow.state },
+			cookie: func(oidcLoginFlow) *http.Cookie { return nil },
+		},
+		{
+			name:  "tampered state cookie",
+			state: func(flow oidcLoginFlow) string { return flow.state },
+			cookie: func(flow oidcLoginFlow) *http.Cookie {
+				return &http.Cookie{Name: oauthStateCookie, Value: flow.cookie.Value + "x"}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := startOIDCLogin(t, r, idp, "state")
+			email := testEmail("state")
+			idp.claims = idp.defaultClaims(flow.nonce, "subject-"+email, email)
+
+			location := finishOIDCLogin(t, r, "state", tt.state(flow), tt.cookie(flow))
+			if got := location.Query().Get("error"); got != "invalid_state" {
+				t.Fatalf("error = %q, want invalid_state (redirect %s)", got, location)
+			}
+		})
+	}
+}
+
+func TestOIDCLinksExistingAccount(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.register("link")
+	r := oidcTestRouter()
+
+	email := testEmail("link")
+	existing := createTestUser(t, email, "Passw0rd!")
+
+	login := func(subject, email string, verified bool) *url.URL {
+		flow := startOIDCLogin(t, r, idp, "link")
+		idp.claims = idp.defaultClaims(flow.nonce, subject, email)
+		idp.claims["email_verified"] = verified
+		return finishOIDCLogin(t, r, "link", flow.state, flow.cookie)
+	}
+
+	// An unverified address must not take over the account
+	location := login("link-subject", email, false)
+	if got := location.Query().Get("error"); got != "email_not_verified" {
+		t.Fatalf("unverified email: error = %q, want email_not_verified", got)
+	}
+
+	if userID := loginUserID(t, login("link-subject", email, true)); userID != existing.ID {
+		t.Fatalf("verified email logged in as user %d, want %d", userID, existing.ID)
+	}
+	identities, err := models.GetUserIdentities(existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Provider != "link" {
+		t.Fatalf("identities = %+v, want one for provider link", identities)
+	}
+
+	// The identity keeps pointing at the account after the email changes
+	if userID := loginUserID(t, login("link-subject", testEmail("renamed"), true)); userID != existing.ID {
+		t.Fatalf("linked identity logged in as user %d, want %d", userID, existing.ID)
+	}
+}
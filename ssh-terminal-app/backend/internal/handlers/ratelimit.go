@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"log"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/ratelimit"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func loginAccountKey(identifier string) string {
+	return "login-account:" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+func mfaAccountKey(userID int64) string {
+	return "mfa-user:" + strconv.FormatInt(userID, 10)
+}
+
+// allowLoginAttempt rejects attempts against a locked out account and
+// throttles guessing against a single account from many addresses.
+func allowLoginAttempt(c *gin.Context, key string) bool {
+	if lockedFor := ratelimit.LockedFor(key, ratelimit.LoginLockout); lockedFor > 0 {
+		middleware.AbortTooManyRequests(c, lockedFor, "Too many failed attempts, account is temporarily locked")
+		return false
+	}
+	if ok, retryAfter := ratelimit.Allow(key, ratelimit.LoginAccount); !ok {
+		middleware.AbortTooManyRequests(c, retryAfter, "Too many login attempts, please try again later")
+		return false
+	}
+	return true
+}
+
+func recordLoginFailure(c *gin.Context, key string) {
+	if lockedFor := ratelimit.RecordFailure(key, ratelimit.LoginLockout); lockedFor > 0 {
+		log.Printf("Locked %s for %s after repeated failures from %s", key, lockedFor, c.ClientIP())
+	}
+}
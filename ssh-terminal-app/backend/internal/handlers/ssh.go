@@ -1,32 +1,129 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"ssh-terminal-app/internal/middleware"
 	"ssh-terminal-app/internal/models"
+	"ssh-terminal-app/internal/ratelimit"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
+// GetConnections lists connections. Supported query parameters:
+// q, tag (repeatable), folder_id ("root" for unfiled), recursive, favorite,
+// sort (name|last_used|created), order (asc|desc), cursor and limit.
 func GetConnections(c *gin.Context) {
 	userID := middleware.GetCurrentUserID(c)
 
-	connections, err := models.GetSSHConnectionsByUserID(userID)
+	filter := models.SSHConnectionFilter{
+		Search:    c.Query("q"),
+		Tags:      c.QueryArray("tag"),
+		Recursive: c.Query("recursive") == "true",
+		Favorites: c.Query("favorite") == "true",
+		Sort:      c.Query("sort"),
+		Order:     c.Query("order"),
+		Cursor:    c.Query("cursor"),
+	}
+
+	if folder := c.Query("folder_id"); folder != "" {
+		var folderID int64
+		if folder != "root" {
+			id, err := strconv.ParseInt(folder, 10, 64)
+			if err != nil || id <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
+				return
+			}
+			folderID = id
+		}
+		filter.FolderID = &folderID
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		filter.Limit = n
+	}
+
+	switch filter.Sort {
+	case "", "name", "last_used", "created":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort. Must be 'name', 'last_used' or 'created'"})
+		return
+	}
+	switch filter.Order {
+	case "", "asc", "desc":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order. Must be 'asc' or 'desc'"})
+		return
+	}
+
+	page, err := models.ListSSHConnections(userID, filter)
+	if err == models.ErrInvalidCursor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch connections"})
 		return
 	}
 
-	var response []models.SSHConnectionResponse
-	for _, conn := range connections {
+	response := []models.SSHConnectionResponse{}
+	for _, conn := range page.Connections {
+		response = append(response, conn.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"connections": response,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+func GetRecentConnections(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	limit := 10
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	page, err := models.ListSSHConnections(userID, models.SSHConnectionFilter{
+		Sort:     "last_used",
+		Order:    "desc",
+		UsedOnly: true,
+		Limit:    limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recent connections"})
+		return
+	}
+
+	response := []models.SSHConnectionResponse{}
+	for _, conn := range page.Connections {
 		response = append(response, conn.ToResponse())
 	}
 
 	c.JSON(http.StatusOK, gin.H{"connections": response})
 }
 
-func GetConnection(c *gin.Context) {
+func AddFavorite(c *gin.Context) {
+	setFavorite(c, true)
+}
+
+func RemoveFavorite(c *gin.Context) {
+	setFavorite(c, false)
+}
+
+func setFavorite(c *gin.Context, favorite bool) {
 	userID := middleware.GetCurrentUserID(c)
 	connID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -34,42 +131,74 @@ func GetConnection(c *gin.Context) {
 		return
 	}
 
-	connection, err := models.GetSSHConnectionByID(connID, userID)
-	if err != nil {
+	if err := models.SetSSHConnectionFavorite(connID, userID, favorite); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"connection": connection.ToResponse()})
+	c.JSON(http.StatusOK, gin.H{"is_favorite": favorite})
 }
 
-func CreateConnection(c *gin.Context) {
+func GetConnectionStats(c *gin.Context) {
 	userID := middleware.GetCurrentUserID(c)
+	connID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection ID"})
+		return
+	}
 
-	var input models.SSHConnectionInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	stats, err := models.GetSSHConnectionStats(connID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
 		return
 	}
 
-	if input.AuthType == "" {
-		input.AuthType = "password"
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
+
+func GetTags(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	tags, err := models.GetUserTags(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
 	}
-	if input.AuthType != "password" && input.AuthType != "key" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid auth_type. Must be 'password' or 'key'"})
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+func GetConnection(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	connID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection ID"})
 		return
 	}
 
-	if input.AuthType == "password" && input.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required for password authentication"})
+	connection, err := models.GetSSHConnectionByID(connID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
 		return
 	}
-	if input.AuthType == "key" && input.PrivateKey == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Private key is required for key authentication"})
+
+	c.JSON(http.StatusOK, gin.H{"connection": connection.ToResponse()})
+}
+
+func CreateConnection(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	var input models.SSHConnectionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	connection, err := models.CreateSSHConnection(userID, input)
+	if errors.Is(err, models.ErrInvalidInput) || errors.Is(err, models.ErrFolderNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create connection: " + err.Error()})
 		return
@@ -96,10 +225,15 @@ func UpdateConnection(c *gin.Context) {
 	}
 
 	connection, err := models.UpdateSSHConnection(connID, userID, input)
+	if errors.Is(err, models.ErrInvalidInput) || errors.Is(err, models.ErrFolderNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update connection: " + err.Error()})
 		return
 	}
+	evictSSHClients(userID, connID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "Connection updated successfully",
@@ -120,6 +254,7 @@ func DeleteConnection(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
 		return
 	}
+	evictSSHClients(userID, connID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Connection deleted successfully"})
 }
@@ -138,7 +273,12 @@ func TestConnection(c *gin.Context) {
 		return
 	}
 
-	client, err := createSSHClient(connection)
+	// A pooled client would pass without checking the stored credentials.
+	client, _, err := createSSHClient(connection)
+	if errors.Is(err, ratelimit.ErrTooManyDials) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -146,7 +286,7 @@ func TestConnection(c *gin.Context) {
 		})
 		return
 	}
-	defer client.Close()
+	client.Close()
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
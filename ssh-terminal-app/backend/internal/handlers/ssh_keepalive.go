@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"ssh-terminal-app/internal/models"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Keepalive defaults for connections without their own settings.
+// SSH_KEEPALIVE_INTERVAL of 0 disables keepalives.
+var (
+	sshKeepaliveInterval  = 15 * time.Second
+	sshKeepaliveMaxMissed = 3
+)
+
+// sshKeepalive sends keepalive requests on a client while terminals use it.
+// A peer that leaves maxMissed requests in a row unanswered is declared dead
+// and the client is closed, which ends every session on it.
+type sshKeepalive struct {
+	client    *ssh.Client
+	interval  time.Duration
+	maxMissed int
+
+	refs int
+	stop chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+var sshKeepalives = struct {
+	sync.Mutex
+	clients map[*ssh.Client]*sshKeepalive
+}{clients: map[*ssh.Client]*sshKeepalive{}}
+
+// InitSSHKeepalive reads the keepalive defaults.
+func InitSSHKeepalive() error {
+	if v := os.Getenv("SSH_KEEPALIVE_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("SSH_KEEPALIVE_INTERVAL: invalid duration %q", v)
+		}
+		sshKeepaliveInterval = d
+	}
+	if v := os.Getenv("SSH_KEEPALIVE_MAX_MISSED"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("SSH_KEEPALIVE_MAX_MISSED: invalid count %q", v)
+		}
+		sshKeepaliveMaxMissed = n
+	}
+	return nil
+}
+
+// watchSSHClient starts keepalives on a client, or joins the ones already
+// running for it, using the connection's settings. The returned function
+// stops watching.
+func watchSSHClient(client *ssh.Client, conn *models.SSHConnection) (*sshKeepalive, func()) {
+	sshKeepalives.Lock()
+	defer sshKeepalives.Unlock()
+
+	k := sshKeepalives.clients[client]
+	if k == nil {
+		interval, maxMissed := sshKeepaliveInterval, sshKeepaliveMaxMissed
+		if conn.KeepaliveInterval != nil {
+			interval = time.Duration(*conn.KeepaliveInterval) * time.Second
+		}
+		if conn.KeepaliveMaxMissed != nil {
+			maxMissed = *conn.KeepaliveMaxMissed
+		}
+
+		k = &sshKeepalive{client: client, interval: interval, maxMissed: maxMissed, stop: make(chan struct{})}
+		sshKeepalives.clients[client] = k
+		if interval > 0 {
+			go k.run(conn.ID)
+		}
+	}
+	k.refs++
+
+	var once sync.Once
+	return k, func() {
+		once.Do(func() {
+			sshKeepalives.Lock()
+			defer sshKeepalives.Unlock()
+			k.refs--
+			if k.refs == 0 {
+				close(k.stop)
+				delete(sshKeepalives.clients, client)
+			}
+		})
+	}
+}
+
+// Err returns why the peer was declared dead, or nil.
+func (k *sshKeepalive) Err() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.err
+}
+
+func (k *sshKeepalive) run(connectionID int64) {
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	// answered is set while a request is outstanding
+	var answered chan error
+	missed := 0
+	for {
+		select {
+		case <-k.stop:
+			return
+		case err := <-answered:
+			if err != nil {
+				// The client was closed
+				return
+			}
+			answered = nil
+			missed = 0
+		case <-ticker.C:
+			if answered != nil {
+				missed++
+				if missed >= k.maxMissed {
+					k.mu.Lock()
+					k.err = fmt.Errorf("no response to %d keepalive requests", missed)
+					k.mu.Unlock()
+					log.Printf("SSH peer of connection %d is unresponsive, closing: %v", connectionID, k.Err())
+					k.client.Close()
+					return
+				}
+				continue
+			}
+			answered = make(chan error, 1)
+			go func(answered chan<- error) {
+				_, _, err := k.client.SendRequest("keepalive@openssh.com", true, nil)
+				answered <- err
+			}(answered)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"ssh-terminal-app/internal/models"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Pool settings. SSH_POOL_IDLE_TIMEOUT is how long an unused client stays
+// open, 0 disables pooling; SSH_POOL_CHECK_INTERVAL is how often idle clients
+// are health-checked.
+var (
+	sshPoolIdleTimeout   = 5 * time.Minute
+	sshPoolCheckInterval = 30 * time.Second
+)
+
+const (
+	// maxPooledSessions is how many sessions share a pooled client. OpenSSH
+	// allows 10 per connection by default.
+	maxPooledSessions   = 8
+	sshKeepaliveTimeout = 10 * time.Second
+)
+
+type sshPoolKey struct {
+	userID       int64
+	connectionID int64
+}
+
+// pooledSSHClient is an authenticated client shared by the sessions of one
+// connection. An evicted client takes no new sessions and closes once the
+// last one ends.
+type pooledSSHClient struct {
+	key         sshPoolKey
+	client      *ssh.Client
+	fingerprint string
+	// jumps are the jump connections the client was dialed through.
+	jumps     []int64
+	sessions  int
+	idleSince time.Time
+	evicted   bool
+}
+
+var sshPool = struct {
+	sync.Mutex
+	clients map[sshPoolKey][]*pooledSSHClient
+}{clients: map[sshPoolKey][]*pooledSSHClient{}}
+
+// InitSSHPool reads the pool settings and starts the health checks.
+func InitSSHPool() error {
+	settings := []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"SSH_POOL_IDLE_TIMEOUT", &sshPoolIdleTimeout},
+		{"SSH_POOL_CHECK_INTERVAL", &sshPoolCheckInterval},
+	}
+	for _, s := range settings {
+		if v := os.Getenv(s.env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return fmt.Errorf("%s: invalid duration %q", s.env, v)
+			}
+			*s.value = d
+		}
+	}
+	if sshPoolCheckInterval == 0 {
+		return errors.New("SSH_POOL_CHECK_INTERVAL must be positive")
+	}
+
+	if sshPoolIdleTimeout > 0 {
+		go sweepSSHPool()
+	}
+	return nil
+}
+
+// acquireSSHClient returns a client for the connection, reusing a pooled one
+// when its settings are unchanged. The returned function gives it back.
+func acquireSSHClient(conn *models.SSHConnection) (*ssh.Client, func(), error) {
+	if sshPoolIdleTimeout == 0 {
+		client, _, err := createSSHClient(conn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, func() { client.Close() }, nil
+	}
+
+	key := sshPoolKey{conn.UserID, conn.ID}
+	fingerprint := sshClientFingerprint(conn)
+	for {
+		pc, idleFor := takePooledSSHClient(key, fingerprint)
+		if pc == nil {
+			break
+		}
+		if idleFor < sshPoolCheckInterval || pingSSHClient(pc.client) == nil {
+			return pc.client, releaser(pc), nil
+		}
+		log.Printf("Discarding unresponsive pooled SSH client for connection %d", key.connectionID)
+		evictPooledSSHClient(pc)
+		releasePooledSSHClient(pc)
+	}
+
+	client, jumps, err := createSSHClient(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	pc := &pooledSSHClient{key: key, client: client, fingerprint: fingerprint, jumps: jumps, sessions: 1}
+
+	sshPool.Lock()
+	sshPool.clients[key] = append(sshPool.clients[key], pc)
+	sshPool.Unlock()
+
+	go func() {
+		client.Wait()
+		evictPooledSSHClient(pc)
+	}()
+	return client, releaser(pc), nil
+}
+
+// takePooledSSHClient reserves a session on a pooled client and returns how
+// long the client had been idle. Clients dialed with other settings are
+// evicted on the way.
+func takePooledSSHClient(key sshPoolKey, fingerprint string) (*pooledSSHClient, time.Duration) {
+	sshPool.Lock()
+	defer sshPool.Unlock()
+
+	var stale []*pooledSSHClient
+	defer func() {
+		for _, pc := range stale {
+			pc.client.Close()
+		}
+	}()
+
+	// Retiring a client removes it from the list being walked.
+	for _, pc := range slices.Clone(sshPool.clients[key]) {
+		if pc.fingerprint != fingerprint {
+			if retirePooledSSHClient(pc) {
+				stale = append(stale, pc)
+			}
+			continue
+		}
+		if pc.evicted || pc.sessions >= maxPooledSessions {
+			continue
+		}
+
+		var idleFor time.Duration
+		if pc.sessions == 0 {
+			idleFor = time.Since(pc.idleSince)
+		}
+		pc.sessions++
+		return pc, idleFor
+	}
+	return nil, 0
+}
+
+func releaser(pc *pooledSSHClient) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			releasePooledSSHClient(pc)
+		})
+	}
+}
+
+func releasePooledSSHClient(pc *pooledSSHClient) {
+	sshPool.Lock()
+	pc.sessions--
+	closeNow := false
+	if pc.sessions == 0 {
+		pc.idleSince = time.Now()
+		closeNow = pc.evicted
+	}
+	sshPool.Unlock()
+
+	if closeNow {
+		pc.client.Close()
+	}
+}
+
+// retirePooledSSHClient removes the client from the pool and reports whether
+// it is unused and should be closed. The pool must be locked.
+func retirePooledSSHClient(pc *pooledSSHClient) bool {
+	if !pc.evicted {
+		pc.evicted = true
+		list := slices.DeleteFunc(sshPool.clients[pc.key], func(other *pooledSSHClient) bool {
+			return other == pc
+		})
+		if len(list) == 0 {
+			delete(sshPool.clients, pc.key)
+		} else {
+			sshPool.clients[pc.key] = list
+		}
+	}
+	return pc.sessions == 0
+}
+
+func evictPooledSSHClient(pc *pooledSSHClient) {
+	sshPool.Lock()
+	closeNow := retirePooledSSHClient(pc)
+	sshPool.Unlock()
+
+	if closeNow {
+		pc.client.Close()
+	}
+}
+
+// evictSSHClients retires the pooled clients of a connection, including those
+// that use it as a jump host, e.g. after its credentials changed. Sessions
+// already running on them are left alone.
+func evictSSHClients(userID, connectionID int64) {
+	evictSSHClientsWhere(func(pc *pooledSSHClient) bool {
+		return pc.key.userID == userID && (pc.key.connectionID == connectionID || slices.Contains(pc.jumps, connectionID))
+	})
+}
+
+// evictUserSSHClients retires every pooled client of the user.
+func evictUserSSHClients(userID int64) {
+	evictSSHClientsWhere(func(pc *pooledSSHClient) bool {
+		return pc.key.userID == userID
+	})
+}
+
+func evictSSHClientsWhere(match func(*pooledSSHClient) bool) {
+	sshPool.Lock()
+	var matched []*pooledSSHClient
+	for _, list := range sshPool.clients {
+		for _, pc := range list {
+			if match(pc) {
+				matched = append(matched, pc)
+			}
+		}
+	}
+	sshPool.Unlock()
+
+	for _, pc := range matched {
+		evictPooledSSHClient(pc)
+	}
+}
+
+// sweepSSHPool closes clients that stayed idle too long and health-checks
+// the others.
+func sweepSSHPool() {
+	ticker := time.NewTicker(sshPoolCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var expired, idle []*pooledSSHClient
+		sshPool.Lock()
+		for _, list := range sshPool.clients {
+			for _, pc := range list {
+				if pc.sessions > 0 {
+					continue
+				}
+				if time.Since(pc.idleSince) >= sshPoolIdleTimeout {
+					expired = append(expired, pc)
+				} else {
+					idle = append(idle, pc)
+				}
+			}
+		}
+		sshPool.Unlock()
+
+		for _, pc := range expired {
+			evictPooledSSHClient(pc)
+		}
+		for _, pc := range idle {
+			go func() {
+				if err := pingSSHClient(pc.client); err != nil {
+					log.Printf("Pooled SSH client for connection %d failed its health check: %v", pc.key.connectionID, err)
+					evictPooledSSHClient(pc)
+				}
+			}()
+		}
+	}
+}
+
+// pingSSHClient sends an OpenSSH keepalive. Servers that do not know the
+// request still answer it, which is all that is checked.
+func pingSSHClient(client *ssh.Client) error {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(sshKeepaliveTimeout):
+		return errors.New("keepalive timed out")
+	}
+}
+
+// sshClientFingerprint identifies the settings a client was dialed with, so
+// changes made through templates are noticed too.
+func sshClientFingerprint(conn *models.SSHConnection) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s\x00", conn.Host, conn.Port, conn.Username, conn.AuthType)
+	for _, secret := range []*string{conn.PasswordEncrypted, conn.PrivateKeyEncrypted} {
+		if secret != nil {
+			h.Write([]byte(*secret))
+		}
+		h.Write([]byte{0})
+	}
+	if conn.JumpConnectionID != nil {
+		fmt.Fprintf(h, "%d", *conn.JumpConnectionID)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
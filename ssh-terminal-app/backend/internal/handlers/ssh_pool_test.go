@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestTakePooledSSHClientRetiresStaleClients checks that clients dialed with
+// old settings are retired while the pool list is walked, wherever they are
+// in it.
+func TestTakePooledSSHClientRetiresStaleClients(t *testing.T) {
+	key := sshPoolKey{userID: -1, connectionID: -1}
+	t.Cleanup(func() {
+		sshPool.Lock()
+		delete(sshPool.clients, key)
+		sshPool.Unlock()
+	})
+
+	tests := []struct {
+		name   string
+		stale  int // stale clients ahead of the current one
+		behind int // stale clients after the current one
+	}{
+		{name: "first of two", stale: 1},
+		{name: "two ahead", stale: 2},
+		{name: "ahead and behind", stale: 1, behind: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Stale clients are busy, so they are retired without being closed.
+			newStale := func() *pooledSSHClient {
+				return &pooledSSHClient{key: key, fingerprint: "old", sessions: 1}
+			}
+			current := &pooledSSHClient{key: key, fingerprint: "new", idleSince: time.Now()}
+			var list, ahead, behind []*pooledSSHClient
+			for range tt.stale {
+				ahead = append(ahead, newStale())
+			}
+			for range tt.behind {
+				behind = append(behind, newStale())
+			}
+			list = append(append(append(list, ahead...), current), behind...)
+
+			sshPool.Lock()
+			sshPool.clients[key] = list
+			sshPool.Unlock()
+
+			pc, _ := takePooledSSHClient(key, "new")
+			if pc != current {
+				t.Fatalf("takePooledSSHClient = %p, want the current client %p", pc, current)
+			}
+			if current.sessions != 1 {
+				t.Errorf("current client has %d sessions, want 1", current.sessions)
+			}
+			for i, pc := range ahead {
+				if !pc.evicted {
+					t.Errorf("stale client %d was not retired", i)
+				}
+			}
+
+			sshPool.Lock()
+			got := slices.Clone(sshPool.clients[key])
+			sshPool.Unlock()
+			if want := append([]*pooledSSHClient{current}, behind...); !slices.Equal(got, want) {
+				t.Errorf("pool holds %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetTemplates(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	templates, err := models.GetSSHTemplatesByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+
+	response := []models.SSHTemplateResponse{}
+	for _, t := range templates {
+		count, err := models.CountTemplateConnections(t.ID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+			return
+		}
+		response = append(response, t.ToResponse(count))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": response})
+}
+
+func GetTemplate(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	template, err := models.GetSSHTemplateByID(templateID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	count, err := models.CountTemplateConnections(template.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template": template.ToResponse(count)})
+}
+
+func CreateTemplate(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	var input models.SSHTemplateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := models.CreateSSHTemplate(userID, input)
+	if errors.Is(err, models.ErrInvalidInput) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create template: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Template created successfully",
+		"template": template.ToResponse(0),
+	})
+}
+
+func UpdateTemplate(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	var input models.SSHTemplateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := models.UpdateSSHTemplate(templateID, userID, input)
+	if err == models.ErrTemplateNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidInput) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template: " + err.Error()})
+		return
+	}
+
+	count, err := models.CountTemplateConnections(template.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Template updated successfully",
+		"template": template.ToResponse(count),
+	})
+}
+
+func DeleteTemplate(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	err = models.DeleteSSHTemplate(templateID, userID)
+	if err == models.ErrTemplateInUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Template is used by one or more connections"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"ssh-terminal-app/internal/ratelimit"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
+)
+
+// maxMuxChannels caps the terminals open on one multiplexed WebSocket.
+const maxMuxChannels = 32
+
+// muxClient is an SSH client shared by channels of a multiplexed WebSocket.
+// It is released when the last channel using it ends.
+type muxClient struct {
+	client     *ssh.Client
+	connection *models.SSHConnection
+	refs       int
+	// release returns the client to the pool.
+	release func()
+}
+
+type muxChannel struct {
+	terminal *terminalSession
+	// client is set while the channel holds a connected SSH client.
+	client *muxClient
+}
+
+// terminalMux runs the channels of one multiplexed WebSocket.
+type terminalMux struct {
+	userID int64
+	conn   *terminalConn
+
+	mu       sync.Mutex
+	channels map[uint32]*muxChannel
+	wg       sync.WaitGroup
+}
+
+// HandleWebSocketMux carries several terminals over one WebSocket. Each
+// channel is opened, fed and closed on its own; closing one leaves the others
+// and the socket open.
+func HandleWebSocketMux(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer ws.Close()
+
+	log.Printf("Multiplexed WebSocket connected for user ID: %d", userID)
+
+	term := newTerminalConn(ws, true)
+	defer term.Close(websocket.CloseNormalClosure, "")
+
+	mux := &terminalMux{userID: userID, conn: term, channels: map[uint32]*muxChannel{}}
+	defer mux.closeAll()
+
+	for {
+		msg, err := term.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			return
+		}
+		mux.handle(msg)
+	}
+}
+
+func (m *terminalMux) handle(msg terminalMessage) {
+	switch msg.Type {
+	case "open":
+		m.open(msg.Channel, msg.openRequest)
+		return
+	case "ping":
+		if msg.Channel == 0 {
+			m.conn.channel(0).Pong(msg.Data)
+			return
+		}
+	}
+
+	m.mu.Lock()
+	ch := m.channels[msg.Channel]
+	m.mu.Unlock()
+	if ch == nil {
+		return
+	}
+
+	if msg.Type == "close" {
+		ch.terminal.Stop()
+		return
+	}
+	ch.terminal.handle(msg)
+}
+
+// open starts a terminal on channel id, either on a new SSH connection or on
+// the SSH client of another open channel.
+func (m *terminalMux) open(id uint32, req openRequest) {
+	channel := m.conn.channel(id)
+	reject := func(message string) {
+		channel.Error(message)
+		channel.Closed()
+	}
+
+	if id == 0 {
+		channel.Error("Channel ID 0 is reserved")
+		return
+	}
+	if err := req.Terminal.Validate(); err != nil {
+		reject(err.Error())
+		return
+	}
+
+	ch := &muxChannel{}
+	var connection *models.SSHConnection
+	var dial sshDialer
+	// shared is the other channel's client until the terminal dials it
+	var shared *muxClient
+
+	if req.Share == 0 {
+		if ok, _ := ratelimit.Allow("connect:user:"+strconv.FormatInt(m.userID, 10), ratelimit.ConnectUser); !ok {
+			reject("Too many requests, please try again later")
+			return
+		}
+		var err error
+		connection, err = models.GetSSHConnectionByID(req.ConnectionID, m.userID)
+		if err != nil {
+			reject("Connection not found")
+			return
+		}
+		dial = m.dialer(ch, connection)
+	}
+
+	m.mu.Lock()
+	if _, exists := m.channels[id]; exists {
+		m.mu.Unlock()
+		channel.Error(fmt.Sprintf("Channel %d is already open", id))
+		return
+	}
+	if len(m.channels) >= maxMuxChannels {
+		m.mu.Unlock()
+		reject("Too many open channels")
+		return
+	}
+	if req.Share != 0 {
+		other := m.channels[req.Share]
+		// A client whose last reference is gone is on its way back to the
+		// pool and may already be closed.
+		if other == nil || other.client == nil || other.client.refs == 0 {
+			m.mu.Unlock()
+			reject(fmt.Sprintf("Channel %d has no open SSH connection", req.Share))
+			return
+		}
+		shared = other.client
+		shared.refs++
+		ch.client = shared
+		connection = shared.connection
+		// A reconnect dials a client of its own
+		redial := m.dialer(ch, connection)
+		dial = func() (*ssh.Client, func(), error) {
+			if shared == nil {
+				return redial()
+			}
+			first := shared
+			shared = nil
+			return first.client, func() { m.release(ch, first) }, nil
+		}
+	}
+	ch.terminal = newTerminalSession(m.userID, connection, req.Terminal, channel)
+	m.channels[id] = ch
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ch.terminal.run(dial)
+		// A terminal refused before it dialed still holds the shared client
+		if shared != nil {
+			m.release(ch, shared)
+		}
+
+		m.mu.Lock()
+		delete(m.channels, id)
+		m.mu.Unlock()
+		channel.Closed()
+	}()
+}
+
+// dialer connects a channel on an SSH client that other channels can share.
+func (m *terminalMux) dialer(ch *muxChannel, connection *models.SSHConnection) sshDialer {
+	return func() (*ssh.Client, func(), error) {
+		client, release, err := acquireSSHClient(connection)
+		if err != nil {
+			return nil, nil, err
+		}
+		shared := &muxClient{client: client, connection: connection, refs: 1, release: release}
+		m.mu.Lock()
+		ch.client = shared
+		m.mu.Unlock()
+		return client, func() { m.release(ch, shared) }, nil
+	}
+}
+
+// release drops the channel's reference to the client, so other channels can
+// no longer share it through this one.
+func (m *terminalMux) release(ch *muxChannel, shared *muxClient) {
+	m.mu.Lock()
+	if ch.client == shared {
+		ch.client = nil
+	}
+	shared.refs--
+	last := shared.refs == 0
+	m.mu.Unlock()
+	if last {
+		shared.release()
+	}
+}
+
+// closeAll stops every channel and waits until they have shut down.
+func (m *terminalMux) closeAll() {
+	m.mu.Lock()
+	for _, ch := range m.channels {
+		ch.terminal.Stop()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// outputCoalesceWindow is how long output is collected before it is sent,
+	// so a flood of small reads goes out as a few large frames.
+	outputCoalesceWindow = 8 * time.Millisecond
+	maxOutputFrame       = 32 * 1024
+	// outputWindow caps the bytes sent but not yet acknowledged by clients
+	// that send ACKs.
+	outputWindow = 256 * 1024
+	// outputBufferLimit is how much output is held back before reading from
+	// the SSH channel pauses.
+	outputBufferLimit = 1024 * 1024
+	// outputStallTimeout drops the held back output of a client that stopped
+	// acknowledging, so a stuck browser cannot wedge the remote program.
+	outputStallTimeout = 30 * time.Second
+)
+
+var errOutputClosed = errors.New("terminal output closed")
+
+// outputPipeline carries SSH output to the client. Reads are coalesced into
+// frames of up to maxOutputFrame bytes. Once the client sends its first ACK,
+// at most outputWindow bytes are in flight; the rest waits in the buffer, and
+// the SSH channel is no longer read while the buffer is full. Pause and drop
+// state changes are reported to the client.
+type outputPipeline struct {
+	channel terminalChannel
+
+	mu           sync.Mutex
+	space        *sync.Cond
+	pending      []byte
+	pendingSince time.Time
+	inFlight     int
+	acking       bool
+	lastAck      time.Time
+	paused       bool
+	dropped      int64
+	closed       bool
+
+	reportedPaused  bool
+	reportedDropped int64
+
+	notify   chan struct{}
+	finished chan struct{}
+}
+
+func newOutputPipeline(channel terminalChannel) *outputPipeline {
+	p := &outputPipeline{
+		channel:  channel,
+		notify:   make(chan struct{}, 1),
+		finished: make(chan struct{}),
+	}
+	p.space = sync.NewCond(&p.mu)
+	go p.run()
+	return p
+}
+
+func (p *outputPipeline) wake() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// write queues output, blocking while the buffer is full.
+func (p *outputPipeline) write(data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !p.closed && len(p.pending) >= outputBufferLimit {
+		if !p.paused {
+			p.paused = true
+			p.wake()
+		}
+		p.space.Wait()
+	}
+	if p.closed {
+		return errOutputClosed
+	}
+
+	if len(p.pending) == 0 {
+		p.pendingSince = time.Now()
+	}
+	p.pending = append(p.pending, data...)
+	p.wake()
+	return nil
+}
+
+// Ack releases bytes the client has received.
+func (p *outputPipeline) Ack(n int) {
+	if n <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.inFlight = max(p.inFlight-n, 0)
+	p.acking = true
+	p.lastAck = time.Now()
+	p.mu.Unlock()
+	p.wake()
+}
+
+// Close stops accepting output and waits until what is buffered has been
+// sent or the client is gone.
+func (p *outputPipeline) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.space.Broadcast()
+	p.mu.Unlock()
+	p.wake()
+	<-p.finished
+}
+
+// Abort stops the pipeline and discards what is buffered.
+func (p *outputPipeline) Abort() {
+	p.mu.Lock()
+	p.closed = true
+	p.pending = nil
+	p.space.Broadcast()
+	p.mu.Unlock()
+	p.wake()
+	<-p.finished
+}
+
+func (p *outputPipeline) run() {
+	defer close(p.finished)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		report, frame, wait, done := p.next()
+		if done {
+			return
+		}
+
+		var err error
+		switch {
+		case report:
+			err = p.channel.Flow(p.reportedPaused, p.reportedDropped)
+		case frame != nil:
+			err = p.channel.Output(frame)
+		default:
+			var timeout <-chan time.Time
+			if wait > 0 {
+				timer.Reset(wait)
+				timeout = timer.C
+			}
+			select {
+			case <-p.notify:
+			case <-timeout:
+			}
+			timer.Stop()
+		}
+
+		if err != nil {
+			p.mu.Lock()
+			p.closed = true
+			p.pending = nil
+			p.space.Broadcast()
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// next decides what run does: report the flow state, send a frame, or wait
+// up to wait (forever if zero) for something to change.
+func (p *outputPipeline) next() (report bool, frame []byte, wait time.Duration, done bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused != p.reportedPaused || p.dropped != p.reportedDropped {
+		p.reportedPaused, p.reportedDropped = p.paused, p.dropped
+		return true, nil, 0, false
+	}
+	if len(p.pending) == 0 {
+		return false, nil, 0, p.closed
+	}
+
+	n := min(len(p.pending), maxOutputFrame)
+	if !p.closed {
+		if age := time.Since(p.pendingSince); len(p.pending) < maxOutputFrame && age < outputCoalesceWindow {
+			return false, nil, outputCoalesceWindow - age, false
+		}
+
+		if p.acking {
+			if p.inFlight >= outputWindow {
+				if stalled := time.Since(p.lastAck); stalled < outputStallTimeout {
+					return false, nil, outputStallTimeout - stalled, false
+				}
+				p.dropPending()
+				return false, nil, 0, false
+			}
+			n = min(n, outputWindow-p.inFlight)
+		}
+	}
+
+	// JSON clients get strings, so frames end on a rune boundary. Readers only
+	// queue whole runes, which makes the end of the buffer one.
+	if !p.channel.conn.binary && n < len(p.pending) {
+		n -= incompleteUTF8(p.pending[:n])
+		if n == 0 {
+			return false, nil, 0, false
+		}
+	}
+
+	frame = make([]byte, n)
+	copy(frame, p.pending)
+	p.pending = p.pending[n:]
+	p.inFlight += n
+	p.pendingSince = time.Now()
+	p.resume()
+	return false, frame, 0, false
+}
+
+// dropPending discards the buffered output of a stalled client.
+func (p *outputPipeline) dropPending() {
+	p.dropped += int64(len(p.pending))
+	p.pending = nil
+	p.resume()
+}
+
+func (p *outputPipeline) resume() {
+	if len(p.pending) < outputBufferLimit {
+		p.paused = false
+		p.space.Broadcast()
+	}
+}
+
+// pump copies r into the pipeline until r fails. JSON frames hold strings,
+// so a UTF-8 sequence split across reads is held back until it is complete.
+func (p *outputPipeline) pump(r io.Reader) error {
+	buf := make([]byte, maxOutputFrame)
+	pending := 0
+	for {
+		n, err := r.Read(buf[pending:])
+		n += pending
+		pending = 0
+		if n > 0 {
+			if !p.channel.conn.binary && err == nil {
+				pending = incompleteUTF8(buf[:n])
+			}
+			if n > pending {
+				if werr := p.write(buf[:n-pending]); werr != nil {
+					return werr
+				}
+				copy(buf, buf[n-pending:n])
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// incompleteUTF8 returns the length of the UTF-8 sequence that p ends in the
+// middle of, or 0 if p ends on a rune boundary.
+func incompleteUTF8(p []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(p); i++ {
+		if utf8.RuneStart(p[len(p)-i]) {
+			if utf8.FullRune(p[len(p)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// newTestOutputPipeline returns a pipeline writing binary frames to a
+// connection without a socket, whose queued frames the test reads.
+func newTestOutputPipeline(t *testing.T) (*outputPipeline, *terminalConn) {
+	conn := &terminalConn{
+		binary:  true,
+		out:     make(chan outgoingFrame, terminalSendQueue),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	p := newOutputPipeline(conn.channel(0))
+	t.Cleanup(func() {
+		close(conn.stop)
+		p.Abort()
+	})
+	return p, conn
+}
+
+// receiveOutput returns the payload of the next output frame, or false if
+// none is sent within timeout.
+func receiveOutput(t *testing.T, conn *terminalConn, timeout time.Duration) ([]byte, bool) {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case frame := <-conn.out:
+			if frame.data[0] == frameData {
+				return frame.data[1:], true
+			}
+		case <-deadline:
+			return nil, false
+		}
+	}
+}
+
+// receiveOutputBytes reads output frames until n bytes have arrived.
+func receiveOutputBytes(t *testing.T, conn *terminalConn, n int) [][]byte {
+	t.Helper()
+	var frames [][]byte
+	for received := 0; received < n; {
+		frame, ok := receiveOutput(t, conn, time.Second)
+		if !ok {
+			t.Fatalf("received %d of %d bytes", received, n)
+		}
+		frames = append(frames, frame)
+		received += len(frame)
+	}
+	return frames
+}
+
+func TestOutputPipelineCoalescesWrites(t *testing.T) {
+	p, conn := newTestOutputPipeline(t)
+
+	var want []byte
+	for i := 0; i < 100; i++ {
+		chunk := bytes.Repeat([]byte{byte('a' + i%26)}, 10)
+		want = append(want, chunk...)
+		if err := p.write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	frames := receiveOutputBytes(t, conn, len(want))
+	if len(frames) >= 10 {
+		t.Errorf("100 small writes went out as %d frames", len(frames))
+	}
+	if got := bytes.Join(frames, nil); !bytes.Equal(got, want) {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestOutputPipelineSplitsLargeWrites(t *testing.T) {
+	p, conn := newTestOutputPipeline(t)
+
+	want := bytes.Repeat([]byte("x"), 3*maxOutputFrame+100)
+	if err := p.write(want); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := receiveOutputBytes(t, conn, len(want))
+	for i, frame := range frames {
+		if len(frame) > maxOutputFrame {
+			t.Errorf("frame %d has %d bytes, more than %d", i, len(frame), maxOutputFrame)
+		}
+	}
+	if got := bytes.Join(frames, nil); !bytes.Equal(got, want) {
+		t.Errorf("output differs from input: got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestOutputPipelineAckWindow(t *testing.T) {
+	p, conn := newTestOutputPipeline(t)
+
+	// Without ACKs nothing holds output back.
+	if err := p.write(bytes.Repeat([]byte("a"), outputWindow+maxOutputFrame)); err != nil {
+		t.Fatal(err)
+	}
+	receiveOutputBytes(t, conn, outputWindow+maxOutputFrame)
+
+	// The first ACK turns on the window, with the earlier output released.
+	p.Ack(outputWindow + maxOutputFrame)
+	extra := 2 * maxOutputFrame
+	if err := p.write(bytes.Repeat([]byte("b"), outputWindow+extra)); err != nil {
+		t.Fatal(err)
+	}
+	frames := receiveOutputBytes(t, conn, outputWindow)
+	if got := len(bytes.Join(frames, nil)); got != outputWindow {
+		t.Fatalf("sent %d bytes before an ACK, want %d", got, outputWindow)
+	}
+	if frame, ok := receiveOutput(t, conn, 50*time.Millisecond); ok {
+		t.Fatalf("sent %d bytes beyond the window", len(frame))
+	}
+
+	p.Ack(extra)
+	frames = receiveOutputBytes(t, conn, extra)
+	if got := len(bytes.Join(frames, nil)); got != extra {
+		t.Errorf("sent %d bytes after the ACK, want %d", got, extra)
+	}
+	if frame, ok := receiveOutput(t, conn, 50*time.Millisecond); ok {
+		t.Errorf("sent %d bytes more than was written", len(frame))
+	}
+}
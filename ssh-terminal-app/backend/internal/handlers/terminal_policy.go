@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"ssh-terminal-app/internal/models"
+	"time"
+)
+
+// policyCheckInterval is how often a terminal's session policy is checked.
+const policyCheckInterval = time.Second
+
+// touch records input or output on the terminal.
+func (s *terminalSession) touch() {
+	s.activity.Store(time.Now().UnixNano())
+}
+
+func (s *terminalSession) idleSince() time.Time {
+	return time.Unix(0, s.activity.Load())
+}
+
+// terminate ends the session with a reason that is sent to the client and
+// recorded in the session history.
+func (s *terminalSession) terminate(reason string) {
+	s.mu.Lock()
+	s.endReason = reason
+	s.mu.Unlock()
+	s.channel.Error(reason)
+	s.Stop()
+}
+
+// enforcePolicy terminates the session once it has been idle, with neither
+// input nor output, or open for longer than the policy allows. The user is
+// warned ahead of either; an idle warning is given again after new activity.
+func (s *terminalSession) enforcePolicy(policy models.SessionPolicy) {
+	idleTimeout := time.Duration(policy.IdleTimeout) * time.Second
+	maxDuration := time.Duration(policy.MaxSessionDuration) * time.Second
+	if idleTimeout == 0 && maxDuration == 0 {
+		return
+	}
+	warning := time.Duration(policy.Warning) * time.Second
+
+	started := time.Now()
+	idleWarned, durationWarned := false, false
+
+	ticker := time.NewTicker(policyCheckInterval)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-s.stop:
+			return
+		case now = <-ticker.C:
+		}
+
+		if maxDuration > 0 {
+			left := maxDuration - now.Sub(started)
+			if left <= 0 {
+				log.Printf("Closing terminal of user %d on connection %d: maximum session duration reached", s.userID, s.connection.ID)
+				s.terminate(fmt.Sprintf("Session closed: maximum session duration of %v reached", maxDuration))
+				return
+			}
+			if !durationWarned && left <= warningBefore(maxDuration, warning) {
+				durationWarned = true
+				s.channel.Status(fmt.Sprintf("Session will be closed in %v: maximum session duration of %v", left.Round(time.Second), maxDuration))
+			}
+		}
+
+		if idleTimeout > 0 {
+			left := idleTimeout - now.Sub(s.idleSince())
+			if left <= 0 {
+				log.Printf("Closing idle terminal of user %d on connection %d", s.userID, s.connection.ID)
+				s.terminate(fmt.Sprintf("Session closed after %v of inactivity", idleTimeout))
+				return
+			}
+			if left > warningBefore(idleTimeout, warning) {
+				idleWarned = false
+			} else if !idleWarned {
+				idleWarned = true
+				s.channel.Status(fmt.Sprintf("Session will be closed in %v unless there is activity", left.Round(time.Second)))
+			}
+		}
+	}
+}
+
+// warningBefore returns how long before a limit to warn: the configured
+// warning, but at most half the limit so that short limits are not warned
+// about from the start.
+func warningBefore(limit, warning time.Duration) time.Duration {
+	return min(warning, limit/2)
+}
+
+// activityReader records the output read through it as terminal activity.
+type activityReader struct {
+	r io.Reader
+	s *terminalSession
+}
+
+func (a activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.s.touch()
+	}
+	return n, err
+}
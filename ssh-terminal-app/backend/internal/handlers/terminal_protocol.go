@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"ssh-terminal-app/internal/models"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// terminalBinaryProtocol is the WebSocket subprotocol for binary terminal
+// frames. Clients that do not request it get the JSON protocol.
+//
+// Every binary frame starts with a one byte type. Data frames carry raw
+// terminal bytes in both directions, status and error frames carry UTF-8
+// text, resize frames carry the columns and rows as big-endian uint16s, and
+// ping frames are answered with a pong frame echoing their payload. Clients
+// acknowledge received output with ack frames holding the byte count as a
+// big-endian uint32, and flow frames report whether output is paused (one
+// byte) and how many bytes were dropped so far (big-endian uint64). JSON
+// clients acknowledge with {"type":"ack","bytes":n}, counting the UTF-8
+// bytes of the output data.
+//
+// On the multiplexed endpoint the type byte is followed by the channel ID as a
+// big-endian uint32, and JSON messages carry a "channel" field. Clients pick
+// channel IDs from 1 up. Open frames carry a JSON payload, either
+// {"connection_id":n} for a new SSH connection or {"share":id} for another
+// shell on the SSH client of an open channel, optionally with a "terminal"
+// object overriding the connection's terminal settings (term, cols, rows,
+// modes, env, command, cwd); close frames end a channel and are also sent by
+// the server once a channel has ended.
+const terminalBinaryProtocol = "ssh-terminal.binary.v1"
+
+const (
+	frameData byte = iota
+	frameResize
+	frameStatus
+	frameError
+	framePing
+	framePong
+	frameAck
+	frameFlow
+	frameOpen
+	frameClose
+)
+
+const (
+	terminalWriteWait = 10 * time.Second
+	// terminalPongWait is how long a client may stay silent, pongs included,
+	// before it is considered gone.
+	terminalPongWait   = 60 * time.Second
+	terminalPingPeriod = terminalPongWait * 9 / 10
+	terminalSendQueue  = 16
+)
+
+var errTerminalClosed = errors.New("terminal connection closed")
+
+// terminalMessage is a decoded client message of either protocol.
+type terminalMessage struct {
+	Type    string
+	Channel uint32
+	Data    []byte
+	Cols    int
+	Rows    int
+	// Bytes is the amount of output an ack acknowledges.
+	Bytes int
+	openRequest
+}
+
+// openRequest is the payload of a multiplexed open message.
+type openRequest struct {
+	ConnectionID int64                  `json:"connection_id"`
+	Share        uint32                 `json:"share"`
+	Terminal     models.TerminalOptions `json:"terminal"`
+}
+
+// terminalConn speaks the terminal protocol the client negotiated. All writes
+// go through a single writer goroutine, which also pings the client; a client
+// that misses its pongs fails the next ReadMessage.
+type terminalConn struct {
+	ws     *websocket.Conn
+	binary bool
+	mux    bool
+
+	out       chan outgoingFrame
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+	closeMsg  []byte
+}
+
+type outgoingFrame struct {
+	messageType int
+	data        []byte
+}
+
+// newTerminalConn starts the writer of a terminal connection. mux selects the
+// framing of the multiplexed endpoint.
+func newTerminalConn(ws *websocket.Conn, mux bool) *terminalConn {
+	t := &terminalConn{
+		ws:      ws,
+		binary:  ws.Subprotocol() == terminalBinaryProtocol,
+		mux:     mux,
+		out:     make(chan outgoingFrame, terminalSendQueue),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	ws.SetReadDeadline(time.Now().Add(terminalPongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(terminalPongWait))
+	})
+
+	go t.writeLoop()
+	return t
+}
+
+func (t *terminalConn) writeLoop() {
+	defer close(t.stopped)
+
+	ping := time.NewTicker(terminalPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case frame := <-t.out:
+			t.ws.SetWriteDeadline(time.Now().Add(terminalWriteWait))
+			if err := t.ws.WriteMessage(frame.messageType, frame.data); err != nil {
+				t.ws.Close()
+				return
+			}
+		case <-ping.C:
+			if err := t.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(terminalWriteWait)); err != nil {
+				t.ws.Close()
+				return
+			}
+		case <-t.stop:
+			// Frames queued before Close still go out, ahead of the close frame
+			deadline := time.Now().Add(terminalWriteWait)
+			t.ws.SetWriteDeadline(deadline)
+		drain:
+			for {
+				select {
+				case frame := <-t.out:
+					if err := t.ws.WriteMessage(frame.messageType, frame.data); err != nil {
+						return
+					}
+				default:
+					break drain
+				}
+			}
+			t.ws.WriteControl(websocket.CloseMessage, t.closeMsg, deadline)
+			return
+		}
+	}
+}
+
+// send queues a frame, blocking while the queue is full. It fails once the
+// connection is closing or the client is gone.
+func (t *terminalConn) send(messageType int, data []byte) error {
+	select {
+	case <-t.stop:
+		return errTerminalClosed
+	default:
+	}
+
+	select {
+	case t.out <- outgoingFrame{messageType, data}:
+		return nil
+	case <-t.stop:
+		return errTerminalClosed
+	case <-t.stopped:
+		return errTerminalClosed
+	}
+}
+
+// Close sends what is queued and a close frame, then closes the connection.
+// Only the first call's code and reason are used.
+func (t *terminalConn) Close(code int, reason string) {
+	t.closeOnce.Do(func() {
+		t.closeMsg = websocket.FormatCloseMessage(code, reason)
+		close(t.stop)
+	})
+	<-t.stopped
+	t.ws.Close()
+}
+
+// writeFrame sends a binary frame, or msg to JSON clients.
+func (t *terminalConn) writeFrame(channel uint32, frameType byte, payload []byte, msg map[string]any) error {
+	if !t.binary {
+		if t.mux {
+			msg["channel"] = channel
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return t.send(websocket.TextMessage, data)
+	}
+
+	header := 1
+	if t.mux {
+		header += 4
+	}
+	frame := make([]byte, header+len(payload))
+	frame[0] = frameType
+	if t.mux {
+		binary.BigEndian.PutUint32(frame[1:5], channel)
+	}
+	copy(frame[header:], payload)
+	return t.send(websocket.BinaryMessage, frame)
+}
+
+// channel returns the terminal with the given ID. Connections that are not
+// multiplexed only have channel 0.
+func (t *terminalConn) channel(id uint32) terminalChannel {
+	return terminalChannel{conn: t, id: id}
+}
+
+// ReadMessage returns the next client message. Malformed binary frames are
+// skipped; messages of unknown type are returned for the caller to ignore.
+func (t *terminalConn) ReadMessage() (terminalMessage, error) {
+	if !t.binary {
+		var msg struct {
+			Type    string `json:"type"`
+			Channel uint32 `json:"channel"`
+			Data    string `json:"data"`
+			Cols    int    `json:"cols"`
+			Rows    int    `json:"rows"`
+			Bytes   int    `json:"bytes"`
+			openRequest
+		}
+		if err := t.ws.ReadJSON(&msg); err != nil {
+			return terminalMessage{}, err
+		}
+		return terminalMessage{
+			Type:        msg.Type,
+			Channel:     msg.Channel,
+			Data:        []byte(msg.Data),
+			Cols:        msg.Cols,
+			Rows:        msg.Rows,
+			Bytes:       msg.Bytes,
+			openRequest: msg.openRequest,
+		}, nil
+	}
+
+	header := 1
+	if t.mux {
+		header += 4
+	}
+	for {
+		messageType, frame, err := t.ws.ReadMessage()
+		if err != nil {
+			return terminalMessage{}, err
+		}
+		if messageType != websocket.BinaryMessage || len(frame) < header {
+			continue
+		}
+
+		msg := terminalMessage{Data: frame[header:]}
+		if t.mux {
+			msg.Channel = binary.BigEndian.Uint32(frame[1:5])
+		}
+		payload := msg.Data
+		switch frame[0] {
+		case frameData:
+			msg.Type = "input"
+		case frameResize:
+			if len(payload) != 4 {
+				continue
+			}
+			msg.Type = "resize"
+			msg.Cols = int(binary.BigEndian.Uint16(payload[0:2]))
+			msg.Rows = int(binary.BigEndian.Uint16(payload[2:4]))
+		case framePing:
+			msg.Type = "ping"
+		case frameAck:
+			if len(payload) != 4 {
+				continue
+			}
+			msg.Type = "ack"
+			msg.Bytes = int(binary.BigEndian.Uint32(payload))
+		case frameOpen:
+			if json.Unmarshal(payload, &msg.openRequest) != nil {
+				continue
+			}
+			msg.Type = "open"
+		case frameClose:
+			msg.Type = "close"
+		default:
+			msg.Type = "unknown"
+		}
+		return msg, nil
+	}
+}
+
+// terminalChannel is one terminal on a terminal connection.
+type terminalChannel struct {
+	conn *terminalConn
+	id   uint32
+}
+
+func (c terminalChannel) Output(data []byte) error {
+	return c.conn.writeFrame(c.id, frameData, data, map[string]any{"type": "output", "data": string(data)})
+}
+
+func (c terminalChannel) Status(message string) error {
+	return c.conn.writeFrame(c.id, frameStatus, []byte(message), map[string]any{"type": "status", "message": message})
+}
+
+func (c terminalChannel) Error(message string) error {
+	return c.conn.writeFrame(c.id, frameError, []byte(message), map[string]any{"type": "error", "message": message})
+}
+
+// Flow reports whether output is paused and how much was dropped so far.
+func (c terminalChannel) Flow(paused bool, dropped int64) error {
+	payload := make([]byte, 9)
+	if paused {
+		payload[0] = 1
+	}
+	binary.BigEndian.PutUint64(payload[1:], uint64(dropped))
+	return c.conn.writeFrame(c.id, frameFlow, payload, map[string]any{"type": "flow", "paused": paused, "dropped": dropped})
+}
+
+// Pong answers a client ping.
+func (c terminalChannel) Pong(payload []byte) error {
+	return c.conn.writeFrame(c.id, framePong, payload, map[string]any{"type": "pong", "data": string(payload)})
+}
+
+// Closed tells a multiplexing client that the channel has ended.
+func (c terminalChannel) Closed() error {
+	return c.conn.writeFrame(c.id, frameClose, nil, map[string]any{"type": "closed"})
+}
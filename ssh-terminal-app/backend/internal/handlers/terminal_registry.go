@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"ssh-terminal-app/internal/models"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits on open terminals, 0 sets none. A connection's own max_sessions
+// applies when it is stricter than maxTerminalsPerConnection.
+var (
+	maxTerminalsPerUser       = 0
+	maxTerminalsPerConnection = 0
+)
+
+// liveTerminal is an open terminal WebSocket. terminate ends it from outside
+// the handler, e.g. when an admin disables the account.
+type liveTerminal struct {
+	UserID         int64     `json:"user_id"`
+	ConnectionID   int64     `json:"connection_id"`
+	ConnectionName string    `json:"connection_name"`
+	Host           string    `json:"host"`
+	StartedAt      time.Time `json:"started_at"`
+	terminate      func(reason string)
+}
+
+var terminals = struct {
+	sync.Mutex
+	byUser map[int64]map[*liveTerminal]struct{}
+}{byUser: map[int64]map[*liveTerminal]struct{}{}}
+
+// InitTerminalLimits reads TERMINAL_MAX_PER_USER and
+// TERMINAL_MAX_PER_CONNECTION.
+func InitTerminalLimits() error {
+	for env, limit := range map[string]*int{
+		"TERMINAL_MAX_PER_USER":       &maxTerminalsPerUser,
+		"TERMINAL_MAX_PER_CONNECTION": &maxTerminalsPerConnection,
+	} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s: invalid count %q", env, v)
+		}
+		*limit = n
+	}
+	return nil
+}
+
+// connectionTerminalLimit returns how many terminals may be open on the
+// connection, 0 for no limit.
+func connectionTerminalLimit(conn *models.SSHConnection) int {
+	limit := maxTerminalsPerConnection
+	if conn.MaxSessions != nil && (limit == 0 || *conn.MaxSessions < limit) {
+		limit = *conn.MaxSessions
+	}
+	return limit
+}
+
+// checkTerminalLimitsLocked reports why the user may not open another
+// terminal on the connection, if so. terminals must be locked.
+func checkTerminalLimitsLocked(userID int64, conn *models.SSHConnection) error {
+	open := terminals.byUser[userID]
+	if maxTerminalsPerUser > 0 && len(open) >= maxTerminalsPerUser {
+		return fmt.Errorf("Too many open terminals: at most %d are allowed per user", maxTerminalsPerUser)
+	}
+
+	limit := connectionTerminalLimit(conn)
+	if limit == 0 {
+		return nil
+	}
+	onConnection := 0
+	for t := range open {
+		if t.ConnectionID == conn.ID {
+			onConnection++
+		}
+	}
+	if onConnection >= limit {
+		return fmt.Errorf("Too many open terminals on %s: at most %d are allowed", conn.Name, limit)
+	}
+	return nil
+}
+
+// checkTerminalLimits lets a handler refuse a terminal before it upgrades the
+// connection. registerTerminal checks again.
+func checkTerminalLimits(userID int64, conn *models.SSHConnection) error {
+	terminals.Lock()
+	defer terminals.Unlock()
+	return checkTerminalLimitsLocked(userID, conn)
+}
+
+// registerTerminal tracks a terminal until the returned function is called.
+// It fails when the terminal would exceed a limit.
+func registerTerminal(userID int64, conn *models.SSHConnection, terminate func(reason string)) (func(), error) {
+	t := &liveTerminal{
+		UserID:         userID,
+		ConnectionID:   conn.ID,
+		ConnectionName: conn.Name,
+		Host:           conn.Host,
+		StartedAt:      time.Now(),
+		terminate:      terminate,
+	}
+
+	terminals.Lock()
+	if err := checkTerminalLimitsLocked(userID, conn); err != nil {
+		terminals.Unlock()
+		return nil, err
+	}
+	if terminals.byUser[userID] == nil {
+		terminals.byUser[userID] = map[*liveTerminal]struct{}{}
+	}
+	terminals.byUser[userID][t] = struct{}{}
+	terminals.Unlock()
+
+	return func() {
+		terminals.Lock()
+		defer terminals.Unlock()
+		delete(terminals.byUser[userID], t)
+		if len(terminals.byUser[userID]) == 0 {
+			delete(terminals.byUser, userID)
+		}
+	}, nil
+}
+
+func userTerminals(userID int64) []*liveTerminal {
+	terminals.Lock()
+	defer terminals.Unlock()
+
+	list := []*liveTerminal{}
+	for t := range terminals.byUser[userID] {
+		list = append(list, t)
+	}
+	return list
+}
+
+func countUserTerminals(userID int64) int {
+	terminals.Lock()
+	defer terminals.Unlock()
+	return len(terminals.byUser[userID])
+}
+
+// terminalHolder is a user with open terminals and their count per
+// connection.
+type terminalHolder struct {
+	UserID      int64                 `json:"user_id"`
+	Email       string                `json:"email"`
+	Terminals   int                   `json:"terminals"`
+	Connections []connectionTerminals `json:"connections"`
+}
+
+type connectionTerminals struct {
+	ConnectionID   int64  `json:"connection_id"`
+	ConnectionName string `json:"connection_name"`
+	Host           string `json:"host"`
+	Terminals      int    `json:"terminals"`
+}
+
+// terminalHolders returns every user with open terminals, the most terminals
+// first. Emails are filled in by the caller.
+func terminalHolders() []terminalHolder {
+	terminals.Lock()
+	defer terminals.Unlock()
+
+	holders := []terminalHolder{}
+	for userID, open := range terminals.byUser {
+		h := terminalHolder{UserID: userID, Terminals: len(open)}
+		byConnection := map[int64]*connectionTerminals{}
+		for t := range open {
+			c := byConnection[t.ConnectionID]
+			if c == nil {
+				c = &connectionTerminals{ConnectionID: t.ConnectionID, ConnectionName: t.ConnectionName, Host: t.Host}
+				byConnection[t.ConnectionID] = c
+			}
+			c.Terminals++
+		}
+		for _, c := range byConnection {
+			h.Connections = append(h.Connections, *c)
+		}
+		slices.SortFunc(h.Connections, func(a, b connectionTerminals) int {
+			return b.Terminals - a.Terminals
+		})
+		holders = append(holders, h)
+	}
+	slices.SortFunc(holders, func(a, b terminalHolder) int {
+		return b.Terminals - a.Terminals
+	})
+	return holders
+}
+
+// terminateUserTerminals closes every open terminal of the user and returns
+// how many there were.
+func terminateUserTerminals(userID int64, reason string) int {
+	list := userTerminals(userID)
+	for _, t := range list {
+		t.terminate(reason)
+	}
+	return len(list)
+}
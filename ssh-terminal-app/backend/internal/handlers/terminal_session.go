@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"ssh-terminal-app/internal/models"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// terminalInputQueue is how many input messages wait for the remote
+	// shell before the client's reads block.
+	terminalInputQueue = 64
+
+	maxReconnectAttempts = 5
+	reconnectBackoff     = time.Second
+	maxReconnectBackoff  = 30 * time.Second
+)
+
+// sshDialer returns the SSH client a terminal runs on and a function that
+// releases it once the terminal is done.
+type sshDialer func() (*ssh.Client, func(), error)
+
+// terminalSession is an interactive shell on one SSH connection, streamed to
+// a terminal channel. Client messages are passed to handle, from any
+// goroutine, while run drives the session.
+type terminalSession struct {
+	userID     int64
+	connection *models.SSHConnection
+	channel    terminalChannel
+
+	options models.TerminalOptions
+
+	input    chan []byte
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// activity is the time of the last input or output, in Unix nanoseconds
+	activity atomic.Int64
+
+	mu         sync.Mutex
+	session    *ssh.Session
+	output     *outputPipeline
+	cols, rows int
+	// endReason is why the server ended the session, if it did
+	endReason string
+}
+
+// newTerminalSession prepares a terminal on the connection. options, from the
+// client's request, take precedence over the connection's terminal settings.
+func newTerminalSession(userID int64, connection *models.SSHConnection, options models.TerminalOptions, channel terminalChannel) *terminalSession {
+	return &terminalSession{
+		userID:     userID,
+		connection: connection,
+		channel:    channel,
+		options:    connection.TerminalOptions().Merge(options),
+		input:      make(chan []byte, terminalInputQueue),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Stop ends the session without a final status, e.g. when the client is gone.
+func (s *terminalSession) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// handle applies a client message. Input waits for the shell in a queue;
+// everything else takes effect right away so that ACKs keep flowing while the
+// shell is not reading its input.
+func (s *terminalSession) handle(msg terminalMessage) {
+	switch msg.Type {
+	case "input":
+		s.touch()
+		select {
+		case s.input <- msg.Data:
+		case <-s.stop:
+		}
+	case "resize":
+		if msg.Cols <= 0 || msg.Rows <= 0 {
+			return
+		}
+		s.mu.Lock()
+		s.cols, s.rows = msg.Cols, msg.Rows
+		session := s.session
+		s.mu.Unlock()
+		if session != nil {
+			session.WindowChange(msg.Rows, msg.Cols)
+		}
+	case "ack":
+		s.mu.Lock()
+		output := s.output
+		s.mu.Unlock()
+		if output != nil {
+			output.Ack(msg.Bytes)
+		}
+	case "ping":
+		s.channel.Pong(msg.Data)
+	}
+}
+
+// run connects and streams the shell until it exits or the session is
+// stopped. Connections with AutoReconnect are dialed again, with backoff,
+// when the SSH side drops; a failed first connection is not retried.
+func (s *terminalSession) run(dial sshDialer) {
+	// Input sent after the session is over is dropped instead of queued
+	defer s.Stop()
+
+	unregister, err := registerTerminal(s.userID, s.connection, func(reason string) {
+		s.terminate(reason)
+		s.channel.conn.Close(websocket.ClosePolicyViolation, reason)
+	})
+	if err != nil {
+		s.channel.Error(err.Error())
+		return
+	}
+	defer unregister()
+
+	policy, err := models.GetSessionPolicy(s.userID, s.connection)
+	if err != nil {
+		log.Printf("Failed to load session policy: %v", err)
+	}
+	s.touch()
+	go s.enforcePolicy(policy)
+
+	failures := 0
+	for attempt := 0; ; attempt++ {
+		connected, lost := s.attach(dial, attempt > 0)
+		if !lost || !s.connection.AutoReconnect || (attempt == 0 && !connected) {
+			return
+		}
+
+		if connected {
+			failures = 0
+		}
+		failures++
+		if failures > maxReconnectAttempts {
+			s.channel.Error(fmt.Sprintf("Reconnecting failed after %d attempts", maxReconnectAttempts))
+			return
+		}
+		delay := min(reconnectBackoff<<(failures-1), maxReconnectBackoff)
+		s.channel.Status(fmt.Sprintf("Connection lost, reconnecting in %v (attempt %d of %d)...", delay, failures, maxReconnectAttempts))
+
+		select {
+		case <-time.After(delay):
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// attach runs one SSH session. It reports whether the shell was started and
+// whether the session ended because the SSH connection was lost. Shutdown
+// runs in order: the remaining output and the final status are sent, then
+// the SSH session and client are closed.
+func (s *terminalSession) attach(dial sshDialer, reconnect bool) (connected, lost bool) {
+	connection := s.connection
+	verb := "Connecting"
+	if reconnect {
+		verb = "Reconnecting"
+	}
+	s.channel.Status(fmt.Sprintf("%s to %s@%s:%d...", verb, connection.Username, connection.Host, connection.Port))
+
+	sshSession, err := models.StartSSHSession(s.userID, connection.ID)
+	if err != nil {
+		log.Printf("Failed to record SSH session: %v", err)
+	}
+	var sessionErr string
+	defer func() {
+		if sshSession == nil {
+			return
+		}
+		if err := models.EndSSHSession(sshSession.ID, connected, sessionErr); err != nil {
+			log.Printf("Failed to finish SSH session: %v", err)
+		}
+	}()
+
+	fail := func(logPrefix, message string, err error) {
+		log.Printf("%s: %v", logPrefix, err)
+		sessionErr = fmt.Sprintf("%s: %v", message, err)
+		s.channel.Error(sessionErr)
+	}
+
+	client, release, err := dial()
+	if err != nil {
+		fail("SSH connection failed", "SSH connection failed", err)
+		return false, true
+	}
+	defer release()
+
+	keepalive, unwatch := watchSSHClient(client, connection)
+	defer unwatch()
+
+	// Stopped while connecting
+	select {
+	case <-s.stop:
+		return false, false
+	default:
+	}
+
+	if err := models.TouchSSHConnection(connection.ID, s.userID); err != nil {
+		log.Printf("Failed to record connection usage: %v", err)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		fail("SSH session failed", "Failed to create session", err)
+		return false, true
+	}
+	defer session.Close()
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	for name, value := range s.options.Modes {
+		modes[models.TerminalModes[name]] = value
+	}
+
+	termType := s.options.Term
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+
+	// The client's last resize wins over the requested initial size
+	s.mu.Lock()
+	cols, rows := s.cols, s.rows
+	s.mu.Unlock()
+	if cols == 0 {
+		cols, rows = s.options.Cols, s.options.Rows
+	}
+	if cols == 0 {
+		cols, rows = 80, 24
+	}
+
+	if err := session.RequestPty(termType, rows, cols, modes); err != nil {
+		fail("PTY request failed", "Failed to request PTY", err)
+		return false, false
+	}
+
+	// Servers only accept the variables their configuration allows
+	for _, name := range slices.Sorted(maps.Keys(s.options.Env)) {
+		if err := session.Setenv(name, s.options.Env[name]); err != nil {
+			log.Printf("Setenv %s refused: %v", name, err)
+			s.channel.Status(fmt.Sprintf("Server did not accept environment variable %s", name))
+		}
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		fail("Stdin pipe failed", "Failed to get stdin", err)
+		return false, false
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		fail("Stdout pipe failed", "Failed to get stdout", err)
+		return false, false
+	}
+
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		fail("Stderr pipe failed", "Failed to get stderr", err)
+		return false, false
+	}
+
+	if command := shellCommand(connection, s.options); command != "" {
+		err = session.Start(command)
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		fail("Shell start failed", "Failed to start shell", err)
+		return false, false
+	}
+
+	connected = true
+
+	if reconnect {
+		s.channel.Status("Reconnected!")
+	} else {
+		s.channel.Status("Connected!")
+	}
+	if connection.SessionManager != "" {
+		s.channel.Status(fmt.Sprintf("Attached to %s session %q", connection.SessionManager, connection.SessionName))
+	}
+
+	output := newOutputPipeline(s.channel)
+	s.mu.Lock()
+	s.session, s.output = session, output
+	defer func() {
+		s.mu.Lock()
+		s.session, s.output = nil, nil
+		s.mu.Unlock()
+	}()
+	// A resize that raced the PTY request
+	if s.cols > 0 && (s.cols != cols || s.rows != rows) {
+		session.WindowChange(s.rows, s.cols)
+	}
+	s.mu.Unlock()
+
+	// Stdout okuma
+	sessionEnded := make(chan struct{})
+	var exitErr error
+	go func() {
+		defer close(sessionEnded)
+		if err := output.pump(activityReader{stdout, s}); err != io.EOF && err != errOutputClosed {
+			log.Printf("Stdout read error: %v", err)
+		}
+		exitErr = session.Wait()
+	}()
+
+	// Stderr okuma
+	go output.pump(activityReader{stderr, s})
+
+	// Stdin yazma; a blocked write is released by closing the session
+	go func() {
+		for {
+			select {
+			case data := <-s.input:
+				if _, err := stdin.Write(data); err != nil {
+					log.Printf("Stdin write error: %v", err)
+					return
+				}
+			case <-sessionEnded:
+				return
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-sessionEnded:
+		output.Close()
+	case <-s.stop:
+		output.Abort()
+		s.mu.Lock()
+		sessionErr = s.endReason
+		s.mu.Unlock()
+		return true, false
+	}
+
+	if err := keepalive.Err(); err != nil {
+		fail("SSH peer lost", "Connection lost: remote host stopped responding", err)
+		return true, true
+	}
+	// A shell that exits reports its status; without one, the connection
+	// may be gone.
+	var missing *ssh.ExitMissingError
+	if errors.As(exitErr, &missing) {
+		if err := pingSSHClient(client); err != nil {
+			fail("SSH connection lost", "Connection lost", err)
+			return true, true
+		}
+	}
+	s.channel.Status("Connection closed")
+	return true, false
+}
+
+// shellCommand returns the command to run instead of the login shell, or ""
+// for the login shell. A working directory is changed to first.
+func shellCommand(conn *models.SSHConnection, options models.TerminalOptions) string {
+	command := options.Command
+	if command == "" {
+		command = sessionManagerCommand(conn)
+	}
+	if options.Cwd == "" {
+		return command
+	}
+	if command == "" {
+		command = `exec "${SHELL:-/bin/sh}" -l`
+	}
+	return "cd " + shellPath(options.Cwd) + " && " + command
+}
+
+// shellPath quotes a path for a POSIX shell, leaving a leading ~ to expand.
+func shellPath(path string) string {
+	if path == "~" {
+		return path
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return "~/" + shellQuote(rest)
+	}
+	return shellQuote(path)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sessionManagerCommand returns the command that runs the shell in the
+// connection's tmux or screen session, creating it or attaching to it.
+func sessionManagerCommand(conn *models.SSHConnection) string {
+	switch conn.SessionManager {
+	case models.SessionManagerTmux:
+		return "tmux new-session -A -s " + conn.SessionName
+	case models.SessionManagerScreen:
+		return "screen -D -RR -S " + conn.SessionName
+	}
+	return ""
+}
@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var webAuthn *webauthn.WebAuthn
+
+// InitWebAuthn configures the relying party. The RP ID and origin default to
+// the frontend URL, which is where the browser runs the ceremonies.
+func InitWebAuthn() {
+	frontend := frontendURL()
+
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		if u, err := url.Parse(frontend); err == nil {
+			rpID = u.Hostname()
+		}
+	}
+
+	rpName := os.Getenv("WEBAUTHN_RP_NAME")
+	if rpName == "" {
+		rpName = "SSH Terminal"
+	}
+
+	origins := []string{frontend}
+	if v := os.Getenv("WEBAUTHN_RP_ORIGINS"); v != "" {
+		origins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+	}
+
+	var err error
+	webAuthn, err = webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpName,
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		log.Printf("WebAuthn disabled: %v", err)
+		webAuthn = nil
+	}
+}
+
+type WebAuthnFinishInput struct {
+	CeremonyID string          `json:"ceremony_id" binding:"required"`
+	Name       string          `json:"name"`
+	MFAToken   string          `json:"mfa_token"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type WebAuthnMFABeginInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type WebAuthnCredentialInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func requireWebAuthn(c *gin.Context) bool {
+	if webAuthn == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WebAuthn is not configured"})
+		return false
+	}
+	return true
+}
+
+// loadWebAuthnUserFromMFAToken resolves the user of a login that is waiting
+// for its second factor.
+func loadWebAuthnUserFromMFAToken(c *gin.Context, token string) *models.WebAuthnUser {
+	claims, err := middleware.ParseMFAToken(token, middleware.MFAPurposeVerify)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return nil
+	}
+
+	user, err := models.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil
+	}
+
+	waUser, err := models.LoadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load authenticators"})
+		return nil
+	}
+	return waUser
+}
+
+func takeCeremony(c *gin.Context, id string, userID *int64, purpose string) *webauthn.SessionData {
+	session, err := models.TakeWebAuthnCeremony(id, userID, purpose)
+	if errors.Is(err, models.ErrWebAuthnCeremonyNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "WebAuthn challenge not found or expired"})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load WebAuthn challenge"})
+		return nil
+	}
+	return session
+}
+
+func BeginWebAuthnRegistration(c *gin.Context) {
+	if !requireWebAuthn(c) {
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	waUser, err := models.LoadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load authenticators"})
+		return
+	}
+
+	// Prefer discoverable credentials so the authenticator also works as a
+	// passkey for passwordless login.
+	options, session, err := webAuthn.BeginRegistration(waUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithExclusions(webauthn.Credentials(waUser.Credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		log.Printf("WebAuthn registration error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+
+	ceremonyID, err := models.SaveWebAuthnCeremony(&user.ID, models.WebAuthnPurposeRegister, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ceremony_id": ceremonyID, "options": options})
+}
+
+func FinishWebAuthnRegistration(c *gin.Context) {
+	if !requireWebAuthn(c) {
+		return
+	}
+
+	var input WebAuthnFinishInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	session := takeCeremony(c, input.CeremonyID, &user.ID, models.WebAuthnPurposeRegister)
+	if session == nil {
+		return
+	}
+
+	waUser, err := models.LoadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load authenticators"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	credential, err := webAuthn.CreateCredential(waUser, *session, parsed)
+	if err != nil {
+		log.Printf("WebAuthn registration failed: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Authenticator registration failed"})
+		return
+	}
+
+	stored, err := models.CreateWebAuthnCredential(user.ID, input.Name, credential)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save authenticator"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"credential": stored})
+}
+
+// BeginWebAuthnLogin starts a passwordless passkey login. The user is not
+// known until the authenticator returns its user handle.
+func BeginWebAuthnLogin(c *gin.Context) {
+	if !requireWebAuthn(c) {
+		return
+	}
+
+	options, session, err := webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		log.Printf("WebAuthn login error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	ceremonyID, err := models.SaveWebAuthnCeremony(nil, models.WebAuthnPurposeLogin, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ceremony_id": ceremonyID, "options": options})
+}
+
+// FinishWebAuthnLogin completes a passkey login. A user-verified passkey is
+// already two factors, so no further MFA step is asked for.
+func FinishWebAuthnLogin(c *gin.Context) {
+	if !requireWebAuthn(c) {
+		return
+	}
+
+	var input WebAuthnFinishInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session := takeCeremony(c, input.CeremonyID, nil, models.WebAuthnPurposeLogin)
+	if session == nil {
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	var waUser *models.WebAuthnUser
+	credential, err := webAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		var err error
+		waUser, err = models.GetWebAuthnUserByHandle(userHandle)
+		return waUser, err
+	}, *session, parsed)
+	if err != nil {
+		log.Printf("WebAuthn login failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	completeWebAuthnLogin(c, waUser, credential)
+}
+
+func BeginWebAuthnMFA(c *gin.Context) {
+	if !requireWebAuthn(c) {
+		return
+	}
+
+	var input WebAuthnMFABeginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	waUser := loadWebAuthnUserFromMFAToken(c, input.MFAToken)
+	if waUser == nil {
+		return
+	}
+	if len(waUser.Credentials) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No authenticators registered"})
+		return
+	}
+
+	options, session, err := webAuthn.BeginLogin(waUser)
+	if err != nil {
+		log.Printf("WebAuthn MFA error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+
+	ceremonyID, err := models.SaveWebAuthnCeremony(&waUser.User.ID, models.WebAuthnPurposeMFA, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ceremony_id": ceremonyID, "options": options})
+}
+
+func FinishWebAuthnMFA(c *gin.Context) {
+	if !requireWebAuthn(c) {
+		return
+	}
+
+	var input WebAuthnFinishInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	waUser := loadWebAuthnUserFromMFAToken(c, input.MFAToken)
+	if waUser == nil {
+		return
+	}
+
+	session := takeCeremony(c, input.CeremonyID, &waUser.User.ID, models.WebAuthnPurposeMFA)
+	if session == nil {
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	credential, err := webAuthn.ValidateLogin(waUser, *session, parsed)
+	if err != nil {
+		log.Printf("WebAuthn MFA failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authenticator verification failed"})
+		return
+	}
+
+	completeWebAuthnLogin(c, waUser, credential)
+}
+
+func completeWebAuthnLogin(c *gin.Context, waUser *models.WebAuthnUser, credential *webauthn.Credential) {
+	if credential.Authenticator.CloneWarning {
+		log.Printf("WebAuthn clone warning for user %d", waUser.User.ID)
+	}
+	if err := models.UpdateWebAuthnCredentialUsage(waUser.User.ID, credential); err != nil {
+		log.Printf("Failed to update authenticator usage: %v", err)
+	}
+
+	response, err := startSession(c, waUser.User)
+	if err != nil {
+		respondSessionError(c, err)
+		return
+	}
+
+	response["message"] = "Login successful"
+	response["user"] = waUser.User
+	c.JSON(http.StatusOK, response)
+}
+
+func GetWebAuthnCredentials(c *gin.Context) {
+	credentials, err := models.GetWebAuthnCredentials(middleware.GetCurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch authenticators"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+func RenameWebAuthnCredential(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authenticator ID"})
+		return
+	}
+
+	var input WebAuthnCredentialInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential, err := models.RenameWebAuthnCredential(id, userID, input.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrWebAuthnCredentialNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Authenticator not found"})
+		case errors.Is(err, models.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename authenticator"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credential": credential})
+}
+
+func DeleteWebAuthnCredential(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authenticator ID"})
+		return
+	}
+
+	if _, err := models.GetWebAuthnCredentialByID(id, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authenticator not found"})
+		return
+	}
+	if !requireRemainingSecondFactor(c, userID) {
+		return
+	}
+
+	if err := models.DeleteWebAuthnCredential(id, userID); err != nil {
+		if errors.Is(err, models.ErrWebAuthnCredentialNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Authenticator not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete authenticator"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Authenticator deleted successfully"})
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"ssh-terminal-app/internal/middleware"
 	"ssh-terminal-app/internal/models"
+	"ssh-terminal-app/internal/ratelimit"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,12 +20,58 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
+	Subprotocols:    []string{terminalBinaryProtocol},
+	CheckOrigin:     checkOrigin,
+}
+
+// AllowedOrigins lists the browser origins the frontend is served from. They
+// may call the API with credentials and open terminal WebSockets.
+func AllowedOrigins() []string {
+	return []string{frontendURL(), "http://localhost:5173", "http://localhost:8080"}
+}
+
+// checkOrigin refuses WebSocket handshakes started by other sites. Browsers
+// send the token cookie along with them, so any page could otherwise open a
+// terminal as the signed-in user. Clients other than browsers send no Origin.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
 		return true
-	},
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range AllowedOrigins() {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
 }
 
-func createSSHClient(conn *models.SSHConnection) (*ssh.Client, error) {
+// maxJumpDepth bounds bastion chains and guards against jump host cycles.
+const maxJumpDepth = 4
+
+// createSSHClient dials a connection, holding one of the owner's concurrent
+// dial slots until the handshake is done. It also returns the IDs of the jump
+// connections on the way.
+func createSSHClient(conn *models.SSHConnection) (*ssh.Client, []int64, error) {
+	release, err := ratelimit.AcquireDial(conn.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	var jumps []int64
+	client, err := dialSSHClient(conn, 0, &jumps)
+	return client, jumps, err
+}
+
+func sshClientConfig(conn *models.SSHConnection) (*ssh.ClientConfig, error) {
 	var authMethods []ssh.AuthMethod
 
 	switch conn.AuthType {
@@ -45,239 +93,169 @@ func createSSHClient(conn *models.SSHConnection) (*ssh.Client, error) {
 		authMethods = append(authMethods, ssh.PublicKeys(signer))
 	}
 
-	config := &ssh.ClientConfig{
+	return &ssh.ClientConfig{
 		User:            conn.Username,
 		Auth:            authMethods,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 		Timeout:         10 * time.Second,
-	}
-
-	address := fmt.Sprintf("%s:%d", conn.Host, conn.Port)
-	client, err := ssh.Dial("tcp", address, config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to %s: %v", address, err)
-	}
-
-	return client, nil
+	}, nil
 }
 
-func HandleWebSocketTerminal(c *gin.Context) {
-	connID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+func dialSSHClient(conn *models.SSHConnection, depth int, jumps *[]int64) (*ssh.Client, error) {
+	config, err := sshClientConfig(conn)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection ID"})
-		return
+		return nil, err
 	}
 
-	userIDStr := c.Query("user_id")
-	if userIDStr == "" {
-		userID := middleware.GetCurrentUserID(c)
-		if userID == 0 {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			return
+	address := fmt.Sprintf("%s:%d", conn.Host, conn.Port)
+	if conn.JumpConnectionID == nil {
+		client, err := ssh.Dial("tcp", address, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %v", address, err)
 		}
-		userIDStr = strconv.FormatInt(userID, 10)
+		return client, nil
 	}
 
-	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if depth >= maxJumpDepth {
+		return nil, fmt.Errorf("too many jump hosts for %s", address)
+	}
+	jump, err := models.GetSSHConnectionByID(*conn.JumpConnectionID, conn.UserID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-		return
+		return nil, fmt.Errorf("jump connection not found")
 	}
-
-	connection, err := models.GetSSHConnectionByID(connID, userID)
+	*jumps = append(*jumps, jump.ID)
+	jumpClient, err := dialSSHClient(jump, depth+1, jumps)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
-		return
+		return nil, fmt.Errorf("jump host %s: %v", jump.Name, err)
 	}
 
-	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	netConn, err := jumpClient.Dial("tcp", address)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
-		return
+		jumpClient.Close()
+		return nil, fmt.Errorf("failed to connect to %s via %s: %v", address, jump.Name, err)
 	}
-	defer ws.Close()
-
-	log.Printf("WebSocket connected for connection ID: %d", connID)
-
-	ws.WriteJSON(map[string]string{
-		"type":    "status",
-		"message": fmt.Sprintf("Connecting to %s@%s:%d...", connection.Username, connection.Host, connection.Port),
-	})
 
-	client, err := createSSHClient(connection)
+	clientConn, chans, reqs, err := ssh.NewClientConn(netConn, address, config)
 	if err != nil {
-		log.Printf("SSH connection failed: %v", err)
-		ws.WriteJSON(map[string]string{
-			"type":    "error",
-			"message": fmt.Sprintf("SSH connection failed: %v", err),
-		})
-		return
+		netConn.Close()
+		jumpClient.Close()
+		return nil, fmt.Errorf("failed to connect to %s via %s: %v", address, jump.Name, err)
 	}
-	defer client.Close()
 
-	session, err := client.NewSession()
+	client := ssh.NewClient(clientConn, chans, reqs)
+	go func() {
+		client.Wait()
+		jumpClient.Close()
+	}()
+	return client, nil
+}
+
+func HandleWebSocketTerminal(c *gin.Context) {
+	connID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		log.Printf("SSH session failed: %v", err)
-		ws.WriteJSON(map[string]string{
-			"type":    "error",
-			"message": fmt.Sprintf("Failed to create session: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection ID"})
 		return
 	}
-	defer session.Close()
 
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          1,
-		ssh.TTY_OP_ISPEED: 14400,
-		ssh.TTY_OP_OSPEED: 14400,
-	}
-
-	if err := session.RequestPty("xterm-256color", 24, 80, modes); err != nil {
-		log.Printf("PTY request failed: %v", err)
-		ws.WriteJSON(map[string]string{
-			"type":    "error",
-			"message": fmt.Sprintf("Failed to request PTY: %v", err),
-		})
+	userID := middleware.GetCurrentUserID(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	stdin, err := session.StdinPipe()
+	connection, err := models.GetSSHConnectionByID(connID, userID)
 	if err != nil {
-		log.Printf("Stdin pipe failed: %v", err)
-		ws.WriteJSON(map[string]string{
-			"type":    "error",
-			"message": fmt.Sprintf("Failed to get stdin: %v", err),
-		})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
 		return
 	}
 
-	stdout, err := session.StdoutPipe()
+	options, err := terminalOptionsFromQuery(c)
+	if err == nil {
+		err = options.Validate()
+	}
 	if err != nil {
-		log.Printf("Stdout pipe failed: %v", err)
-		ws.WriteJSON(map[string]string{
-			"type":    "error",
-			"message": fmt.Sprintf("Failed to get stdout: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	stderr, err := session.StderrPipe()
-	if err != nil {
-		log.Printf("Stderr pipe failed: %v", err)
-		ws.WriteJSON(map[string]string{
-			"type":    "error",
-			"message": fmt.Sprintf("Failed to get stderr: %v", err),
-		})
+	if err := checkTerminalLimits(userID, connection); err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := session.Shell(); err != nil {
-		log.Printf("Shell start failed: %v", err)
-		ws.WriteJSON(map[string]string{
-			"type":    "error",
-			"message": fmt.Sprintf("Failed to start shell: %v", err),
-		})
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
+	defer ws.Close()
 
-	ws.WriteJSON(map[string]string{
-		"type":    "status",
-		"message": "Connected!",
-	})
+	log.Printf("WebSocket connected for connection ID: %d", connID)
 
-	done := make(chan struct{})
-	var closeOnce sync.Once
-	closeDone := func() {
-		closeOnce.Do(func() {
-			close(done)
-		})
-	}
+	term := newTerminalConn(ws, false)
+	defer term.Close(websocket.CloseNormalClosure, "")
 
-	// Stdout okuma
-	go func() {
-		buf := make([]byte, 1024)
-		for {
-			select {
-			case <-done:
-				return
-			default:
-				n, err := stdout.Read(buf)
-				if err != nil {
-					log.Printf("Stdout read error: %v", err)
-					closeDone()
-					return
-				}
-				if n > 0 {
-					ws.WriteJSON(map[string]string{
-						"type": "output",
-						"data": string(buf[:n]),
-					})
-				}
-			}
-		}
-	}()
+	terminal := newTerminalSession(userID, connection, options, term.channel(0))
 
-	// Stderr okuma
+	// WebSocket mesajları
 	go func() {
-		buf := make([]byte, 1024)
+		defer terminal.Stop()
 		for {
-			select {
-			case <-done:
-				return
-			default:
-				n, err := stderr.Read(buf)
-				if err != nil {
-					return
-				}
-				if n > 0 {
-					ws.WriteJSON(map[string]string{
-						"type": "output",
-						"data": string(buf[:n]),
-					})
+			msg, err := term.ReadMessage()
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+					log.Printf("WebSocket error: %v", err)
 				}
+				return
 			}
+			terminal.handle(msg)
 		}
 	}()
 
-	// WebSocket mesajları
-	for {
-		select {
-		case <-done:
-			ws.WriteJSON(map[string]string{
-				"type":    "status",
-				"message": "Connection closed",
-			})
-			return
-		default:
-			var msg struct {
-				Type string `json:"type"`
-				Data string `json:"data"`
-				Cols int    `json:"cols"`
-				Rows int    `json:"rows"`
-			}
+	terminal.run(func() (*ssh.Client, func(), error) {
+		return acquireSSHClient(connection)
+	})
+}
 
-			err := ws.ReadJSON(&msg)
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("WebSocket error: %v", err)
-				}
-				closeDone()
-				return
-			}
+// terminalOptionsFromQuery reads the terminal options of a WebSocket
+// handshake, e.g. ?term=xterm&cols=120&rows=40&env=LANG=C.UTF-8&mode=ECHO=0
+// with cwd and command taking a directory and a command to run.
+func terminalOptionsFromQuery(c *gin.Context) (models.TerminalOptions, error) {
+	options := models.TerminalOptions{
+		Term:    c.Query("term"),
+		Command: c.Query("command"),
+		Cwd:     c.Query("cwd"),
+	}
 
-			switch msg.Type {
-			case "input":
-				_, err := stdin.Write([]byte(msg.Data))
-				if err != nil {
-					log.Printf("Stdin write error: %v", err)
-					closeDone()
-					return
-				}
-			case "resize":
-				if msg.Cols > 0 && msg.Rows > 0 {
-					session.WindowChange(msg.Rows, msg.Cols)
-				}
+	var err error
+	for _, size := range []struct {
+		name  string
+		value *int
+	}{{"cols", &options.Cols}, {"rows", &options.Rows}} {
+		if v := c.Query(size.name); v != "" {
+			if *size.value, err = strconv.Atoi(v); err != nil {
+				return options, fmt.Errorf("Invalid %s", size.name)
 			}
 		}
 	}
+
+	for _, pair := range c.QueryArray("env") {
+		name, value, _ := strings.Cut(pair, "=")
+		if options.Env == nil {
+			options.Env = map[string]string{}
+		}
+		options.Env[name] = value
+	}
+	for _, pair := range c.QueryArray("mode") {
+		name, value, _ := strings.Cut(pair, "=")
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return options, fmt.Errorf("Invalid value for terminal mode %s", name)
+		}
+		if options.Modes == nil {
+			options.Modes = map[string]uint32{}
+		}
+		options.Modes[name] = uint32(n)
+	}
+	return options, nil
 }
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"ssh-terminal-app/internal/middleware"
+	"ssh-terminal-app/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://terminal.example.com")
+
+	tests := []struct {
+		origin string
+		host   string
+		want   bool
+	}{
+		{origin: "", host: "api.example.com", want: true},
+		{origin: "https://terminal.example.com", host: "api.example.com", want: true},
+		{origin: "HTTPS://Terminal.Example.com", host: "api.example.com", want: true},
+		{origin: "http://localhost:5173", host: "api.example.com", want: true},
+		{origin: "https://api.example.com", host: "api.example.com", want: true},
+		{origin: "https://evil.example.net", host: "api.example.com", want: false},
+		{origin: "https://terminal.example.com.evil.example.net", host: "api.example.com", want: false},
+		{origin: "http://terminal.example.com", host: "api.example.com", want: false},
+		{origin: "null", host: "api.example.com", want: false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/ws/mux", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkOrigin(r); got != tt.want {
+			t.Errorf("checkOrigin(Origin %q, Host %q) = %v, want %v", tt.origin, tt.host, got, tt.want)
+		}
+	}
+}
+
+// TestWebSocketRefusesCrossSiteCookie checks that another site cannot use
+// the browser's token cookie to open a terminal.
+func TestWebSocketRefusesCrossSiteCookie(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "https://terminal.example.com")
+
+	email := testEmail("ws-origin")
+	createTestUser(t, email, "Passw0rd!")
+	w := postLogin(loginTestRouter(), email, "Passw0rd!")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status = %d, body %s", w.Code, w.Body)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &login); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/ws/mux", middleware.AuthMiddleware(models.ScopeTerminal), HandleWebSocketMux)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/mux"
+
+	for _, tt := range []struct {
+		origin     string
+		wantStatus int
+	}{
+		{origin: "https://evil.example.net", wantStatus: http.StatusForbidden},
+		{origin: "https://terminal.example.com", wantStatus: http.StatusSwitchingProtocols},
+	} {
+		header := http.Header{}
+		header.Set("Origin", tt.origin)
+		header.Set("Cookie", "token="+login.Token)
+		ws, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if ws != nil {
+			ws.Close()
+		}
+		if resp == nil {
+			t.Fatalf("Origin %s: %v", tt.origin, err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("Origin %s: status = %d, want %d", tt.origin, resp.StatusCode, tt.wantStatus)
+		}
+	}
+}
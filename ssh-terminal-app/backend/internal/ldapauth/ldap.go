@@ -0,0 +1,276 @@
+package ldapauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrDisabled           = errors.New("LDAP authentication is not configured")
+	ErrInvalidCredentials = errors.New("invalid LDAP credentials")
+)
+
+// Conn is the part of an LDAP connection the authenticator uses. Dial can be
+// replaced to run against an in-process directory instead of a real server.
+type Conn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+type Config struct {
+	URL            string
+	StartTLS       bool
+	TLSConfig      *tls.Config
+	Timeout        time.Duration
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string
+	IDAttribute    string
+	EmailAttribute string
+	NameAttribute  string
+	GroupAttribute string
+	EmailDomain    string
+	TeamMap        map[string]string
+}
+
+// Entry is a directory user that passed authentication.
+type Entry struct {
+	DN     string
+	ID     string
+	Email  string
+	Name   string
+	Groups []string
+	Teams  []string
+}
+
+var config *Config
+
+// Dial opens a connection to the configured directory.
+var Dial = func(cfg *Config) (Conn, error) {
+	conn, err := ldap.DialURL(cfg.URL,
+		ldap.DialWithTLSConfig(cfg.TLSConfig),
+		ldap.DialWithDialer(&net.Dialer{Timeout: cfg.Timeout}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(cfg.Timeout)
+
+	if cfg.StartTLS {
+		if err := conn.StartTLS(cfg.TLSConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// InitLDAP reads the LDAP_* settings. LDAP authentication stays off unless
+// LDAP_URL and LDAP_BASE_DN are set.
+func InitLDAP() error {
+	config = nil
+
+	url := os.Getenv("LDAP_URL")
+	baseDN := os.Getenv("LDAP_BASE_DN")
+	if url == "" || baseDN == "" {
+		return nil
+	}
+
+	cfg := &Config{
+		URL:            url,
+		StartTLS:       os.Getenv("LDAP_START_TLS") == "true",
+		Timeout:        10 * time.Second,
+		BindDN:         os.Getenv("LDAP_BIND_DN"),
+		BindPassword:   os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:         baseDN,
+		UserFilter:     envOr("LDAP_USER_FILTER", "(&(objectClass=person)(|(uid={username})(mail={username})(sAMAccountName={username})(userPrincipalName={username})))"),
+		IDAttribute:    envOr("LDAP_ID_ATTRIBUTE", ""),
+		EmailAttribute: envOr("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		NameAttribute:  envOr("LDAP_NAME_ATTRIBUTE", "displayName"),
+		GroupAttribute: envOr("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		EmailDomain:    os.Getenv("LDAP_EMAIL_DOMAIN"),
+		TeamMap:        parseTeamMap(os.Getenv("LDAP_TEAM_MAP")),
+	}
+
+	if !strings.Contains(cfg.UserFilter, "{username}") {
+		return errors.New("LDAP_USER_FILTER must contain {username}")
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("LDAP_TIMEOUT")); err == nil && ttl > 0 {
+		cfg.Timeout = ttl
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true",
+	}
+	if caFile := os.Getenv("LDAP_CA_CERT"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("read LDAP_CA_CERT: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("LDAP_CA_CERT contains no certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	cfg.TLSConfig = tlsConfig
+
+	config = cfg
+	log.Printf("LDAP authentication enabled: %s", cfg.URL)
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// parseTeamMap reads "group DN=>team" pairs separated by semicolons. Group
+// DNs are compared case-insensitively.
+func parseTeamMap(value string) map[string]string {
+	teams := map[string]string{}
+	for _, pair := range strings.Split(value, ";") {
+		group, team, ok := strings.Cut(pair, "=>")
+		group = strings.TrimSpace(group)
+		team = strings.TrimSpace(team)
+		if !ok || group == "" || team == "" {
+			continue
+		}
+		teams[normalizeDN(group)] = team
+	}
+	return teams
+}
+
+func normalizeDN(dn string) string {
+	if parsed, err := ldap.ParseDN(dn); err == nil {
+		parts := make([]string, 0, len(parsed.RDNs))
+		for _, rdn := range parsed.RDNs {
+			attrs := make([]string, 0, len(rdn.Attributes))
+			for _, attr := range rdn.Attributes {
+				attrs = append(attrs, strings.ToLower(attr.Type)+"="+strings.ToLower(attr.Value))
+			}
+			parts = append(parts, strings.Join(attrs, "+"))
+		}
+		return strings.Join(parts, ",")
+	}
+	return strings.ToLower(strings.TrimSpace(dn))
+}
+
+func Enabled() bool {
+	return config != nil
+}
+
+// Authenticate finds the user with the service account (or anonymously) and
+// then binds as that user to check the password.
+func Authenticate(username, password string) (*Entry, error) {
+	cfg := config
+	if cfg == nil {
+		return nil, ErrDisabled
+	}
+
+	username = strings.TrimSpace(username)
+	// An empty password would turn the user bind into an unauthenticated
+	// bind, which most servers accept.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := Dial(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	defer conn.Close()
+
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+
+	attributes := []string{cfg.EmailAttribute, cfg.NameAttribute, "cn", "uid", cfg.GroupAttribute, "objectGUID", "entryUUID"}
+	if cfg.IDAttribute != "" {
+		attributes = append(attributes, cfg.IDAttribute)
+	}
+
+	filter := strings.ReplaceAll(cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(cfg.Timeout.Seconds()), false, filter, attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	found := result.Entries[0]
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind: %w", err)
+	}
+
+	return cfg.entry(found), nil
+}
+
+func (cfg *Config) entry(found *ldap.Entry) *Entry {
+	entry := &Entry{
+		DN:     found.DN,
+		ID:     entryID(cfg, found),
+		Email:  found.GetAttributeValue(cfg.EmailAttribute),
+		Name:   found.GetAttributeValue(cfg.NameAttribute),
+		Groups: found.GetAttributeValues(cfg.GroupAttribute),
+		Teams:  []string{},
+	}
+	if entry.Name == "" {
+		entry.Name = found.GetAttributeValue("cn")
+	}
+	if entry.Email == "" && cfg.EmailDomain != "" {
+		if uid := found.GetAttributeValue("uid"); uid != "" {
+			entry.Email = uid + "@" + cfg.EmailDomain
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, group := range entry.Groups {
+		if team, ok := cfg.TeamMap[normalizeDN(group)]; ok && !seen[team] {
+			seen[team] = true
+			entry.Teams = append(entry.Teams, team)
+		}
+	}
+	return entry
+}
+
+// entryID picks a stable identifier for the user, so renaming or moving the
+// entry in the directory keeps it linked to the same account.
+func entryID(cfg *Config, found *ldap.Entry) string {
+	if cfg.IDAttribute != "" {
+		if raw := found.GetRawAttributeValue(cfg.IDAttribute); len(raw) > 0 {
+			return string(raw)
+		}
+	}
+	if guid := found.GetRawAttributeValue("objectGUID"); len(guid) > 0 {
+		return hex.EncodeToString(guid)
+	}
+	if uuid := found.GetAttributeValue("entryUUID"); uuid != "" {
+		return uuid
+	}
+	return normalizeDN(found.DN)
+}
@@ -0,0 +1,209 @@
+package ldapauth
+
+import (
+	"errors"
+	"slices"
+	"ssh-terminal-app/internal/ldapauth/ldaptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testBaseDN    = "ou=people,dc=example,dc=com"
+	testServiceDN = "cn=service,dc=example,dc=com"
+)
+
+func testDirectory() *ldaptest.Directory {
+	return ldaptest.NewDirectory(
+		ldaptest.Entry{DN: testServiceDN, Password: "service-secret"},
+		ldaptest.Entry{
+			DN:       "uid=alice," + testBaseDN,
+			Password: "alice-secret",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"alice"},
+				"mail":        {"alice@example.com"},
+				"displayName": {"Alice Admin"},
+				"entryUUID":   {"8d1b7c2e-0000-4000-8000-000000000001"},
+				"memberOf": {
+					"CN=Ops,OU=Groups,DC=example,DC=com",
+					"cn=devs,ou=groups,dc=example,dc=com",
+					"cn=unmapped,ou=groups,dc=example,dc=com",
+				},
+			},
+		},
+		ldaptest.Entry{
+			DN:       "uid=bob," + testBaseDN,
+			Password: "bob-secret",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"bob"},
+				"cn":          {"Bob"},
+			},
+		},
+	)
+}
+
+// useDirectory points the authenticator at dir until the test ends.
+func useDirectory(t *testing.T, dir *ldaptest.Directory) {
+	t.Helper()
+	previousConfig, previousDial := config, Dial
+	t.Cleanup(func() { config, Dial = previousConfig, previousDial })
+
+	config = &Config{
+		URL:            "ldap://directory.test",
+		Timeout:        5 * time.Second,
+		BindDN:         testServiceDN,
+		BindPassword:   "service-secret",
+		BaseDN:         testBaseDN,
+		UserFilter:     "(&(objectClass=person)(|(uid={username})(mail={username})))",
+		EmailAttribute: "mail",
+		NameAttribute:  "displayName",
+		GroupAttribute: "memberOf",
+		EmailDomain:    "corp.example.com",
+		TeamMap: parseTeamMap(
+			"cn=ops,ou=groups,dc=example,dc=com=>Operations;" +
+				"cn=devs,ou=groups,dc=example,dc=com=>Developers",
+		),
+	}
+	Dial = func(*Config) (Conn, error) { return dir.Dial(), nil }
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  error
+		want     *Entry
+	}{
+		{
+			name:     "uid",
+			username: "alice",
+			password: "alice-secret",
+			want: &Entry{
+				DN:     "uid=alice," + testBaseDN,
+				ID:     "8d1b7c2e-0000-4000-8000-000000000001",
+				Email:  "alice@example.com",
+				Name:   "Alice Admin",
+				Groups: []string{"CN=Ops,OU=Groups,DC=example,DC=com", "cn=devs,ou=groups,dc=example,dc=com", "cn=unmapped,ou=groups,dc=example,dc=com"},
+				Teams:  []string{"Operations", "Developers"},
+			},
+		},
+		{
+			name:     "email",
+			username: " alice@example.com ",
+			password: "alice-secret",
+			want: &Entry{
+				DN:     "uid=alice," + testBaseDN,
+				ID:     "8d1b7c2e-0000-4000-8000-000000000001",
+				Email:  "alice@example.com",
+				Name:   "Alice Admin",
+				Groups: []string{"CN=Ops,OU=Groups,DC=example,DC=com", "cn=devs,ou=groups,dc=example,dc=com", "cn=unmapped,ou=groups,dc=example,dc=com"},
+				Teams:  []string{"Operations", "Developers"},
+			},
+		},
+		{
+			name:     "fallbacks for email, name and ID",
+			username: "bob",
+			password: "bob-secret",
+			want: &Entry{
+				DN:    "uid=bob," + testBaseDN,
+				ID:    "uid=bob,ou=people,dc=example,dc=com",
+				Email: "bob@corp.example.com",
+				Name:  "Bob",
+				Teams: []string{},
+			},
+		},
+		{name: "wrong password", username: "alice", password: "wrong", wantErr: ErrInvalidCredentials},
+		{name: "unknown user", username: "carol", password: "carol-secret", wantErr: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testDirectory()
+			useDirectory(t, dir)
+
+			entry, err := Authenticate(tt.username, tt.password)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.DN != tt.want.DN || entry.ID != tt.want.ID || entry.Email != tt.want.Email ||
+				entry.Name != tt.want.Name || !slices.Equal(entry.Groups, tt.want.Groups) ||
+				!slices.Equal(entry.Teams, tt.want.Teams) {
+				t.Fatalf("entry = %+v, want %+v", entry, tt.want)
+			}
+			if binds := dir.Binds(); len(binds) != 2 || binds[0] != testServiceDN || binds[1] != tt.want.DN {
+				t.Fatalf("binds = %v, want service account then user", binds)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRejectsEmptyPassword(t *testing.T) {
+	dir := testDirectory()
+	useDirectory(t, dir)
+
+	// The directory accepts an empty password as an unauthenticated bind,
+	// so it must never be asked.
+	for _, username := range []string{"alice", "", "  "} {
+		if _, err := Authenticate(username, ""); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Authenticate(%q, \"\") err = %v, want ErrInvalidCredentials", username, err)
+		}
+	}
+	if _, err := Authenticate("", "alice-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("empty username: err = %v, want ErrInvalidCredentials", err)
+	}
+	if n := dir.Dials(); n != 0 {
+		t.Fatalf("directory was dialed %d times", n)
+	}
+}
+
+func TestAuthenticateEscapesFilter(t *testing.T) {
+	for _, username := range []string{"*)(uid=*", "alice)(|(uid=*", "al*", `alice\`, "*"} {
+		t.Run(username, func(t *testing.T) {
+			dir := testDirectory()
+			useDirectory(t, dir)
+
+			if _, err := Authenticate(username, "alice-secret"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+			}
+			searches := dir.Searches()
+			if len(searches) != 1 {
+				t.Fatalf("searches = %v, want one", searches)
+			}
+			if searches[0].Matches != 0 {
+				t.Fatalf("filter %q matched %d entries", searches[0].Filter, searches[0].Matches)
+			}
+			for special, escaped := range map[string]string{"*": `\2a`, "(": `\28`, ")": `\29`, `\`: `\5c`} {
+				if strings.Contains(username, special) && !strings.Contains(searches[0].Filter, escaped) {
+					t.Fatalf("filter %q does not escape %q", searches[0].Filter, special)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	previous := config
+	config = nil
+	t.Cleanup(func() { config = previous })
+
+	if _, err := Authenticate("alice", "alice-secret"); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("err = %v, want ErrDisabled", err)
+	}
+}
+
+func TestParseTeamMap(t *testing.T) {
+	teams := parseTeamMap(" CN=Ops, OU=Groups ,DC=example,DC=com => Operations ; broken ; =>x;cn=a,dc=b=> ")
+	if len(teams) != 1 || teams["cn=ops,ou=groups,dc=example,dc=com"] != "Operations" {
+		t.Fatalf("teams = %v", teams)
+	}
+}
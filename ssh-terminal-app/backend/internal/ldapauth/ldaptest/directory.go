@@ -0,0 +1,219 @@
+// Package ldaptest provides an in-memory LDAP directory that stands in for a
+// server in tests, through ldapauth.Dial.
+package ldaptest
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Entry is a directory entry. Binding as it needs Password.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Search is a search the directory answered.
+type Search struct {
+	Filter  string
+	Matches int
+}
+
+// Directory holds entries and records the binds and searches made against
+// it. Like most servers, it accepts a bind with an empty password as an
+// unauthenticated bind.
+type Directory struct {
+	mu       sync.Mutex
+	entries  []Entry
+	binds    []string
+	searches []Search
+	dials    int
+}
+
+func NewDirectory(entries ...Entry) *Directory {
+	return &Directory{entries: entries}
+}
+
+// Dial opens a connection to the directory.
+func (d *Directory) Dial() *Conn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dials++
+	return &Conn{dir: d}
+}
+
+// Dials returns how many connections were opened.
+func (d *Directory) Dials() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials
+}
+
+// Binds returns the DNs bound as, successfully or not.
+func (d *Directory) Binds() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.binds...)
+}
+
+func (d *Directory) Searches() []Search {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Search(nil), d.searches...)
+}
+
+// Conn is a connection to a Directory. It implements ldapauth.Conn.
+type Conn struct {
+	dir    *Directory
+	closed bool
+}
+
+var errClosed = ldap.NewError(ldap.ErrorNetwork, errors.New("connection closed"))
+
+func (c *Conn) Bind(username, password string) error {
+	if c.closed {
+		return errClosed
+	}
+	d := c.dir
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.binds = append(d.binds, username)
+	if password == "" {
+		return nil
+	}
+	for _, e := range d.entries {
+		if strings.EqualFold(e.DN, username) && e.Password != "" && e.Password == password {
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (c *Conn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if c.closed {
+		return nil, errClosed
+	}
+	filter, err := ldap.CompileFilter(request.Filter)
+	if err != nil {
+		return nil, ldap.NewError(ldap.LDAPResultFilterError, err)
+	}
+
+	d := c.dir
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := &ldap.SearchResult{}
+	matches := 0
+	for _, e := range d.entries {
+		if !inBase(e.DN, request.BaseDN) || !matchFilter(filter, e) {
+			continue
+		}
+		matches++
+		if request.SizeLimit == 0 || len(result.Entries) < request.SizeLimit {
+			result.Entries = append(result.Entries, ldap.NewEntry(e.DN, e.Attributes))
+		}
+	}
+	d.searches = append(d.searches, Search{Filter: request.Filter, Matches: matches})
+
+	if request.SizeLimit > 0 && matches > request.SizeLimit {
+		return result, ldap.NewError(ldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded"))
+	}
+	return result, nil
+}
+
+func (c *Conn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func inBase(dn, base string) bool {
+	dn, base = strings.ToLower(dn), strings.ToLower(base)
+	return dn == base || strings.HasSuffix(dn, ","+base)
+}
+
+func (e Entry) values(attribute string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+// matchFilter evaluates the filter types the authenticator uses: and, or,
+// not, equality, presence and substrings, all case-insensitive.
+func matchFilter(f *ber.Packet, e Entry) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, child := range f.Children {
+			if !matchFilter(child, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range f.Children {
+			if matchFilter(child, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchFilter(f.Children[0], e)
+	case ldap.FilterPresent:
+		return len(e.values(packetString(f))) > 0
+	case ldap.FilterEqualityMatch:
+		want := packetString(f.Children[1])
+		for _, v := range e.values(packetString(f.Children[0])) {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		for _, v := range e.values(packetString(f.Children[0])) {
+			if matchSubstrings(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func matchSubstrings(v string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		s := strings.ToLower(packetString(part))
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(v, s) {
+				return false
+			}
+			v = v[len(s):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(v, s)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(v, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func packetString(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	return p.Data.String()
+}
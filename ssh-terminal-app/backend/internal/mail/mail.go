@@ -0,0 +1,167 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers outgoing mail. InitMail picks the implementation.
+type Sender interface {
+	Send(msg Message) error
+}
+
+var sender Sender = LogSender{}
+
+var from = "SSH Terminal <no-reply@localhost>"
+
+// InitMail selects the sender from MAIL_DRIVER: "smtp" uses the SMTP_*
+// settings, "file" writes each message to MAIL_DIR, and "log" prints messages
+// to the server log for local development. "log" is the default outside
+// release mode; in release mode the driver must be chosen and the log driver
+// leaves out message bodies, which carry reset and verification links.
+func InitMail() error {
+	release := os.Getenv("GIN_MODE") == "release"
+
+	if v := os.Getenv("MAIL_FROM"); v != "" {
+		from = v
+	}
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return fmt.Errorf("SMTP_HOST is required for the smtp mail driver")
+		}
+		sender = &SMTPSender{
+			Addr:     net.JoinHostPort(host, port),
+			Host:     host,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		sender = &FileSender{Dir: dir}
+	case "":
+		if release {
+			return fmt.Errorf("MAIL_DRIVER is required in release mode")
+		}
+		sender = LogSender{Body: true}
+	case "log":
+		sender = LogSender{Body: !release}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+	return nil
+}
+
+func Send(msg Message) error {
+	return sender.Send(msg)
+}
+
+// SetSender replaces the sender, e.g. with a fake that records messages.
+func SetSender(s Sender) {
+	sender = s
+}
+
+// format renders the message as an RFC 5322 plain text email.
+func format(msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func checkHeaders(msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("mail headers must not contain line breaks")
+	}
+	return nil
+}
+
+// SMTPSender sends mail through an SMTP server, upgrading to TLS with
+// STARTTLS when the server offers it.
+type SMTPSender struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	envelopeFrom := from
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		envelopeFrom = strings.TrimSuffix(from[i+1:], ">")
+	}
+	return smtp.SendMail(s.Addr, auth, envelopeFrom, []string{msg.To}, format(msg))
+}
+
+// FileSender writes each message to its own .eml file.
+type FileSender struct {
+	Dir string
+}
+
+func (s *FileSender) Send(msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(s.Dir, name), format(msg), 0600)
+}
+
+// LogSender prints messages to the server log. The body is only included
+// with Body set.
+type LogSender struct {
+	Body bool
+}
+
+func (s LogSender) Send(msg Message) error {
+	if err := checkHeaders(msg); err != nil {
+		return err
+	}
+
+	if !s.Body {
+		log.Printf("Mail to %s: %s", msg.To, msg.Subject)
+		return nil
+	}
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
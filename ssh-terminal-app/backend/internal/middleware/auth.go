@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"os"
 	"ssh-terminal-app/internal/models"
@@ -9,30 +11,46 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
 )
 
 var jwtSecret []byte
 
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
 func InitJWT() {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		secret = "default-secret-change-in-production"
 	}
 	jwtSecret = []byte(secret)
+
+	if ttl, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && ttl > 0 {
+		AccessTokenTTL = ttl
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil && ttl > 0 {
+		RefreshTokenTTL = ttl
+	}
 }
 
 type Claims struct {
-	UserID int64  `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    int64  `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID int64  `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(user *models.User) (string, error) {
-	expirationTime := time.Now().Add(24 * 7 * time.Hour) // 7 days
+// GenerateToken issues a short-lived access token bound to an auth session.
+func GenerateToken(user *models.User, sessionID int64) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
 
 	claims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
+		UserID:    user.ID,
+		Email:     user.Email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -44,50 +62,135 @@ func GenerateToken(user *models.User) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			tokenCookie, err := c.Cookie("token")
-			if err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
-				c.Abort()
-				return
-			}
-			authHeader = "Bearer " + tokenCookie
+// ParseToken validates an access token's signature and expiry.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired token")
+	}
+	return claims, nil
+}
+
+// TokenFromRequest returns the bearer token from the Authorization header or
+// the token cookie. WebSocket handshakes cannot set headers from the browser,
+// so they may also pass it as the token query parameter.
+func TokenFromRequest(c *gin.Context) (string, error) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		if tokenCookie, err := c.Cookie("token"); err == nil && tokenCookie != "" {
+			return tokenCookie, nil
+		}
+		if token := c.Query("token"); token != "" && websocket.IsWebSocketUpgrade(c.Request) {
+			return token, nil
 		}
+		return "", errors.New("Authorization required")
+	}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return "", errors.New("Invalid authorization header format")
+	}
+	return tokenString, nil
+}
+
+// AuthMiddleware accepts session access tokens and personal API tokens. API
+// tokens only work on routes that list the scopes they need and must hold all
+// of them; routes without scopes are reserved for interactive sessions.
+func AuthMiddleware(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, err := TokenFromRequest(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+			authenticateAPIToken(c, tokenString, scopes)
+			return
+		}
 
-		if err != nil || !token.Valid {
+		claims, err := ParseToken(tokenString)
+		if err != nil || claims.SessionID == 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		session, err := models.GetAuthSessionByID(claims.SessionID)
+		if err != nil || !session.IsActive() || session.UserID != claims.UserID {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
 		user, err := models.GetUserByID(claims.UserID)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
+		if user.IsDisabled() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This account has been disabled"})
+			c.Abort()
+			return
+		}
+
+		if err := models.TouchAuthSession(session); err != nil {
+			log.Printf("Failed to update session activity: %v", err)
+		}
 
 		c.Set("user", user)
 		c.Set("userID", user.ID)
+		c.Set("authSessionID", session.ID)
 		c.Next()
 	}
 }
 
+func authenticateAPIToken(c *gin.Context, tokenString string, scopes []string) {
+	if len(scopes) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API tokens cannot be used for this endpoint"})
+		return
+	}
+
+	token, err := models.AuthenticateAPIToken(tokenString)
+	if err != nil {
+		if !errors.Is(err, models.ErrInvalidAPIToken) {
+			log.Printf("API token lookup error: %v", err)
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
+		return
+	}
+	for _, scope := range scopes {
+		if !token.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API token is missing the " + scope + " scope"})
+			return
+		}
+	}
+
+	user, err := models.GetUserByID(token.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if user.IsDisabled() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This account has been disabled"})
+		return
+	}
+
+	if err := models.TouchAPIToken(token, c.ClientIP()); err != nil {
+		log.Printf("Failed to update API token usage: %v", err)
+	}
+
+	c.Set("user", user)
+	c.Set("userID", user.ID)
+	c.Set("apiToken", token)
+	c.Next()
+}
+
 func GetCurrentUser(c *gin.Context) *models.User {
 	user, exists := c.Get("user")
 	if !exists {
@@ -96,6 +199,14 @@ func GetCurrentUser(c *gin.Context) *models.User {
 	return user.(*models.User)
 }
 
+func GetCurrentSessionID(c *gin.Context) int64 {
+	sessionID, exists := c.Get("authSessionID")
+	if !exists {
+		return 0
+	}
+	return sessionID.(int64)
+}
+
 func GetCurrentUserID(c *gin.Context) int64 {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -103,3 +214,24 @@ func GetCurrentUserID(c *gin.Context) int64 {
 	}
 	return userID.(int64)
 }
+
+// GetCurrentAPIToken returns the API token the request was made with, or nil
+// for session requests.
+func GetCurrentAPIToken(c *gin.Context) *models.APIToken {
+	token, exists := c.Get("apiToken")
+	if !exists {
+		return nil
+	}
+	return token.(*models.APIToken)
+}
+
+// RequireAdmin limits a route to admins. It must run after AuthMiddleware.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user := GetCurrentUser(c); user == nil || !user.IsAdmin() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
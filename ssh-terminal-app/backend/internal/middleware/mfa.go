@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// MFAPurposeVerify lets the holder finish a login with a second factor.
+	MFAPurposeVerify = "verify"
+	// MFAPurposeEnroll lets the holder enroll a second factor when MFA is
+	// required but the account has none yet.
+	MFAPurposeEnroll = "enroll"
+
+	// MFATokenTTL bounds how long the second login step may take.
+	MFATokenTTL = 5 * time.Minute
+
+	mfaTokenAudience = "mfa"
+)
+
+// MFAClaims identify a user who passed the password step of a login. They
+// carry no session, so AuthMiddleware never accepts them as access tokens.
+type MFAClaims struct {
+	UserID  int64  `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+func GenerateMFAToken(userID int64, purpose string) (string, error) {
+	now := time.Now()
+	claims := &MFAClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFATokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "ssh-terminal-app",
+			Audience:  jwt.ClaimStrings{mfaTokenAudience},
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+func ParseMFAToken(tokenString, purpose string) (*MFAClaims, error) {
+	claims := &MFAClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(mfaTokenAudience))
+	if err != nil || !token.Valid || claims.Purpose != purpose {
+		return nil, errors.New("invalid or expired MFA token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// OAuthStateTTL bounds how long the user may spend at the identity provider.
+	OAuthStateTTL = 10 * time.Minute
+
+	oauthStateAudience = "oauth-state"
+)
+
+// OAuthStateClaims hold the per-login secrets of an authorization code flow.
+// They travel in a signed cookie, so the callback can only be completed by
+// the browser that started the login.
+type OAuthStateClaims struct {
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	jwt.RegisteredClaims
+}
+
+func GenerateOAuthStateToken(provider, state, nonce, codeVerifier string) (string, error) {
+	now := time.Now()
+	claims := &OAuthStateClaims{
+		Provider:     provider,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(OAuthStateTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "ssh-terminal-app",
+			Audience:  jwt.ClaimStrings{oauthStateAudience},
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+func ParseOAuthStateToken(tokenString string) (*OAuthStateClaims, error) {
+	claims := &OAuthStateClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(oauthStateAudience))
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired OAuth state")
+	}
+	return claims, nil
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"ssh-terminal-app/internal/ratelimit"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ByIP keys rate limits on the client address.
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser keys rate limits on the authenticated user. It must run after
+// AuthMiddleware.
+func ByUser(c *gin.Context) string {
+	return "user:" + strconv.FormatInt(GetCurrentUserID(c), 10)
+}
+
+// RateLimit rejects requests once the bucket picked by key runs dry. scope
+// keeps the buckets of different endpoints apart.
+func RateLimit(scope string, limit *ratelimit.Limit, key func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, retryAfter := ratelimit.Allow(scope+":"+key(c), limit); !ok {
+			AbortTooManyRequests(c, retryAfter, "Too many requests, please try again later")
+			return
+		}
+		c.Next()
+	}
+}
+
+// AbortTooManyRequests answers 429 with a Retry-After header.
+func AbortTooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       message,
+		"retry_after": seconds,
+	})
+}
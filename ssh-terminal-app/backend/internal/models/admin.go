@@ -0,0 +1,132 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 200
+)
+
+var (
+	ErrUserDisabled = errors.New("this account has been disabled")
+	ErrLastAdmin    = errors.New("at least one active admin must remain")
+)
+
+// adminEmails are the addresses from ADMIN_EMAILS. Their accounts become
+// admins once the address is verified, which bootstraps the first admin.
+var adminEmails []string
+
+// InitAdmins reads ADMIN_EMAILS and promotes the matching existing accounts.
+func InitAdmins() error {
+	adminEmails = nil
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			adminEmails = append(adminEmails, email)
+		}
+	}
+	if len(adminEmails) == 0 {
+		return nil
+	}
+
+	if err := repo.PromoteAdmins(0, adminEmails); err != nil {
+		return err
+	}
+
+	admins, err := repo.CountAdmins()
+	if err != nil {
+		return err
+	}
+	if admins == 0 {
+		log.Printf("No admin yet: ADMIN_EMAILS accounts are promoted once their email is verified")
+	}
+	return nil
+}
+
+// IsConfiguredAdmin reports whether email is listed in ADMIN_EMAILS.
+func IsConfiguredAdmin(email string) bool {
+	return slices.Contains(adminEmails, strings.ToLower(strings.TrimSpace(email)))
+}
+
+// AdminUser is the admin listing view of a user.
+type AdminUser struct {
+	User
+	MFAEnabled bool       `json:"mfa_enabled"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+type UserFilter struct {
+	Search string // matches email or name
+	Role   string // "user" or "admin"
+	Status string // "active" or "disabled"
+	Cursor string
+	Limit  int
+}
+
+type UserPage struct {
+	Users      []AdminUser
+	NextCursor string
+}
+
+// ListUsers returns one page of users, newest first.
+func ListUsers(filter UserFilter) (*UserPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultUserPageSize
+	}
+	if filter.Limit > MaxUserPageSize {
+		filter.Limit = MaxUserPageSize
+	}
+	return repo.ListUsers(filter)
+}
+
+func SetUserDisabled(userID int64, disabled bool) (*User, error) {
+	var disabledAt *time.Time
+	if disabled {
+		now := dbNow()
+		disabledAt = &now
+	}
+	if err := repo.SetUserDisabled(userID, disabledAt); err != nil {
+		return nil, err
+	}
+	return GetUserByID(userID)
+}
+
+func SetUserRole(userID int64, role string) (*User, error) {
+	if role != RoleUser && role != RoleAdmin {
+		return nil, invalidInput("Role must be %q or %q", RoleUser, RoleAdmin)
+	}
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == RoleUser && user.IsAdmin() && IsConfiguredAdmin(user.Email) {
+		return nil, invalidInput("This admin is configured with ADMIN_EMAILS")
+	}
+	if err := repo.SetUserRole(userID, role); err != nil {
+		return nil, err
+	}
+	return GetUserByID(userID)
+}
+
+// ResetUserMFA removes every second factor of the user so they can enroll
+// again.
+func ResetUserMFA(userID int64) error {
+	return repo.ResetUserMFA(userID)
+}
+
+// DeleteUser removes the user; their connections, sessions and tokens go
+// with them through the foreign keys.
+func DeleteUser(userID int64) error {
+	return repo.DeleteUser(userID)
+}
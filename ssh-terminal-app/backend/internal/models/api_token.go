@@ -0,0 +1,187 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"ssh-terminal-app/internal/crypto"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix marks personal access tokens so they can be told apart from
+// session JWTs and recognised by secret scanners.
+const APITokenPrefix = "sshp_"
+
+const (
+	ScopeConnectionsRead  = "connections:read"
+	ScopeConnectionsWrite = "connections:write"
+	ScopeExec             = "exec"
+	ScopeTerminal         = "terminal"
+)
+
+var APITokenScopes = []string{ScopeConnectionsRead, ScopeConnectionsWrite, ScopeExec, ScopeTerminal}
+
+const maxAPITokensPerUser = 50
+
+var (
+	ErrAPITokenNotFound = errors.New("API token not found")
+	ErrInvalidAPIToken  = errors.New("invalid or expired API token")
+)
+
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+}
+
+type APITokenInput struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+const apiTokenColumns = "id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at, last_used_ip"
+
+func scanAPIToken(row rowScanner, t *APIToken) error {
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+	var lastUsedIP sql.NullString
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &scopes, &t.CreatedAt, &expiresAt, &lastUsedAt, &lastUsedIP); err != nil {
+		return err
+	}
+	t.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	t.LastUsedIP = lastUsedIP.String
+	return nil
+}
+
+func normalizeAPITokenInput(input APITokenInput) (APITokenInput, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return input, invalidInput("Token name is required")
+	}
+	if len(input.Name) > 100 {
+		return input, invalidInput("Token name must be at most 100 characters")
+	}
+
+	if len(input.Scopes) == 0 {
+		return input, invalidInput("At least one scope is required")
+	}
+	var scopes []string
+	for _, scope := range input.Scopes {
+		if !slices.Contains(APITokenScopes, scope) {
+			return input, invalidInput("Unknown scope %q", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	input.Scopes = scopes
+
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(time.Now()) {
+			return input, invalidInput("Expiry must be in the future")
+		}
+		expiresAt := input.ExpiresAt.UTC().Truncate(time.Second)
+		input.ExpiresAt = &expiresAt
+	}
+	return input, nil
+}
+
+// CreateAPIToken issues a personal access token. The secret is returned only
+// here; the database keeps its hash and a short prefix for display.
+func CreateAPIToken(userID int64, input APITokenInput) (*APIToken, string, error) {
+	input, err := normalizeAPITokenInput(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	count, err := repo.CountAPITokens(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if count >= maxAPITokensPerUser {
+		return nil, "", invalidInput("A user can have at most %d API tokens", maxAPITokensPerUser)
+	}
+
+	secret, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := APITokenPrefix + secret
+
+	id, err := repo.CreateAPIToken(&APIToken{
+		UserID:    userID,
+		Name:      input.Name,
+		Prefix:    token[:len(APITokenPrefix)+6],
+		Scopes:    input.Scopes,
+		CreatedAt: dbNow(),
+		ExpiresAt: input.ExpiresAt,
+	}, crypto.HashToken(token))
+	if err != nil {
+		return nil, "", err
+	}
+	t, err := GetAPITokenByID(id, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, token, nil
+}
+
+func GetAPITokens(userID int64) ([]APIToken, error) {
+	return repo.GetAPITokens(userID)
+}
+
+func GetAPITokenByID(id, userID int64) (*APIToken, error) {
+	return repo.GetAPIToken(id, userID)
+}
+
+func DeleteAPIToken(id, userID int64) error {
+	return repo.DeleteAPIToken(id, userID)
+}
+
+// AuthenticateAPIToken resolves a presented token, rejecting unknown and
+// expired ones.
+func AuthenticateAPIToken(token string) (*APIToken, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	t, err := repo.GetAPITokenByHash(crypto.HashToken(token))
+	if err == ErrAPITokenNotFound {
+		return nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt) {
+		return nil, ErrInvalidAPIToken
+	}
+	return t, nil
+}
+
+// TouchAPIToken records token usage, at most once a minute per token to keep
+// scripted bursts from turning into a write per request.
+func TouchAPIToken(t *APIToken, ip string) error {
+	now := dbNow()
+	if t.LastUsedAt != nil && now.Sub(*t.LastUsedAt) < time.Minute && t.LastUsedIP == ip {
+		return nil
+	}
+	return repo.TouchAPIToken(t.ID, ip, now)
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	SettingMFARequired               = "mfa_required"
+	SettingEmailVerificationRequired = "email_verification_required"
+)
+
+// settingEnv maps settings to the environment variables that override them.
+var settingEnv = map[string]string{
+	SettingMFARequired:               "MFA_REQUIRED",
+	SettingEmailVerificationRequired: "EMAIL_VERIFICATION_REQUIRED",
+}
+
+// InitSettings applies settings given in the environment. An environment value
+// wins over the stored one on every start, so operators can enforce it.
+func InitSettings() error {
+	for key, env := range settingEnv {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		value, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		if err := SetBoolSetting(key, value); err != nil {
+			return err
+		}
+	}
+	return initDurationSettings()
+}
+
+func GetSetting(key string) (string, bool, error) {
+	return repo.GetSetting(key)
+}
+
+func SetSetting(key, value string) error {
+	return repo.SetSetting(key, value, dbNow())
+}
+
+func GetBoolSetting(key string) (bool, error) {
+	value, ok, err := GetSetting(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return strconv.ParseBool(value)
+}
+
+func SetBoolSetting(key string, value bool) error {
+	return SetSetting(key, strconv.FormatBool(value))
+}
+
+func GetIntSetting(key string, fallback int) (int, error) {
+	value, ok, err := GetSetting(key)
+	if err != nil || !ok {
+		return fallback, err
+	}
+	return strconv.Atoi(value)
+}
+
+func SetIntSetting(key string, value int) error {
+	return SetSetting(key, strconv.Itoa(value))
+}
+
+// IsMFARequired reports whether every local account must use two-factor
+// authentication.
+func IsMFARequired() (bool, error) {
+	return GetBoolSetting(SettingMFARequired)
+}
+
+// IsEmailVerificationRequired reports whether local accounts must verify
+// their email address before they can log in.
+func IsEmailVerificationRequired() (bool, error) {
+	return GetBoolSetting(SettingEmailVerificationRequired)
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"errors"
+	"ssh-terminal-app/internal/crypto"
+	"time"
+)
+
+// AuthExchangeCodeTTL bounds the time between the identity provider callback
+// and the frontend redeeming its code.
+const AuthExchangeCodeTTL = time.Minute
+
+var ErrInvalidExchangeCode = errors.New("invalid or expired exchange code")
+
+// CreateAuthExchangeCode issues a single-use code for a user who finished an
+// identity provider login. Only its hash is stored.
+func CreateAuthExchangeCode(userID int64) (string, error) {
+	code, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := dbNow()
+	if err := repo.CreateAuthExchangeCode(crypto.HashToken(code), userID, now, now.Add(AuthExchangeCodeTTL)); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// TakeAuthExchangeCode redeems a code and returns its user id.
+func TakeAuthExchangeCode(code string) (int64, error) {
+	if code == "" {
+		return 0, ErrInvalidExchangeCode
+	}
+
+	return repo.TakeAuthExchangeCode(crypto.HashToken(code), dbNow())
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"ssh-terminal-app/internal/crypto"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrAuthSessionNotFound = errors.New("session not found")
+)
+
+// AuthSession is one login of a user on a device. Every refresh token issued
+// for the login belongs to the session, so revoking the session revokes the
+// whole refresh token family along with its access tokens.
+type AuthSession struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	UserAgent    string     `json:"user_agent"`
+	IPAddress    string     `json:"ip_address"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastSeenAt   time.Time  `json:"last_seen_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason *string    `json:"revoke_reason,omitempty"`
+}
+
+func (s *AuthSession) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+func dbNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+const authSessionColumns = `id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at, revoke_reason`
+
+func scanAuthSession(row rowScanner, s *AuthSession) error {
+	var revokedAt sql.NullTime
+	var revokeReason sql.NullString
+	var userAgent sql.NullString
+	var ipAddress sql.NullString
+	err := row.Scan(&s.ID, &s.UserID, &userAgent, &ipAddress, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &revokedAt, &revokeReason)
+	if err != nil {
+		return err
+	}
+	s.UserAgent = userAgent.String
+	s.IPAddress = ipAddress.String
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+	if revokeReason.Valid {
+		s.RevokeReason = &revokeReason.String
+	}
+	return nil
+}
+
+// RefreshToken is a stored refresh token of a session.
+type RefreshToken struct {
+	ID        int64
+	SessionID int64
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// CreateAuthSession starts a login session and returns it together with its
+// first refresh token.
+func CreateAuthSession(userID int64, userAgent, ipAddress string, ttl time.Duration) (*AuthSession, string, error) {
+	refreshToken, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := dbNow()
+	id, err := repo.CreateAuthSession(userID, userAgent, ipAddress, crypto.HashToken(refreshToken), now, now.Add(ttl))
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := GetAuthSessionByID(id)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, refreshToken, nil
+}
+
+func GetAuthSessionByID(id int64) (*AuthSession, error) {
+	return repo.GetAuthSession(id)
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one. Presenting a
+// token that was already exchanged means it leaked, so the whole session is
+// revoked and ErrRefreshTokenReused is returned.
+func RotateRefreshToken(token string, ttl time.Duration) (*AuthSession, string, error) {
+	stored, err := repo.GetRefreshToken(crypto.HashToken(token))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if stored.UsedAt != nil {
+		return nil, "", revokeReusedRefreshToken(stored.SessionID)
+	}
+
+	session, err := GetAuthSessionByID(stored.SessionID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !session.IsActive() || time.Now().After(stored.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	newToken, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := dbNow()
+	err = repo.RotateRefreshToken(stored, crypto.HashToken(newToken), now, now.Add(ttl))
+	if err == ErrRefreshTokenReused {
+		// A concurrent exchange of the same token won the race.
+		return nil, "", revokeReusedRefreshToken(stored.SessionID)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err = GetAuthSessionByID(stored.SessionID)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, newToken, nil
+}
+
+func revokeReusedRefreshToken(sessionID int64) error {
+	if err := RevokeAuthSessionByID(sessionID, "refresh_token_reuse"); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// FindAuthSessionByRefreshToken returns the session a refresh token belongs
+// to, whether or not the token is still valid.
+func FindAuthSessionByRefreshToken(token string) (*AuthSession, error) {
+	stored, err := repo.GetRefreshToken(crypto.HashToken(token))
+	if err == ErrInvalidRefreshToken {
+		return nil, ErrAuthSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetAuthSessionByID(stored.SessionID)
+}
+
+// TouchAuthSession updates last_seen_at, at most once a minute.
+func TouchAuthSession(s *AuthSession) error {
+	now := dbNow()
+	if now.Sub(s.LastSeenAt) < time.Minute {
+		return nil
+	}
+	return repo.TouchAuthSession(s.ID, now)
+}
+
+func GetActiveAuthSessions(userID int64) ([]AuthSession, error) {
+	return repo.GetActiveAuthSessions(userID, dbNow())
+}
+
+func RevokeAuthSessionByID(id int64, reason string) error {
+	return repo.RevokeAuthSession(id, reason, dbNow())
+}
+
+// RevokeAuthSession revokes one of the user's sessions.
+func RevokeAuthSession(id, userID int64, reason string) error {
+	return repo.RevokeUserAuthSession(id, userID, reason, dbNow())
+}
+
+// RevokeAllAuthSessions revokes every session of the user except exceptID
+// (pass 0 to revoke all).
+func RevokeAllAuthSessions(userID, exceptID int64, reason string) error {
+	return repo.RevokeUserAuthSessions(userID, exceptID, reason, dbNow())
+}
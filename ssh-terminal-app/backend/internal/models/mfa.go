@@ -0,0 +1,216 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"ssh-terminal-app/internal/crypto"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidMFACode      = errors.New("invalid verification code")
+	ErrTOTPAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrTOTPEnrollmentEmpty = errors.New("no pending two-factor enrollment")
+)
+
+const recoveryCodeCount = 10
+
+type MFAStatus struct {
+	TOTPEnabled            bool       `json:"totp_enabled"`
+	TOTPEnabledAt          *time.Time `json:"totp_enabled_at"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+	WebAuthnCredentials    int        `json:"webauthn_credentials"`
+	Required               bool       `json:"required"`
+}
+
+// TOTPState is the stored TOTP configuration of a user. The secret is set
+// but EnabledAt is nil while an enrollment awaits confirmation.
+type TOTPState struct {
+	SecretEncrypted *string
+	EnabledAt       *time.Time
+	LastCounter     *int64
+}
+
+func IsTOTPEnabled(userID int64) (bool, error) {
+	state, err := repo.GetTOTPState(userID)
+	if err != nil {
+		return false, err
+	}
+	return state.EnabledAt != nil, nil
+}
+
+func GetMFAStatus(userID int64) (*MFAStatus, error) {
+	state, err := repo.GetTOTPState(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MFAStatus{TOTPEnabled: state.EnabledAt != nil, TOTPEnabledAt: state.EnabledAt}
+
+	status.RecoveryCodesRemaining, err = repo.CountRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status.WebAuthnCredentials, err = repo.CountWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status.Required, err = IsMFARequired()
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// BeginTOTPEnrollment generates a new secret for the user. It only takes
+// effect once ConfirmTOTPEnrollment sees a valid code for it, so an abandoned
+// enrollment leaves the account unchanged.
+func BeginTOTPEnrollment(userID int64) (string, error) {
+	enabled, err := IsTOTPEnabled(userID)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return "", ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := crypto.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := crypto.Encrypt(secret)
+	if err != nil {
+		return "", err
+	}
+
+	if err := repo.SetPendingTOTPSecret(userID, encrypted); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// ConfirmTOTPEnrollment enables TOTP if code matches the pending secret and
+// returns a fresh set of recovery codes.
+func ConfirmTOTPEnrollment(userID int64, code string) ([]string, error) {
+	state, err := repo.GetTOTPState(userID)
+	if err != nil {
+		return nil, err
+	}
+	if state.EnabledAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if state.SecretEncrypted == nil {
+		return nil, ErrTOTPEnrollmentEmpty
+	}
+
+	secret, err := crypto.Decrypt(*state.SecretEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	counter, ok := crypto.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.EnableTOTP(userID, counter, hashes, dbNow()); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyTOTPCode checks a code from the user's authenticator. Each time step
+// is accepted at most once, so an observed code cannot be replayed.
+func VerifyTOTPCode(userID int64, code string) error {
+	state, err := repo.GetTOTPState(userID)
+	if err != nil {
+		return err
+	}
+	if state.EnabledAt == nil || state.SecretEncrypted == nil {
+		return ErrTOTPNotEnabled
+	}
+
+	secret, err := crypto.Decrypt(*state.SecretEncrypted)
+	if err != nil {
+		return err
+	}
+	counter, ok := crypto.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return repo.AdvanceTOTPCounter(userID, counter)
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes.
+func UseRecoveryCode(userID int64, code string) error {
+	return repo.UseRecoveryCode(userID, crypto.HashToken(normalizeRecoveryCode(code)), dbNow())
+}
+
+// RegenerateRecoveryCodes invalidates the user's recovery codes and returns a
+// new set.
+func RegenerateRecoveryCodes(userID int64) ([]string, error) {
+	enabled, err := IsTOTPEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrTOTPNotEnabled
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.ReplaceRecoveryCodes(userID, hashes, dbNow()); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func DisableTOTP(userID int64) error {
+	return repo.DisableTOTP(userID)
+}
+
+// generateRecoveryCodes returns a set of recovery codes with the hashes they
+// are stored by.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code
+		hashes[i] = crypto.HashToken(normalizeRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// Recovery codes avoid look-alike characters since they are typed by hand.
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = recoveryCodeAlphabet[n.Int64()]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
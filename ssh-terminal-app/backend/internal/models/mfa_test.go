@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"ssh-terminal-app/internal/crypto"
+	"testing"
+	"time"
+)
+
+func TestVerifyTOTPCodeRejectsReplay(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+	if err := crypto.InitEncryption(); err != nil {
+		t.Fatal(err)
+	}
+
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		saved := repo
+		repo = r
+		t.Cleanup(func() { repo = saved })
+
+		userID := createRepoUser(t, r)
+		secret, err := BeginTOTPEnrollment(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := func(offset int64) string {
+			t.Helper()
+			code, err := crypto.TOTPCode(secret, crypto.TOTPCounter(time.Now())+offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return code
+		}
+
+		// Enrolling uses up the current step.
+		enrolled := code(0)
+		if _, err := ConfirmTOTPEnrollment(userID, enrolled); err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyTOTPCode(userID, enrolled); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("VerifyTOTPCode with the enrollment code = %v, want ErrInvalidMFACode", err)
+		}
+
+		next := code(1)
+		if err := VerifyTOTPCode(userID, next); err != nil {
+			t.Fatalf("VerifyTOTPCode with the next step's code = %v", err)
+		}
+		if err := VerifyTOTPCode(userID, next); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("VerifyTOTPCode replay = %v, want ErrInvalidMFACode", err)
+		}
+		if err := VerifyTOTPCode(userID, code(-1)); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("VerifyTOTPCode with an earlier step's code = %v, want ErrInvalidMFACode", err)
+		}
+	})
+}
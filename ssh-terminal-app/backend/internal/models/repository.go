@@ -0,0 +1,291 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"ssh-terminal-app/internal/database"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	ErrConnectionNotFound = errors.New("connection not found")
+	ErrEmailTaken         = errors.New("email is already registered")
+)
+
+// UserRepository stores user accounts.
+type UserRepository interface {
+	CreateUser(email, passwordHash, name string) (int64, error)
+	// GetUserByID and GetUserByEmail return ErrUserNotFound for unknown users.
+	GetUserByID(id int64) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	SetUserPasswordHash(userID int64, passwordHash string) error
+	// MarkEmailVerified only applies while the account still has email.
+	MarkEmailVerified(userID int64, email string, at time.Time) error
+	// PromoteAdmins makes admins of the users whose verified email is one of
+	// emails; userID 0 checks every user.
+	PromoteAdmins(userID int64, emails []string) error
+	CountAdmins() (int, error)
+	// ListUsers expects a filter with Limit set.
+	ListUsers(filter UserFilter) (*UserPage, error)
+	// SetUserDisabled, SetUserRole and DeleteUser return ErrUserNotFound for
+	// unknown users and ErrLastAdmin rather than leave no active admin.
+	SetUserDisabled(userID int64, disabledAt *time.Time) error
+	SetUserRole(userID int64, role string) error
+	DeleteUser(userID int64) error
+}
+
+// IdentityRepository stores the links between users and accounts at
+// external identity providers.
+type IdentityRepository interface {
+	GetUserIdentities(userID int64) ([]UserIdentity, error)
+	// FindOrCreateIdentityUser returns the user linked to identity, linking or
+	// creating one as FindOrCreateUserForIdentity describes. A new link
+	// promotes the user like PromoteAdmins.
+	FindOrCreateIdentityUser(identity ExternalIdentity, adminEmails []string, at time.Time) (int64, error)
+}
+
+// AuthSessionRepository stores login sessions and their refresh tokens.
+// Tokens are stored and looked up by hash.
+type AuthSessionRepository interface {
+	CreateAuthSession(userID int64, userAgent, ipAddress, refreshTokenHash string, at, expiresAt time.Time) (int64, error)
+	// GetAuthSession returns ErrAuthSessionNotFound for unknown sessions.
+	GetAuthSession(id int64) (*AuthSession, error)
+	// GetRefreshToken returns ErrInvalidRefreshToken for unknown tokens.
+	GetRefreshToken(tokenHash string) (*RefreshToken, error)
+	// RotateRefreshToken marks the token used, issues its successor and
+	// extends the session until expiresAt. It returns ErrRefreshTokenReused if
+	// the token was used already.
+	RotateRefreshToken(token *RefreshToken, newTokenHash string, at, expiresAt time.Time) error
+	TouchAuthSession(id int64, at time.Time) error
+	// GetActiveAuthSessions returns the sessions most recently seen first.
+	GetActiveAuthSessions(userID int64, at time.Time) ([]AuthSession, error)
+	RevokeAuthSession(id int64, reason string, at time.Time) error
+	// RevokeUserAuthSession returns ErrAuthSessionNotFound unless the user
+	// has the session and it is not revoked yet.
+	RevokeUserAuthSession(id, userID int64, reason string, at time.Time) error
+	// RevokeUserAuthSessions revokes all of the user's sessions but exceptID.
+	RevokeUserAuthSessions(userID, exceptID int64, reason string, at time.Time) error
+}
+
+// APITokenRepository stores personal access tokens by hash.
+type APITokenRepository interface {
+	CountAPITokens(userID int64) (int, error)
+	CreateAPIToken(token *APIToken, tokenHash string) (int64, error)
+	// GetAPITokens returns the user's tokens newest first.
+	GetAPITokens(userID int64) ([]APIToken, error)
+	// GetAPIToken, GetAPITokenByHash and DeleteAPIToken return
+	// ErrAPITokenNotFound for unknown tokens.
+	GetAPIToken(id, userID int64) (*APIToken, error)
+	GetAPITokenByHash(tokenHash string) (*APIToken, error)
+	DeleteAPIToken(id, userID int64) error
+	TouchAPIToken(id int64, ip string, at time.Time) error
+}
+
+// OneTimeTokenRepository stores single-use secrets: email verification and
+// password reset tokens, identity provider exchange codes and WebAuthn
+// ceremonies. Taking one removes or spends it, so it works only once.
+type OneTimeTokenRepository interface {
+	// CreateUserToken also spends the user's unused tokens for purpose.
+	CreateUserToken(userID int64, purpose, tokenHash, email string, at, expiresAt time.Time) error
+	// ConsumeUserToken returns ErrInvalidUserToken unless the token is
+	// unused, unexpired and the account still has its email.
+	ConsumeUserToken(tokenHash, purpose string, at time.Time) (*UserToken, error)
+	CreateAuthExchangeCode(codeHash string, userID int64, at, expiresAt time.Time) error
+	// TakeAuthExchangeCode returns ErrInvalidExchangeCode for unknown and
+	// expired codes.
+	TakeAuthExchangeCode(codeHash string, at time.Time) (int64, error)
+	SaveWebAuthnCeremony(ceremony *WebAuthnCeremony, at time.Time) error
+	// TakeWebAuthnCeremony returns ErrWebAuthnCeremonyNotFound for unknown
+	// and expired ceremonies.
+	TakeWebAuthnCeremony(id, purpose string, at time.Time) (*WebAuthnCeremony, error)
+}
+
+// MFARepository stores TOTP secrets and recovery codes, the latter by hash.
+type MFARepository interface {
+	// GetTOTPState returns ErrUserNotFound for unknown users.
+	GetTOTPState(userID int64) (*TOTPState, error)
+	// SetPendingTOTPSecret replaces the secret and disables TOTP until
+	// EnableTOTP confirms it.
+	SetPendingTOTPSecret(userID int64, secretEncrypted string) error
+	EnableTOTP(userID int64, counter int64, recoveryCodeHashes []string, at time.Time) error
+	// AdvanceTOTPCounter returns ErrInvalidMFACode unless counter is past the
+	// last accepted one.
+	AdvanceTOTPCounter(userID int64, counter int64) error
+	// DisableTOTP also removes the recovery codes.
+	DisableTOTP(userID int64) error
+	// ResetUserMFA removes TOTP, recovery codes and WebAuthn credentials. It
+	// returns ErrUserNotFound for unknown users.
+	ResetUserMFA(userID int64) error
+	CountRecoveryCodes(userID int64) (int, error)
+	ReplaceRecoveryCodes(userID int64, codeHashes []string, at time.Time) error
+	// UseRecoveryCode returns ErrInvalidMFACode unless the code is unused.
+	UseRecoveryCode(userID int64, codeHash string, at time.Time) error
+}
+
+// WebAuthnRepository stores WebAuthn user handles and credentials.
+type WebAuthnRepository interface {
+	// GetWebAuthnUserHandle returns "" until the user has a handle.
+	GetWebAuthnUserHandle(userID int64) (string, error)
+	// SetWebAuthnUserHandle only sets a missing handle and returns the one
+	// stored.
+	SetWebAuthnUserHandle(userID int64, handle string) (string, error)
+	// GetUserIDByWebAuthnHandle returns ErrWebAuthnCredentialNotFound for
+	// unknown handles.
+	GetUserIDByWebAuthnHandle(handle string) (int64, error)
+	CountWebAuthnCredentials(userID int64) (int, error)
+	// GetWebAuthnCredentialData returns the key material, oldest first.
+	GetWebAuthnCredentialData(userID int64) ([]webauthn.Credential, error)
+	// GetWebAuthnCredentials returns the listing views, oldest first.
+	GetWebAuthnCredentials(userID int64) ([]WebAuthnCredential, error)
+	CreateWebAuthnCredential(userID int64, name string, credential *webauthn.Credential, at time.Time) (int64, error)
+	// UpdateWebAuthnCredential stores the credential's state after use.
+	UpdateWebAuthnCredential(userID int64, credential *webauthn.Credential, at time.Time) error
+	// RenameWebAuthnCredential and DeleteWebAuthnCredential return
+	// ErrWebAuthnCredentialNotFound unless the user has the credential.
+	RenameWebAuthnCredential(id, userID int64, name string) error
+	DeleteWebAuthnCredential(id, userID int64) error
+}
+
+// TeamRepository stores teams, their memberships and session limits.
+type TeamRepository interface {
+	// GetUserTeams returns the user's teams by name.
+	GetUserTeams(userID int64) ([]Team, error)
+	// SyncUserTeams replaces the user's memberships from source, creating
+	// missing teams.
+	SyncUserTeams(userID int64, source string, names []string, at time.Time) error
+	// GetTeamSessionPolicies returns the policies of every team, or of the
+	// user's teams when userID is not 0, by team name.
+	GetTeamSessionPolicies(userID int64) ([]TeamSessionPolicy, error)
+	// SetTeamSessionPolicy returns sql.ErrNoRows for unknown teams.
+	SetTeamSessionPolicy(teamID int64, idleTimeout, maxSessionDuration *int) error
+}
+
+// SettingRepository stores application settings as strings.
+type SettingRepository interface {
+	// GetSetting reports whether the setting is stored.
+	GetSetting(key string) (string, bool, error)
+	SetSetting(key, value string, at time.Time) error
+}
+
+// FolderRepository stores the folders connections are organized in.
+type FolderRepository interface {
+	// GetFolders returns the user's folders without their paths.
+	GetFolders(userID int64) ([]Folder, error)
+	CreateFolder(userID int64, parentID *int64, name string) (int64, error)
+	UpdateFolder(id, userID int64, parentID *int64, name string) error
+	// DeleteFolder removes the folder with its subfolders and moves their
+	// connections to the root. It returns ErrFolderNotFound unless the user
+	// owns the folder.
+	DeleteFolder(id, userID int64) error
+}
+
+// TemplateRepository stores connection templates.
+type TemplateRepository interface {
+	CreateTemplate(userID int64, rec *TemplateRecord) (int64, error)
+	// GetTemplate returns ErrTemplateNotFound unless the user owns it.
+	GetTemplate(id, userID int64) (*SSHTemplate, error)
+	// GetTemplates returns the user's templates by name.
+	GetTemplates(userID int64) ([]SSHTemplate, error)
+	// UpdateTemplate keeps the stored secrets that rec leaves nil.
+	UpdateTemplate(id, userID int64, rec *TemplateRecord) error
+	// DeleteTemplate returns ErrTemplateNotFound unless the user owns it and
+	// ErrTemplateInUse while connections use it.
+	DeleteTemplate(id, userID int64) error
+	CountTemplateConnections(id, userID int64) (int, error)
+}
+
+// ConnectionRepository stores SSH connections with their tags and
+// favorites. Connections are returned as stored, with tags loaded; templates
+// are applied by the caller.
+type ConnectionRepository interface {
+	CreateConnection(userID int64, rec *ConnectionRecord, tags []string) (int64, error)
+	// GetConnection returns ErrConnectionNotFound unless the user owns it.
+	GetConnection(id, userID int64) (*SSHConnection, error)
+	// ListConnections expects a filter with Sort, Order and Limit set.
+	ListConnections(userID int64, filter SSHConnectionFilter) (*SSHConnectionPage, error)
+	// UpdateConnection replaces the tags unless tags is nil.
+	UpdateConnection(id, userID int64, rec *ConnectionRecord, tags []string) error
+	DeleteConnection(id, userID int64) error
+	GetUserTags(userID int64) (map[string]int, error)
+	SetFavorite(id, userID int64, favorite bool) error
+	TouchConnection(id, userID int64, at time.Time) error
+}
+
+// SessionRepository stores the terminal session history. Sessions are tagged
+// with the node that runs them, so replicas sharing a database only clean up
+// their own.
+type SessionRepository interface {
+	StartSession(userID, connectionID int64, node string, at time.Time) (int64, error)
+	EndSession(id int64, status string, errMsg *string, at time.Time) error
+	CloseStaleSessions(node string, at time.Time) error
+	// GetConnectionSessions returns the sessions oldest first.
+	GetConnectionSessions(connectionID, userID int64) ([]SSHSession, error)
+	// GetConnectionStats totals the connection's session history. It leaves
+	// IsFavorite and AverageSessionSeconds to the caller.
+	GetConnectionStats(connectionID, userID int64) (*SSHConnectionStats, error)
+}
+
+// Repository bundles the repositories of one storage backend. The models
+// reach the database only through it.
+type Repository interface {
+	UserRepository
+	IdentityRepository
+	AuthSessionRepository
+	APITokenRepository
+	OneTimeTokenRepository
+	MFARepository
+	WebAuthnRepository
+	TeamRepository
+	SettingRepository
+	FolderRepository
+	TemplateRepository
+	ConnectionRepository
+	SessionRepository
+}
+
+var repo Repository
+
+// NodeID identifies this server process among replicas sharing a database.
+var NodeID string
+
+// InitRepository selects the repository matching database.Driver. NODE_ID
+// names this replica and defaults to the host name.
+func InitRepository() error {
+	switch database.Driver {
+	case database.DriverSQLite:
+		repo = NewSQLiteRepository(database.DB)
+	case database.DriverPostgres:
+		repo = NewPostgresRepository(database.DB)
+	default:
+		return fmt.Errorf("no repository for database driver %q", database.Driver)
+	}
+
+	NodeID = os.Getenv("NODE_ID")
+	if NodeID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		NodeID = hostname
+	}
+	return nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// insertID runs an INSERT and returns the new row's id. RETURNING works on
+// both SQLite and PostgreSQL, unlike sql.Result.LastInsertId.
+func insertID(q queryer, query string, args ...any) (int64, error) {
+	var id int64
+	err := q.QueryRow(query+` RETURNING id`, args...).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pgUniqueViolation is the SQLSTATE of a unique constraint failure.
+const pgUniqueViolation = "23505"
+
+// NewPostgresRepository stores everything in the PostgreSQL database db,
+// which may be shared by several server replicas.
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &sqlRepository{
+		db:                db,
+		isUniqueViolation: isPostgresUniqueViolation,
+		sessionSeconds:    `FLOOR(EXTRACT(EPOCH FROM ended_at - started_at))`,
+		forUpdate:         ` FOR UPDATE`,
+	}
+}
+
+func isPostgresUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
@@ -0,0 +1,776 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlRepository implements Repository on database/sql. The SQLite and
+// PostgreSQL repositories share its queries, which stick to the SQL both
+// understand, and differ in how the driver reports errors.
+type sqlRepository struct {
+	db *sql.DB
+	// isUniqueViolation reports whether err is a unique constraint failure.
+	isUniqueViolation func(err error) bool
+	// sessionSeconds is the SQL expression for the whole seconds between an
+	// ssh_sessions row's started_at and ended_at.
+	sessionSeconds string
+	// forUpdate follows a SELECT to lock the rows it reads until the
+	// transaction ends. SQLite needs none, as it runs one writer at a time.
+	forUpdate string
+}
+
+func (r *sqlRepository) CreateUser(email, passwordHash, name string) (int64, error) {
+	id, err := insertID(r.db,
+		`INSERT INTO users (email, password_hash, name) VALUES (?, ?, ?)`,
+		email, passwordHash, name,
+	)
+	if err != nil && r.isUniqueViolation(err) {
+		return 0, ErrEmailTaken
+	}
+	return id, err
+}
+
+func (r *sqlRepository) getUser(where string, arg any) (*User, error) {
+	user := &User{}
+	err := scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE `+where, arg), user)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *sqlRepository) GetUserByID(id int64) (*User, error) {
+	return r.getUser(`id = ?`, id)
+}
+
+func (r *sqlRepository) GetUserByEmail(email string) (*User, error) {
+	return r.getUser(`email = ?`, email)
+}
+
+func (r *sqlRepository) SetUserPasswordHash(userID int64, passwordHash string) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		passwordHash, userID,
+	)
+	return err
+}
+
+func (r *sqlRepository) MarkEmailVerified(userID int64, email string, at time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET email_verified_at = ? WHERE id = ? AND email = ? AND email_verified_at IS NULL`,
+		at, userID, email,
+	)
+	return err
+}
+
+// promoteAdmins makes admins of the users whose verified email is one of
+// emails. Unverified addresses never qualify, so registering someone else's
+// address first cannot claim the role.
+func promoteAdmins(q queryer, userID int64, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(emails)), ", ")
+	args := []any{RoleAdmin, RoleAdmin}
+	for _, email := range emails {
+		args = append(args, email)
+	}
+	where := ""
+	if userID != 0 {
+		where = " AND id = ?"
+		args = append(args, userID)
+	}
+	_, err := q.Exec(
+		`UPDATE users SET role = ? WHERE role != ? AND email_verified_at IS NOT NULL AND LOWER(email) IN (`+placeholders+`)`+where,
+		args...,
+	)
+	return err
+}
+
+func (r *sqlRepository) PromoteAdmins(userID int64, emails []string) error {
+	return promoteAdmins(r.db, userID, emails)
+}
+
+func (r *sqlRepository) CountAdmins() (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, RoleAdmin).Scan(&count)
+	return count, err
+}
+
+func (r *sqlRepository) ListUsers(filter UserFilter) (*UserPage, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(search)) + "%"
+		where = append(where, `(LOWER(email) LIKE ? ESCAPE '\' OR LOWER(name) LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	if filter.Role != "" {
+		where = append(where, "role = ?")
+		args = append(args, filter.Role)
+	}
+	switch filter.Status {
+	case "active":
+		where = append(where, "disabled_at IS NULL")
+	case "disabled":
+		where = append(where, "disabled_at IS NOT NULL")
+	}
+	if filter.Cursor != "" {
+		id, err := strconv.ParseInt(filter.Cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, ErrInvalidCursor
+		}
+		where = append(where, "id < ?")
+		args = append(args, id)
+	}
+	args = append(args, filter.Limit+1)
+
+	rows, err := r.db.Query(
+		`SELECT `+userColumns+`,
+			(totp_enabled_at IS NOT NULL OR EXISTS (SELECT 1 FROM webauthn_credentials w WHERE w.user_id = users.id))
+		FROM users WHERE `+strings.Join(where, " AND ")+` ORDER BY id DESC LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &UserPage{Users: []AdminUser{}}
+	for rows.Next() {
+		var u AdminUser
+		if err := scanUser(extraColumns{rows, []any{&u.MFAEnabled}}, &u.User); err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(page.Users) > filter.Limit {
+		page.Users = page.Users[:filter.Limit]
+		page.NextCursor = strconv.FormatInt(page.Users[len(page.Users)-1].ID, 10)
+	}
+
+	if err := r.loadUserLastSeen(page.Users); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (r *sqlRepository) loadUserLastSeen(users []AdminUser) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*AdminUser, len(users))
+	args := make([]any, 0, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+		args = append(args, users[i].ID)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := r.db.Query(
+		`SELECT user_id, last_seen_at FROM auth_sessions WHERE user_id IN (`+placeholders+`)`, args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		var lastSeen time.Time
+		if err := rows.Scan(&userID, &lastSeen); err != nil {
+			return err
+		}
+		if u := byID[userID]; u.LastSeenAt == nil || lastSeen.After(*u.LastSeenAt) {
+			u.LastSeenAt = &lastSeen
+		}
+	}
+	return rows.Err()
+}
+
+// extraColumns appends destinations for columns selected after the ones a
+// scan function knows about.
+type extraColumns struct {
+	row   rowScanner
+	extra []any
+}
+
+func (e extraColumns) Scan(dest ...any) error {
+	return e.row.Scan(append(dest, e.extra...)...)
+}
+
+// withUser loads the user in a transaction, runs fn and commits.
+func (r *sqlRepository) withUser(userID int64, fn func(tx *sql.Tx, user *User) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var user User
+	err = scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, userID), &user)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx, &user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// requireOtherActiveAdmin fails when userID is the last active admin. It
+// locks the active admins, in id order, so that admins demoting each other
+// at the same time cannot both pass the check.
+func (r *sqlRepository) requireOtherActiveAdmin(tx *sql.Tx, userID int64) error {
+	rows, err := tx.Query(
+		`SELECT id FROM users WHERE role = ? AND disabled_at IS NULL ORDER BY id`+r.forUpdate, RoleAdmin,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	others := 0
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		if id != userID {
+			others++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func (r *sqlRepository) SetUserDisabled(userID int64, disabledAt *time.Time) error {
+	return r.withUser(userID, func(tx *sql.Tx, user *User) error {
+		if disabledAt == nil {
+			_, err := tx.Exec(`UPDATE users SET disabled_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, userID)
+			return err
+		}
+		if user.IsDisabled() {
+			return nil
+		}
+		if user.IsAdmin() {
+			if err := r.requireOtherActiveAdmin(tx, userID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`UPDATE users SET disabled_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, *disabledAt, userID)
+		return err
+	})
+}
+
+func (r *sqlRepository) SetUserRole(userID int64, role string) error {
+	return r.withUser(userID, func(tx *sql.Tx, user *User) error {
+		if role != RoleAdmin && user.IsAdmin() {
+			if err := r.requireOtherActiveAdmin(tx, userID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`UPDATE users SET role = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, role, userID)
+		return err
+	})
+}
+
+func (r *sqlRepository) DeleteUser(userID int64) error {
+	return r.withUser(userID, func(tx *sql.Tx, user *User) error {
+		if user.IsAdmin() && !user.IsDisabled() {
+			if err := r.requireOtherActiveAdmin(tx, userID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
+		return err
+	})
+}
+
+func (r *sqlRepository) CreateConnection(userID int64, rec *ConnectionRecord, tags []string) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertID(tx,
+		`INSERT INTO ssh_connections (user_id, name, host, port, username, auth_type, password_encrypted, private_key_encrypted, folder_id,
+		template_id, overrides, jump_connection_id, term_type, variables, keepalive_interval, keepalive_max_missed,
+		auto_reconnect, session_manager, session_name,
+		initial_cols, initial_rows, terminal_modes, environment, startup_command, working_directory,
+		idle_timeout, max_session_duration, max_sessions)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, rec.Name, rec.Host, rec.Port, rec.Username, rec.AuthType, rec.PasswordEncrypted, rec.PrivateKeyEncrypted, rec.FolderID,
+		rec.TemplateID, strings.Join(rec.Overrides, ","), rec.JumpConnectionID, rec.TermType, rec.Variables, rec.KeepaliveInterval, rec.KeepaliveMaxMissed,
+		rec.AutoReconnect, rec.SessionManager, rec.SessionName,
+		rec.InitialCols, rec.InitialRows, rec.TerminalModes, rec.Environment, rec.StartupCommand, rec.WorkingDirectory,
+		rec.IdleTimeout, rec.MaxSessionDuration, rec.MaxSessions,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := setSSHConnectionTags(tx, id, tags); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *sqlRepository) GetConnection(id, userID int64) (*SSHConnection, error) {
+	conn := &SSHConnection{}
+	err := scanSSHConnection(r.db.QueryRow(
+		`SELECT `+sshConnectionColumns+`
+		FROM ssh_connections c WHERE c.id = ? AND c.user_id = ?`,
+		id, userID,
+	), conn)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrConnectionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	connections := []SSHConnection{*conn}
+	if err := r.loadConnectionTags(connections); err != nil {
+		return nil, err
+	}
+	return &connections[0], nil
+}
+
+func (r *sqlRepository) ListConnections(userID int64, filter SSHConnectionFilter) (*SSHConnectionPage, error) {
+	var where []string
+	var args []any
+	where = append(where, "c.user_id = ?")
+	args = append(args, userID)
+
+	for _, term := range strings.Fields(strings.ToLower(filter.Search)) {
+		pattern := "%" + escapeLike(term) + "%"
+		where = append(where, `(LOWER(c.name) LIKE ? ESCAPE '\' OR LOWER(c.host) LIKE ? ESCAPE '\' OR LOWER(c.username) LIKE ? ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM ssh_connection_tags t WHERE t.connection_id = c.id AND t.tag LIKE ? ESCAPE '\'))`)
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+
+	for _, tag := range filter.Tags {
+		where = append(where, `EXISTS (SELECT 1 FROM ssh_connection_tags t WHERE t.connection_id = c.id AND t.tag = ?)`)
+		args = append(args, tag)
+	}
+
+	if filter.Favorites {
+		where = append(where, `EXISTS (SELECT 1 FROM ssh_favorites f WHERE f.connection_id = c.id AND f.user_id = c.user_id)`)
+	}
+	if filter.UsedOnly {
+		where = append(where, "c.last_used_at IS NOT NULL")
+	}
+
+	if filter.FolderID != nil {
+		switch {
+		case *filter.FolderID == 0:
+			where = append(where, "c.folder_id IS NULL")
+		case filter.Recursive:
+			where = append(where, `c.folder_id IN (
+				WITH RECURSIVE subtree(id) AS (
+					SELECT id FROM ssh_folders WHERE id = ? AND user_id = ?
+					UNION ALL
+					SELECT f.id FROM ssh_folders f JOIN subtree s ON f.parent_id = s.id
+				)
+				SELECT id FROM subtree)`)
+			args = append(args, *filter.FolderID, userID)
+		default:
+			where = append(where, "c.folder_id = ?")
+			args = append(args, *filter.FolderID)
+		}
+	}
+
+	var cmp string
+	var dir string
+	switch filter.Order {
+	case "asc":
+		cmp, dir = ">", "ASC"
+	case "desc":
+		cmp, dir = "<", "DESC"
+	default:
+		return nil, errors.New("invalid order")
+	}
+
+	// Never-used connections sort as the oldest possible timestamp.
+	neverUsed := time.Time{}
+	var orderBy string
+	switch filter.Sort {
+	case "name":
+		orderBy = "LOWER(c.name) " + dir + ", c.id " + dir
+	case "last_used":
+		orderBy = "COALESCE(c.last_used_at, ?) " + dir + ", c.id " + dir
+	case "created":
+		orderBy = "c.id " + dir
+	default:
+		return nil, errors.New("invalid sort")
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeConnectionCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != filter.Sort || cursor.Order != filter.Order {
+			return nil, ErrInvalidCursor
+		}
+
+		switch filter.Sort {
+		case "name":
+			where = append(where, "(LOWER(c.name) "+cmp+" LOWER(CAST(? AS TEXT)) OR (LOWER(c.name) = LOWER(CAST(? AS TEXT)) AND c.id "+cmp+" ?))")
+			args = append(args, cursor.Name, cursor.Name, cursor.ID)
+		case "last_used":
+			lastUsed := neverUsed
+			if cursor.LastUsed != nil {
+				lastUsed = cursor.LastUsed.UTC()
+			}
+			where = append(where, "(COALESCE(c.last_used_at, ?) "+cmp+" ? OR (COALESCE(c.last_used_at, ?) = ? AND c.id "+cmp+" ?))")
+			args = append(args, neverUsed, lastUsed, neverUsed, lastUsed, cursor.ID)
+		case "created":
+			where = append(where, "c.id "+cmp+" ?")
+			args = append(args, cursor.ID)
+		}
+	}
+
+	if filter.Sort == "last_used" {
+		args = append(args, neverUsed)
+	}
+
+	query := `SELECT ` + sshConnectionColumns + ` FROM ssh_connections c WHERE ` + strings.Join(where, " AND ") + ` ORDER BY ` + orderBy
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit+1)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var connections []SSHConnection
+	for rows.Next() {
+		var conn SSHConnection
+		if err := scanSSHConnection(rows, &conn); err != nil {
+			return nil, err
+		}
+		connections = append(connections, conn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	page := &SSHConnectionPage{}
+	if filter.Limit > 0 && len(connections) > filter.Limit {
+		connections = connections[:filter.Limit]
+		last := connections[len(connections)-1]
+		page.NextCursor = encodeConnectionCursor(connectionCursor{
+			Sort:     filter.Sort,
+			Order:    filter.Order,
+			Name:     last.Name,
+			LastUsed: last.LastUsedAt,
+			ID:       last.ID,
+		})
+	}
+
+	if err := r.loadConnectionTags(connections); err != nil {
+		return nil, err
+	}
+	page.Connections = connections
+
+	return page, nil
+}
+
+func (r *sqlRepository) UpdateConnection(id, userID int64, rec *ConnectionRecord, tags []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE ssh_connections SET name = ?, host = ?, port = ?, username = ?, auth_type = ?,
+		password_encrypted = CASE WHEN ? THEN NULL ELSE COALESCE(?, password_encrypted) END,
+		private_key_encrypted = CASE WHEN ? THEN NULL ELSE COALESCE(?, private_key_encrypted) END,
+		folder_id = ?, template_id = ?, overrides = ?, jump_connection_id = ?, term_type = ?, variables = ?,
+		keepalive_interval = ?, keepalive_max_missed = ?, auto_reconnect = ?, session_manager = ?, session_name = ?,
+		initial_cols = ?, initial_rows = ?, terminal_modes = ?, environment = ?, startup_command = ?, working_directory = ?,
+		idle_timeout = ?, max_session_duration = ?, max_sessions = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?`,
+		rec.Name, rec.Host, rec.Port, rec.Username, rec.AuthType,
+		rec.ClearPassword, rec.PasswordEncrypted,
+		rec.ClearPrivateKey, rec.PrivateKeyEncrypted,
+		rec.FolderID, rec.TemplateID, strings.Join(rec.Overrides, ","), rec.JumpConnectionID, rec.TermType, rec.Variables,
+		rec.KeepaliveInterval, rec.KeepaliveMaxMissed, rec.AutoReconnect, rec.SessionManager, rec.SessionName,
+		rec.InitialCols, rec.InitialRows, rec.TerminalModes, rec.Environment, rec.StartupCommand, rec.WorkingDirectory,
+		rec.IdleTimeout, rec.MaxSessionDuration, rec.MaxSessions,
+		id, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tags != nil {
+		if err := setSSHConnectionTags(tx, id, tags); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqlRepository) DeleteConnection(id, userID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Connections and templates using this one as a bastion lose their jump host.
+	if _, err := tx.Exec(`UPDATE ssh_connections SET jump_connection_id = NULL WHERE jump_connection_id = ? AND user_id = ?`, id, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE ssh_templates SET jump_connection_id = NULL WHERE jump_connection_id = ? AND user_id = ?`, id, userID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		`DELETE FROM ssh_connections WHERE id = ? AND user_id = ?`,
+		id, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrConnectionNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqlRepository) GetUserTags(userID int64) (map[string]int, error) {
+	rows, err := r.db.Query(
+		`SELECT t.tag, COUNT(*) FROM ssh_connection_tags t
+		JOIN ssh_connections c ON c.id = t.connection_id
+		WHERE c.user_id = ? GROUP BY t.tag`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string]int)
+	for rows.Next() {
+		var tag string
+		var count int
+		if err := rows.Scan(&tag, &count); err != nil {
+			return nil, err
+		}
+		tags[tag] = count
+	}
+	return tags, rows.Err()
+}
+
+func (r *sqlRepository) SetFavorite(id, userID int64, favorite bool) error {
+	var err error
+	if favorite {
+		_, err = r.db.Exec(
+			`INSERT INTO ssh_favorites (user_id, connection_id) VALUES (?, ?) ON CONFLICT (user_id, connection_id) DO NOTHING`,
+			userID, id,
+		)
+	} else {
+		_, err = r.db.Exec(`DELETE FROM ssh_favorites WHERE user_id = ? AND connection_id = ?`, userID, id)
+	}
+	return err
+}
+
+func (r *sqlRepository) TouchConnection(id, userID int64, at time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE ssh_connections SET last_used_at = ? WHERE id = ? AND user_id = ?`,
+		at, id, userID,
+	)
+	return err
+}
+
+func (r *sqlRepository) loadConnectionTags(connections []SSHConnection) error {
+	if len(connections) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]*SSHConnection, len(connections))
+	placeholders := make([]string, 0, len(connections))
+	args := make([]any, 0, len(connections))
+	for i := range connections {
+		connections[i].Tags = []string{}
+		index[connections[i].ID] = &connections[i]
+		placeholders = append(placeholders, "?")
+		args = append(args, connections[i].ID)
+	}
+
+	rows, err := r.db.Query(
+		`SELECT connection_id, tag FROM ssh_connection_tags WHERE connection_id IN (`+strings.Join(placeholders, ", ")+`) ORDER BY tag`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var connectionID int64
+		var tag string
+		if err := rows.Scan(&connectionID, &tag); err != nil {
+			return err
+		}
+		if conn, ok := index[connectionID]; ok {
+			conn.Tags = append(conn.Tags, tag)
+		}
+	}
+	return rows.Err()
+}
+
+func setSSHConnectionTags(tx *sql.Tx, connectionID int64, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM ssh_connection_tags WHERE connection_id = ?`, connectionID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT INTO ssh_connection_tags (connection_id, tag) VALUES (?, ?)`, connectionID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlRepository) StartSession(userID, connectionID int64, node string, at time.Time) (int64, error) {
+	return insertID(r.db,
+		`INSERT INTO ssh_sessions (user_id, connection_id, status, node, started_at) VALUES (?, ?, ?, ?, ?)`,
+		userID, connectionID, SessionStatusActive, node, at,
+	)
+}
+
+func (r *sqlRepository) EndSession(id int64, status string, errMsg *string, at time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE ssh_sessions SET status = ?, error_message = ?, ended_at = ? WHERE id = ?`,
+		status, errMsg, at, id,
+	)
+	return err
+}
+
+func (r *sqlRepository) CloseStaleSessions(node string, at time.Time) error {
+	// Sessions recorded before nodes were tracked have none.
+	_, err := r.db.Exec(
+		`UPDATE ssh_sessions SET status = ?, ended_at = COALESCE(ended_at, ?) WHERE status = ? AND (node = ? OR node IS NULL)`,
+		SessionStatusClosed, at, SessionStatusActive, node,
+	)
+	return err
+}
+
+func (r *sqlRepository) GetConnectionSessions(connectionID, userID int64) ([]SSHSession, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, connection_id, status, error_message, started_at, ended_at FROM ssh_sessions
+		WHERE connection_id = ? AND user_id = ? ORDER BY started_at, id`,
+		connectionID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []SSHSession{}
+	for rows.Next() {
+		var s SSHSession
+		var errorMessage sql.NullString
+		var endedAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.UserID, &s.ConnectionID, &s.Status, &errorMessage, &s.StartedAt, &endedAt); err != nil {
+			return nil, err
+		}
+		if errorMessage.Valid {
+			s.ErrorMessage = &errorMessage.String
+		}
+		if endedAt.Valid {
+			s.EndedAt = &endedAt.Time
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlRepository) GetConnectionStats(connectionID, userID int64) (*SSHConnectionStats, error) {
+	// Only closed sessions reached a shell; active ones may still be dialing.
+	stats := &SSHConnectionStats{ConnectionID: connectionID}
+	var lastConnectedAt, errorStartedAt, errorEndedAt sql.NullTime
+	var lastError sql.NullString
+	err := r.db.QueryRow(
+		`SELECT s.opened, s.failed, s.active, s.seconds, c.started_at, e.error_message, e.started_at, e.ended_at
+		FROM (
+			SELECT COUNT(CASE WHEN status = ? THEN 1 END) AS opened,
+				COUNT(CASE WHEN status = ? THEN 1 END) AS failed,
+				COUNT(CASE WHEN status = ? THEN 1 END) AS active,
+				CAST(COALESCE(SUM(CASE WHEN status = ? AND ended_at > started_at THEN `+r.sessionSeconds+` END), 0) AS BIGINT) AS seconds
+			FROM ssh_sessions WHERE connection_id = ? AND user_id = ?
+		) s
+		LEFT JOIN ssh_sessions c ON c.id = (
+			SELECT id FROM ssh_sessions WHERE connection_id = ? AND user_id = ? AND status = ?
+			ORDER BY started_at DESC, id DESC LIMIT 1
+		)
+		LEFT JOIN ssh_sessions e ON e.id = (
+			SELECT id FROM ssh_sessions WHERE connection_id = ? AND user_id = ? AND error_message IS NOT NULL
+			ORDER BY started_at DESC, id DESC LIMIT 1
+		)`,
+		SessionStatusClosed, SessionStatusFailed, SessionStatusActive, SessionStatusClosed, connectionID, userID,
+		connectionID, userID, SessionStatusClosed,
+		connectionID, userID,
+	).Scan(
+		&stats.OpenCount, &stats.FailedCount, &stats.ActiveCount, &stats.TotalSessionSeconds,
+		&lastConnectedAt, &lastError, &errorStartedAt, &errorEndedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastConnectedAt.Valid {
+		stats.LastConnectedAt = &lastConnectedAt.Time
+	}
+	if lastError.Valid {
+		stats.LastError = &lastError.String
+		errorAt := errorStartedAt.Time
+		if errorEndedAt.Valid {
+			errorAt = errorEndedAt.Time
+		}
+		stats.LastErrorAt = &errorAt
+	}
+	return stats, nil
+}
@@ -0,0 +1,481 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+func (r *sqlRepository) GetUserIdentities(userID int64) ([]UserIdentity, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, provider, subject, email, created_at, last_login_at FROM user_identities WHERE user_id = ? ORDER BY provider, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []UserIdentity{}
+	for rows.Next() {
+		var identity UserIdentity
+		var email sql.NullString
+		var lastLoginAt sql.NullTime
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &email, &identity.CreatedAt, &lastLoginAt); err != nil {
+			return nil, err
+		}
+		identity.Email = email.String
+		if lastLoginAt.Valid {
+			identity.LastLoginAt = &lastLoginAt.Time
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (r *sqlRepository) FindOrCreateIdentityUser(identity ExternalIdentity, adminEmails []string, at time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow(
+		`SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?`,
+		identity.Provider, identity.Subject,
+	).Scan(&userID)
+
+	switch {
+	case err == nil:
+		_, err = tx.Exec(
+			`UPDATE user_identities SET email = ?, last_login_at = ? WHERE provider = ? AND subject = ?`,
+			identity.Email, at, identity.Provider, identity.Subject,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+	case err == sql.ErrNoRows:
+		err = tx.QueryRow(`SELECT id FROM users WHERE email = ?`, identity.Email).Scan(&userID)
+		if err == sql.ErrNoRows {
+			var verifiedAt *time.Time
+			if identity.EmailVerified {
+				verifiedAt = &at
+			}
+			userID, err = insertID(tx,
+				`INSERT INTO users (email, password_hash, name, email_verified_at) VALUES (?, ?, ?, ?)`,
+				identity.Email, "", identity.Name, verifiedAt,
+			)
+			if err != nil {
+				return 0, err
+			}
+		} else if err != nil {
+			return 0, err
+		} else if !identity.EmailVerified {
+			return 0, ErrUnverifiedIdentityEmail
+		} else {
+			_, err = tx.Exec(`UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL`, at, userID)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			userID, identity.Provider, identity.Subject, identity.Email, at, at,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+	default:
+		return 0, err
+	}
+
+	if err := promoteAdmins(tx, userID, adminEmails); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+func (r *sqlRepository) CreateAuthSession(userID int64, userAgent, ipAddress, refreshTokenHash string, at, expiresAt time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertID(tx,
+		`INSERT INTO auth_sessions (user_id, user_agent, ip_address, created_at, last_seen_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, userAgent, ipAddress, at, at, expiresAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertRefreshToken(tx, id, refreshTokenHash, at, expiresAt); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func insertRefreshToken(tx *sql.Tx, sessionID int64, tokenHash string, at, expiresAt time.Time) error {
+	_, err := tx.Exec(
+		`INSERT INTO refresh_tokens (session_id, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		sessionID, tokenHash, at, expiresAt,
+	)
+	return err
+}
+
+func (r *sqlRepository) GetAuthSession(id int64) (*AuthSession, error) {
+	s := &AuthSession{}
+	err := scanAuthSession(r.db.QueryRow(
+		`SELECT `+authSessionColumns+` FROM auth_sessions WHERE id = ?`, id,
+	), s)
+	if err == sql.ErrNoRows {
+		return nil, ErrAuthSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *sqlRepository) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	t := &RefreshToken{}
+	var usedAt sql.NullTime
+	err := r.db.QueryRow(
+		`SELECT id, session_id, expires_at, used_at FROM refresh_tokens WHERE token_hash = ?`, tokenHash,
+	).Scan(&t.ID, &t.SessionID, &t.ExpiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		t.UsedAt = &usedAt.Time
+	}
+	return t, nil
+}
+
+func (r *sqlRepository) RotateRefreshToken(token *RefreshToken, newTokenHash string, at, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The used_at guard makes concurrent exchanges of one token race safely:
+	// only the first one wins, the rest count as reuse.
+	result, err := tx.Exec(`UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, at, token.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	if err := insertRefreshToken(tx, token.SessionID, newTokenHash, at, expiresAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE auth_sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?`, at, expiresAt, token.SessionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlRepository) TouchAuthSession(id int64, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE auth_sessions SET last_seen_at = ? WHERE id = ?`, at, id)
+	return err
+}
+
+func (r *sqlRepository) GetActiveAuthSessions(userID int64, at time.Time) ([]AuthSession, error) {
+	rows, err := r.db.Query(
+		`SELECT `+authSessionColumns+` FROM auth_sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_seen_at DESC`,
+		userID, at,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []AuthSession
+	for rows.Next() {
+		var s AuthSession
+		if err := scanAuthSession(rows, &s); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlRepository) RevokeAuthSession(id int64, reason string, at time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE auth_sessions SET revoked_at = ?, revoke_reason = ? WHERE id = ? AND revoked_at IS NULL`,
+		at, reason, id,
+	)
+	return err
+}
+
+func (r *sqlRepository) RevokeUserAuthSession(id, userID int64, reason string, at time.Time) error {
+	result, err := r.db.Exec(
+		`UPDATE auth_sessions SET revoked_at = ?, revoke_reason = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		at, reason, id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAuthSessionNotFound
+	}
+	return nil
+}
+
+func (r *sqlRepository) RevokeUserAuthSessions(userID, exceptID int64, reason string, at time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE auth_sessions SET revoked_at = ?, revoke_reason = ? WHERE user_id = ? AND id != ? AND revoked_at IS NULL`,
+		at, reason, userID, exceptID,
+	)
+	return err
+}
+
+func (r *sqlRepository) CountAPITokens(userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = ?`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *sqlRepository) CreateAPIToken(token *APIToken, tokenHash string) (int64, error) {
+	return insertID(r.db,
+		`INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token.UserID, token.Name, tokenHash, token.Prefix, strings.Join(token.Scopes, " "), token.CreatedAt, token.ExpiresAt,
+	)
+}
+
+func (r *sqlRepository) GetAPITokens(userID int64) ([]APIToken, error) {
+	rows, err := r.db.Query(
+		`SELECT `+apiTokenColumns+` FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC, id DESC`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		if err := scanAPIToken(rows, &t); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *sqlRepository) getAPIToken(where string, args ...any) (*APIToken, error) {
+	var t APIToken
+	err := scanAPIToken(r.db.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE `+where, args...), &t)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPITokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *sqlRepository) GetAPIToken(id, userID int64) (*APIToken, error) {
+	return r.getAPIToken(`id = ? AND user_id = ?`, id, userID)
+}
+
+func (r *sqlRepository) GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	return r.getAPIToken(`token_hash = ?`, tokenHash)
+}
+
+func (r *sqlRepository) DeleteAPIToken(id, userID int64) error {
+	result, err := r.db.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+func (r *sqlRepository) TouchAPIToken(id int64, ip string, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE api_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, at, ip, id)
+	return err
+}
+
+func (r *sqlRepository) CreateUserToken(userID int64, purpose, tokenHash, email string, at, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_tokens WHERE expires_at < ?`, at); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL`,
+		at, userID, purpose,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO user_tokens (user_id, purpose, token_hash, email, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, purpose, tokenHash, email, at, expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlRepository) ConsumeUserToken(tokenHash, purpose string, at time.Time) (*UserToken, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var result UserToken
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	var currentEmail string
+	err = tx.QueryRow(
+		`SELECT t.id, t.user_id, t.email, t.expires_at, t.used_at, u.email
+		FROM user_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND t.purpose = ?`,
+		tokenHash, purpose,
+	).Scan(&id, &result.UserID, &result.Email, &expiresAt, &usedAt, &currentEmail)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid || at.After(expiresAt) || currentEmail != result.Email {
+		return nil, ErrInvalidUserToken
+	}
+
+	update, err := tx.Exec(`UPDATE user_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, at, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := update.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrInvalidUserToken
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (r *sqlRepository) CreateAuthExchangeCode(codeHash string, userID int64, at, expiresAt time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM auth_exchange_codes WHERE expires_at < ?`, at); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(
+		`INSERT INTO auth_exchange_codes (code_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+		codeHash, userID, expiresAt,
+	)
+	return err
+}
+
+func (r *sqlRepository) TakeAuthExchangeCode(codeHash string, at time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	var expiresAt time.Time
+	err = tx.QueryRow(`SELECT user_id, expires_at FROM auth_exchange_codes WHERE code_hash = ?`, codeHash).Scan(&userID, &expiresAt)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidExchangeCode
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM auth_exchange_codes WHERE code_hash = ?`, codeHash); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if at.After(expiresAt) {
+		return 0, ErrInvalidExchangeCode
+	}
+	return userID, nil
+}
+
+func (r *sqlRepository) SaveWebAuthnCeremony(ceremony *WebAuthnCeremony, at time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM webauthn_ceremonies WHERE expires_at < ?`, at); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(
+		`INSERT INTO webauthn_ceremonies (id, user_id, purpose, session_data, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		ceremony.ID, ceremony.UserID, ceremony.Purpose, ceremony.SessionData, ceremony.ExpiresAt,
+	)
+	return err
+}
+
+func (r *sqlRepository) TakeWebAuthnCeremony(id, purpose string, at time.Time) (*WebAuthnCeremony, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ceremony := &WebAuthnCeremony{ID: id, Purpose: purpose}
+	var userID sql.NullInt64
+	err = tx.QueryRow(
+		`SELECT user_id, session_data, expires_at FROM webauthn_ceremonies WHERE id = ? AND purpose = ?`,
+		id, purpose,
+	).Scan(&userID, &ceremony.SessionData, &ceremony.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrWebAuthnCeremonyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM webauthn_ceremonies WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if at.After(ceremony.ExpiresAt) {
+		return nil, ErrWebAuthnCeremonyNotFound
+	}
+	if userID.Valid {
+		ceremony.UserID = &userID.Int64
+	}
+	return ceremony, nil
+}
@@ -0,0 +1,71 @@
+package models
+
+func (r *sqlRepository) GetFolders(userID int64) ([]Folder, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, parent_id, name, created_at, updated_at FROM ssh_folders WHERE user_id = ?`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []Folder
+	for rows.Next() {
+		var folder Folder
+		if err := scanFolder(rows, &folder); err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, rows.Err()
+}
+
+func (r *sqlRepository) CreateFolder(userID int64, parentID *int64, name string) (int64, error) {
+	return insertID(r.db,
+		`INSERT INTO ssh_folders (user_id, parent_id, name) VALUES (?, ?, ?)`,
+		userID, parentID, name,
+	)
+}
+
+func (r *sqlRepository) UpdateFolder(id, userID int64, parentID *int64, name string) error {
+	_, err := r.db.Exec(
+		`UPDATE ssh_folders SET name = ?, parent_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?`,
+		name, parentID, id, userID,
+	)
+	return err
+}
+
+func (r *sqlRepository) DeleteFolder(id, userID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE ssh_connections SET folder_id = NULL WHERE user_id = ? AND folder_id IN (
+			WITH RECURSIVE subtree(id) AS (
+				SELECT id FROM ssh_folders WHERE id = ? AND user_id = ?
+				UNION ALL
+				SELECT f.id FROM ssh_folders f JOIN subtree s ON f.parent_id = s.id
+			)
+			SELECT id FROM subtree)`,
+		userID, id, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM ssh_folders WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrFolderNotFound
+	}
+
+	return tx.Commit()
+}
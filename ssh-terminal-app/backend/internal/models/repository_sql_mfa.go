@@ -0,0 +1,317 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+func (r *sqlRepository) GetTOTPState(userID int64) (*TOTPState, error) {
+	var secretEncrypted sql.NullString
+	var enabledAt sql.NullTime
+	var lastCounter sql.NullInt64
+	err := r.db.QueryRow(
+		`SELECT totp_secret_encrypted, totp_enabled_at, totp_last_counter FROM users WHERE id = ?`, userID,
+	).Scan(&secretEncrypted, &enabledAt, &lastCounter)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &TOTPState{}
+	if secretEncrypted.Valid {
+		state.SecretEncrypted = &secretEncrypted.String
+	}
+	if enabledAt.Valid {
+		state.EnabledAt = &enabledAt.Time
+	}
+	if lastCounter.Valid {
+		state.LastCounter = &lastCounter.Int64
+	}
+	return state, nil
+}
+
+func (r *sqlRepository) SetPendingTOTPSecret(userID int64, secretEncrypted string) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET totp_secret_encrypted = ?, totp_enabled_at = NULL, totp_last_counter = NULL WHERE id = ?`,
+		secretEncrypted, userID,
+	)
+	return err
+}
+
+func (r *sqlRepository) EnableTOTP(userID int64, counter int64, recoveryCodeHashes []string, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE users SET totp_enabled_at = ?, totp_last_counter = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		at, counter, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlRepository) AdvanceTOTPCounter(userID int64, counter int64) error {
+	result, err := r.db.Exec(
+		`UPDATE users SET totp_last_counter = ? WHERE id = ? AND (totp_last_counter IS NULL OR totp_last_counter < ?)`,
+		counter, userID, counter,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (r *sqlRepository) DisableTOTP(userID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := clearTOTP(tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// clearTOTP removes the user's TOTP secret and recovery codes.
+func clearTOTP(tx *sql.Tx, userID int64) error {
+	_, err := tx.Exec(
+		`UPDATE users SET totp_secret_encrypted = NULL, totp_enabled_at = NULL, totp_last_counter = NULL,
+		updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID)
+	return err
+}
+
+func (r *sqlRepository) ResetUserMFA(userID int64) error {
+	return r.withUser(userID, func(tx *sql.Tx, user *User) error {
+		if err := clearTOTP(tx, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM webauthn_credentials WHERE user_id = ?`, userID)
+		return err
+	})
+}
+
+func (r *sqlRepository) CountRecoveryCodes(userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *sqlRepository) ReplaceRecoveryCodes(userID int64, codeHashes []string, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int64, codeHashes []string, at time.Time) error {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`,
+			userID, hash, at,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlRepository) UseRecoveryCode(userID int64, codeHash string, at time.Time) error {
+	result, err := r.db.Exec(
+		`UPDATE mfa_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		at, userID, codeHash,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (r *sqlRepository) GetWebAuthnUserHandle(userID int64) (string, error) {
+	var handle sql.NullString
+	err := r.db.QueryRow(`SELECT webauthn_user_handle FROM users WHERE id = ?`, userID).Scan(&handle)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return handle.String, err
+}
+
+func (r *sqlRepository) SetWebAuthnUserHandle(userID int64, handle string) (string, error) {
+	_, err := r.db.Exec(
+		`UPDATE users SET webauthn_user_handle = ? WHERE id = ? AND webauthn_user_handle IS NULL`,
+		handle, userID,
+	)
+	if err != nil {
+		return "", err
+	}
+	return r.GetWebAuthnUserHandle(userID)
+}
+
+func (r *sqlRepository) GetUserIDByWebAuthnHandle(handle string) (int64, error) {
+	var userID int64
+	err := r.db.QueryRow(`SELECT id FROM users WHERE webauthn_user_handle = ?`, handle).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrWebAuthnCredentialNotFound
+	}
+	return userID, err
+}
+
+func (r *sqlRepository) CountWebAuthnCredentials(userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = ?`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *sqlRepository) GetWebAuthnCredentialData(userID int64) ([]webauthn.Credential, error) {
+	rows, err := r.db.Query(`SELECT credential FROM webauthn_credentials WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []webauthn.Credential
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(data), &credential); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, rows.Err()
+}
+
+func (r *sqlRepository) GetWebAuthnCredentials(userID int64) ([]WebAuthnCredential, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, name, credential, created_at, last_used_at FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []WebAuthnCredential{}
+	for rows.Next() {
+		var c WebAuthnCredential
+		var data string
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &data, &c.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			c.LastUsedAt = &lastUsedAt.Time
+		}
+
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(data), &credential); err != nil {
+			return nil, err
+		}
+		c.Transports = []string{}
+		for _, t := range credential.Transport {
+			c.Transports = append(c.Transports, string(t))
+		}
+		c.CloneWarning = credential.Authenticator.CloneWarning
+
+		credentials = append(credentials, c)
+	}
+	return credentials, rows.Err()
+}
+
+func (r *sqlRepository) CreateWebAuthnCredential(userID int64, name string, credential *webauthn.Credential, at time.Time) (int64, error) {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return 0, err
+	}
+	return insertID(r.db,
+		`INSERT INTO webauthn_credentials (user_id, credential_id, name, credential, created_at) VALUES (?, ?, ?, ?, ?)`,
+		userID, webAuthnCredentialKey(credential.ID), name, string(data), at,
+	)
+}
+
+func (r *sqlRepository) UpdateWebAuthnCredential(userID int64, credential *webauthn.Credential, at time.Time) error {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
+		`UPDATE webauthn_credentials SET credential = ?, last_used_at = ? WHERE user_id = ? AND credential_id = ?`,
+		string(data), at, userID, webAuthnCredentialKey(credential.ID),
+	)
+	return err
+}
+
+func (r *sqlRepository) RenameWebAuthnCredential(id, userID int64, name string) error {
+	result, err := r.db.Exec(
+		`UPDATE webauthn_credentials SET name = ? WHERE id = ? AND user_id = ?`,
+		name, id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+func (r *sqlRepository) DeleteWebAuthnCredential(id, userID int64) error {
+	result, err := r.db.Exec(`DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
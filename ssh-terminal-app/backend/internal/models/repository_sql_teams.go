@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+func (r *sqlRepository) GetUserTeams(userID int64) ([]Team, error) {
+	rows, err := r.db.Query(
+		`SELECT t.id, t.name, ut.source, t.created_at
+		FROM user_teams ut JOIN teams t ON t.id = ut.team_id
+		WHERE ut.user_id = ? ORDER BY t.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []Team{}
+	for rows.Next() {
+		var t Team
+		if err := rows.Scan(&t.ID, &t.Name, &t.Source, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+func (r *sqlRepository) SyncUserTeams(userID int64, source string, names []string, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_teams WHERE user_id = ? AND source = ?`, userID, source); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, err := tx.Exec(`INSERT INTO teams (name, created_at) VALUES (?, ?) ON CONFLICT(name) DO NOTHING`, name, at); err != nil {
+			return err
+		}
+		var teamID int64
+		if err := tx.QueryRow(`SELECT id FROM teams WHERE name = ?`, name).Scan(&teamID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			`INSERT INTO user_teams (user_id, team_id, source, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id, team_id) DO NOTHING`,
+			userID, teamID, source, at,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqlRepository) GetTeamSessionPolicies(userID int64) ([]TeamSessionPolicy, error) {
+	query := `SELECT id, name, idle_timeout, max_session_duration FROM teams ORDER BY name`
+	var args []any
+	if userID != 0 {
+		query = `SELECT t.id, t.name, t.idle_timeout, t.max_session_duration
+		FROM user_teams ut JOIN teams t ON t.id = ut.team_id
+		WHERE ut.user_id = ? ORDER BY t.name`
+		args = append(args, userID)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []TeamSessionPolicy{}
+	for rows.Next() {
+		var p TeamSessionPolicy
+		var idleTimeout, maxSessionDuration sql.NullInt64
+		if err := rows.Scan(&p.TeamID, &p.TeamName, &idleTimeout, &maxSessionDuration); err != nil {
+			return nil, err
+		}
+		p.IdleTimeout = optionalInt(idleTimeout)
+		p.MaxSessionDuration = optionalInt(maxSessionDuration)
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+func (r *sqlRepository) SetTeamSessionPolicy(teamID int64, idleTimeout, maxSessionDuration *int) error {
+	result, err := r.db.Exec(
+		`UPDATE teams SET idle_timeout = ?, max_session_duration = ? WHERE id = ?`,
+		idleTimeout, maxSessionDuration, teamID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqlRepository) GetSetting(key string) (string, bool, error) {
+	var value string
+	err := r.db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (r *sqlRepository) SetSetting(key, value string, at time.Time) error {
+	_, err := r.db.Exec(
+		`INSERT INTO app_settings (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key, value, at,
+	)
+	return err
+}
@@ -0,0 +1,101 @@
+package models
+
+import "database/sql"
+
+func (r *sqlRepository) CreateTemplate(userID int64, rec *TemplateRecord) (int64, error) {
+	return insertID(r.db,
+		`INSERT INTO ssh_templates (user_id, name, port, username, auth_type, password_encrypted, private_key_encrypted, jump_connection_id, term_type, variables)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, rec.Name, rec.Port, rec.Username, rec.AuthType, rec.PasswordEncrypted, rec.PrivateKeyEncrypted,
+		rec.JumpConnectionID, rec.TermType, rec.Variables,
+	)
+}
+
+func (r *sqlRepository) GetTemplate(id, userID int64) (*SSHTemplate, error) {
+	t := &SSHTemplate{}
+	err := scanSSHTemplate(r.db.QueryRow(
+		`SELECT `+sshTemplateColumns+` FROM ssh_templates WHERE id = ? AND user_id = ?`,
+		id, userID,
+	), t)
+	if err == sql.ErrNoRows {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *sqlRepository) GetTemplates(userID int64) ([]SSHTemplate, error) {
+	rows, err := r.db.Query(
+		`SELECT `+sshTemplateColumns+` FROM ssh_templates WHERE user_id = ? ORDER BY name`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []SSHTemplate
+	for rows.Next() {
+		var t SSHTemplate
+		if err := scanSSHTemplate(rows, &t); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+func (r *sqlRepository) UpdateTemplate(id, userID int64, rec *TemplateRecord) error {
+	_, err := r.db.Exec(
+		`UPDATE ssh_templates SET name = ?, port = ?, username = ?, auth_type = ?,
+		password_encrypted = COALESCE(?, password_encrypted),
+		private_key_encrypted = COALESCE(?, private_key_encrypted),
+		jump_connection_id = ?, term_type = ?, variables = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?`,
+		rec.Name, rec.Port, rec.Username, rec.AuthType, rec.PasswordEncrypted, rec.PrivateKeyEncrypted,
+		rec.JumpConnectionID, rec.TermType, rec.Variables, id, userID,
+	)
+	return err
+}
+
+func (r *sqlRepository) DeleteTemplate(id, userID int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	count, err := countTemplateConnections(tx, id, userID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTemplateInUse
+	}
+
+	result, err := tx.Exec(`DELETE FROM ssh_templates WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTemplateNotFound
+	}
+	return tx.Commit()
+}
+
+func (r *sqlRepository) CountTemplateConnections(id, userID int64) (int, error) {
+	return countTemplateConnections(r.db, id, userID)
+}
+
+func countTemplateConnections(q queryer, id, userID int64) (int, error) {
+	var count int
+	err := q.QueryRow(
+		`SELECT COUNT(*) FROM ssh_connections WHERE template_id = ? AND user_id = ?`,
+		id, userID,
+	).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// NewSQLiteRepository stores everything in the SQLite database db.
+func NewSQLiteRepository(db *sql.DB) Repository {
+	return &sqlRepository{
+		db:                db,
+		isUniqueViolation: isSQLiteUniqueViolation,
+		sessionSeconds:    `CAST(strftime('%s', ended_at) AS INTEGER) - CAST(strftime('%s', started_at) AS INTEGER)`,
+	}
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
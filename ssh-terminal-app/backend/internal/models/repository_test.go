@@ -0,0 +1,510 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"ssh-terminal-app/internal/database"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// repositoryBackends are the storage backends every repository test runs
+// against. PostgreSQL needs a database in TEST_DATABASE_URL and is skipped
+// without one; the tests only add rows of their own, so it may be shared.
+var repositoryBackends = []struct {
+	name  string
+	setup func(t *testing.T)
+	new   func(db *sql.DB) Repository
+}{
+	{
+		name: "sqlite",
+		setup: func(t *testing.T) {
+			t.Setenv("DATABASE_DRIVER", database.DriverSQLite)
+			t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+		},
+		new: NewSQLiteRepository,
+	},
+	{
+		name: "postgres",
+		setup: func(t *testing.T) {
+			url := os.Getenv("TEST_DATABASE_URL")
+			if url == "" {
+				t.Skip("TEST_DATABASE_URL is not set")
+			}
+			t.Setenv("DATABASE_DRIVER", database.DriverPostgres)
+			t.Setenv("DATABASE_URL", url)
+		},
+		new: NewPostgresRepository,
+	},
+}
+
+// forEachRepository runs fn on a migrated database of every backend.
+func forEachRepository(t *testing.T, fn func(t *testing.T, r Repository)) {
+	for _, backend := range repositoryBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			backend.setup(t)
+			t.Setenv("DB_AUTO_MIGRATE", "true")
+			if err := database.InitDB(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(database.CloseDB)
+			fn(t, backend.new(database.DB))
+		})
+	}
+}
+
+var testSeq atomic.Int64
+
+// testName returns a name no other test run uses, even on a shared database.
+func testName(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), testSeq.Add(1))
+}
+
+func createRepoUser(t *testing.T, r Repository) int64 {
+	t.Helper()
+	id, err := r.CreateUser(testName("user")+"@example.com", "hash", "Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestRepositoryUsers(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		email := testName("user") + "@example.com"
+		id, err := r.CreateUser(email, "hash", "Test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.CreateUser(email, "other", "Other"); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("CreateUser with a taken email: err = %v, want ErrEmailTaken", err)
+		}
+
+		lookups := []struct {
+			name    string
+			get     func() (*User, error)
+			wantErr error
+		}{
+			{name: "by id", get: func() (*User, error) { return r.GetUserByID(id) }},
+			{name: "by email", get: func() (*User, error) { return r.GetUserByEmail(email) }},
+			{name: "unknown id", get: func() (*User, error) { return r.GetUserByID(-1) }, wantErr: ErrUserNotFound},
+			{name: "unknown email", get: func() (*User, error) { return r.GetUserByEmail("nobody@example.com") }, wantErr: ErrUserNotFound},
+		}
+		for _, tt := range lookups {
+			user, err := tt.get()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if user.ID != id || user.Email != email || user.Name != "Test" || user.Role != RoleUser {
+				t.Errorf("%s: got %+v", tt.name, user)
+			}
+		}
+
+		if err := r.SetUserPasswordHash(id, "new-hash"); err != nil {
+			t.Fatal(err)
+		}
+
+		at := dbNow()
+		if err := r.MarkEmailVerified(id, "changed@example.com", at); err != nil {
+			t.Fatal(err)
+		}
+		user, err := r.GetUserByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.PasswordHash != "new-hash" {
+			t.Errorf("PasswordHash = %q, want new-hash", user.PasswordHash)
+		}
+		if user.EmailVerifiedAt != nil {
+			t.Errorf("verifying another address set EmailVerifiedAt = %v", user.EmailVerifiedAt)
+		}
+
+		if err := r.MarkEmailVerified(id, email, at); err != nil {
+			t.Fatal(err)
+		}
+		if user, err = r.GetUserByID(id); err != nil {
+			t.Fatal(err)
+		}
+		if user.EmailVerifiedAt == nil || !user.EmailVerifiedAt.Equal(at) {
+			t.Errorf("EmailVerifiedAt = %v, want %v", user.EmailVerifiedAt, at)
+		}
+
+		if err := r.DeleteUser(id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.GetUserByID(id); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetUserByID after DeleteUser: err = %v, want ErrUserNotFound", err)
+		}
+		if err := r.DeleteUser(id); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("DeleteUser twice: err = %v, want ErrUserNotFound", err)
+		}
+	})
+}
+
+func TestRepositoryConnections(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		userID := createRepoUser(t, r)
+		otherID := createRepoUser(t, r)
+
+		create := func(name string, tags ...string) int64 {
+			t.Helper()
+			id, err := r.CreateConnection(userID, &ConnectionRecord{
+				Name: name, Host: name + ".example.com", Port: 22, Username: "deploy", AuthType: "password",
+			}, tags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return id
+		}
+		alpha := create("alpha", "prod", "web")
+		bravo := create("Bravo", "prod")
+		charlie := create("charlie")
+
+		if err := r.SetFavorite(bravo, userID, true); err != nil {
+			t.Fatal(err)
+		}
+		used := dbNow()
+		if err := r.TouchConnection(charlie, userID, used); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.TouchConnection(alpha, userID, used.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name   string
+			filter SSHConnectionFilter
+			want   []string
+		}{
+			{name: "all", filter: SSHConnectionFilter{Sort: "created", Order: "asc"}, want: []string{"alpha", "Bravo", "charlie"}},
+			{name: "created desc", filter: SSHConnectionFilter{Sort: "created", Order: "desc"}, want: []string{"charlie", "Bravo", "alpha"}},
+			{name: "name asc", filter: SSHConnectionFilter{Sort: "name", Order: "asc"}, want: []string{"alpha", "Bravo", "charlie"}},
+			{name: "name desc", filter: SSHConnectionFilter{Sort: "name", Order: "desc"}, want: []string{"charlie", "Bravo", "alpha"}},
+			{name: "last used", filter: SSHConnectionFilter{Sort: "last_used", Order: "desc"}, want: []string{"alpha", "charlie", "Bravo"}},
+			{name: "used only", filter: SSHConnectionFilter{Sort: "last_used", Order: "asc", UsedOnly: true}, want: []string{"charlie", "alpha"}},
+			{name: "search name", filter: SSHConnectionFilter{Sort: "name", Order: "asc", Search: "BRAV"}, want: []string{"Bravo"}},
+			{name: "search tag", filter: SSHConnectionFilter{Sort: "name", Order: "asc", Search: "web"}, want: []string{"alpha"}},
+			{name: "search literal", filter: SSHConnectionFilter{Sort: "name", Order: "asc", Search: "%"}, want: nil},
+			{name: "tag", filter: SSHConnectionFilter{Sort: "name", Order: "asc", Tags: []string{"prod"}}, want: []string{"alpha", "Bravo"}},
+			{name: "all tags", filter: SSHConnectionFilter{Sort: "name", Order: "asc", Tags: []string{"prod", "web"}}, want: []string{"alpha"}},
+			{name: "favorites", filter: SSHConnectionFilter{Sort: "name", Order: "asc", Favorites: true}, want: []string{"Bravo"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := r.ListConnections(userID, tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := connectionNames(page.Connections); !slices.Equal(got, tt.want) {
+					t.Errorf("unpaged: got %v, want %v", got, tt.want)
+				}
+				if page.NextCursor != "" {
+					t.Errorf("unpaged: NextCursor = %q, want none", page.NextCursor)
+				}
+
+				// Walking one connection at a time must see the same list.
+				var got []string
+				filter := tt.filter
+				filter.Limit = 1
+				for range len(tt.want) + 1 {
+					page, err := r.ListConnections(userID, filter)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, connectionNames(page.Connections)...)
+					if page.NextCursor == "" {
+						break
+					}
+					filter.Cursor = page.NextCursor
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("paged: got %v, want %v", got, tt.want)
+				}
+			})
+		}
+
+		page, err := r.ListConnections(userID, SSHConnectionFilter{Sort: "name", Order: "asc", Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = r.ListConnections(userID, SSHConnectionFilter{Sort: "created", Order: "asc", Limit: 1, Cursor: page.NextCursor})
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor of another sort: err = %v, want ErrInvalidCursor", err)
+		}
+
+		conn, err := r.GetConnection(alpha, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.Host != "alpha.example.com" || !slices.Equal(sortedTags(conn.Tags), []string{"prod", "web"}) {
+			t.Errorf("GetConnection: got host %q, tags %v", conn.Host, conn.Tags)
+		}
+		if _, err := r.GetConnection(alpha, otherID); !errors.Is(err, ErrConnectionNotFound) {
+			t.Errorf("GetConnection of another user: err = %v, want ErrConnectionNotFound", err)
+		}
+
+		tags, err := r.GetUserTags(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 2 || tags["prod"] != 2 || tags["web"] != 1 {
+			t.Errorf("GetUserTags = %v, want prod:2 web:1", tags)
+		}
+
+		rec := &ConnectionRecord{Name: "alpha", Host: "alpha2.example.com", Port: 2222, Username: "deploy", AuthType: "password"}
+		if err := r.UpdateConnection(alpha, userID, rec, []string{"dev"}); err != nil {
+			t.Fatal(err)
+		}
+		rec.Port = 2200
+		if err := r.UpdateConnection(alpha, userID, rec, nil); err != nil {
+			t.Fatal(err)
+		}
+		if conn, err = r.GetConnection(alpha, userID); err != nil {
+			t.Fatal(err)
+		}
+		if conn.Host != "alpha2.example.com" || conn.Port != 2200 || !slices.Equal(conn.Tags, []string{"dev"}) {
+			t.Errorf("after UpdateConnection: got host %q, port %d, tags %v", conn.Host, conn.Port, conn.Tags)
+		}
+
+		if err := r.DeleteConnection(bravo, userID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.GetConnection(bravo, userID); !errors.Is(err, ErrConnectionNotFound) {
+			t.Errorf("GetConnection after DeleteConnection: err = %v, want ErrConnectionNotFound", err)
+		}
+		if tags, err = r.GetUserTags(userID); err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 1 || tags["dev"] != 1 {
+			t.Errorf("GetUserTags after delete = %v, want dev:1", tags)
+		}
+	})
+}
+
+func connectionNames(connections []SSHConnection) []string {
+	var names []string
+	for _, c := range connections {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func sortedTags(tags []string) []string {
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+	return tags
+}
+
+func TestRepositorySessions(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		userID := createRepoUser(t, r)
+		otherID := createRepoUser(t, r)
+		connID, err := r.CreateConnection(userID, &ConnectionRecord{
+			Name: "server", Host: "server.example.com", Port: 22, Username: "deploy", AuthType: "password",
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		node, otherNode := testName("node"), testName("node")
+		start := dbNow()
+		failed, err := r.StartSession(userID, connID, node, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale, err := r.StartSession(userID, connID, node, start.Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		elsewhere, err := r.StartSession(userID, connID, otherNode, start.Add(2*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg := "connection refused"
+		if err := r.EndSession(failed, SessionStatusFailed, &msg, start.Add(3*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.CloseStaleSessions(node, start.Add(4*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		sessions, err := r.GetConnectionSessions(connID, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []struct {
+			id      int64
+			status  string
+			errMsg  *string
+			endedAt *time.Time
+		}{
+			{id: failed, status: SessionStatusFailed, errMsg: &msg, endedAt: ptr(start.Add(3 * time.Second))},
+			{id: stale, status: SessionStatusClosed, endedAt: ptr(start.Add(4 * time.Second))},
+			{id: elsewhere, status: SessionStatusActive},
+		}
+		if len(sessions) != len(want) {
+			t.Fatalf("GetConnectionSessions returned %d sessions, want %d", len(sessions), len(want))
+		}
+		for i, w := range want {
+			s := sessions[i]
+			if s.ID != w.id || s.Status != w.status || s.UserID != userID || s.ConnectionID != connID {
+				t.Errorf("session %d: got %+v, want id %d status %s", i, s, w.id, w.status)
+			}
+			if (s.ErrorMessage == nil) != (w.errMsg == nil) || (w.errMsg != nil && *s.ErrorMessage != *w.errMsg) {
+				t.Errorf("session %d: ErrorMessage = %v, want %v", i, s.ErrorMessage, w.errMsg)
+			}
+			if (s.EndedAt == nil) != (w.endedAt == nil) || (w.endedAt != nil && !s.EndedAt.Equal(*w.endedAt)) {
+				t.Errorf("session %d: EndedAt = %v, want %v", i, s.EndedAt, w.endedAt)
+			}
+		}
+
+		if sessions, err = r.GetConnectionSessions(connID, otherID); err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 0 {
+			t.Errorf("GetConnectionSessions of another user returned %d sessions", len(sessions))
+		}
+	})
+}
+
+func TestRepositoryConnectionStats(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		userID := createRepoUser(t, r)
+		otherID := createRepoUser(t, r)
+		connID, err := r.CreateConnection(userID, &ConnectionRecord{
+			Name: "server", Host: "server.example.com", Port: 22, Username: "deploy", AuthType: "password",
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stats, err := r.GetConnectionStats(connID, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.OpenCount != 0 || stats.FailedCount != 0 || stats.ActiveCount != 0 || stats.TotalSessionSeconds != 0 ||
+			stats.LastConnectedAt != nil || stats.LastError != nil || stats.LastErrorAt != nil {
+			t.Errorf("stats without sessions = %+v", stats)
+		}
+
+		node := testName("node")
+		start := dbNow()
+		session := func(userID int64, at time.Duration, status string, errMsg *string, length time.Duration) {
+			t.Helper()
+			id, err := r.StartSession(userID, connID, node, start.Add(at))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status == SessionStatusActive {
+				return
+			}
+			if err := r.EndSession(id, status, errMsg, start.Add(at+length)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lost := "connection lost"
+		session(userID, 0, SessionStatusClosed, nil, 90*time.Second)
+		session(userID, 100*time.Second, SessionStatusFailed, ptr("connection refused"), time.Second)
+		session(userID, 200*time.Second, SessionStatusClosed, &lost, 30*time.Second)
+		// Still dialing or connected, so neither opened nor timed.
+		session(userID, 300*time.Second, SessionStatusActive, nil, 0)
+		session(otherID, 400*time.Second, SessionStatusFailed, ptr("other user"), time.Second)
+
+		if stats, err = r.GetConnectionStats(connID, userID); err != nil {
+			t.Fatal(err)
+		}
+		if stats.ConnectionID != connID || stats.OpenCount != 2 || stats.FailedCount != 1 || stats.ActiveCount != 1 {
+			t.Errorf("counts = %+v, want 2 opened, 1 failed, 1 active", stats)
+		}
+		if stats.TotalSessionSeconds != 120 {
+			t.Errorf("TotalSessionSeconds = %d, want 120", stats.TotalSessionSeconds)
+		}
+		if want := start.Add(200 * time.Second); stats.LastConnectedAt == nil || !stats.LastConnectedAt.Equal(want) {
+			t.Errorf("LastConnectedAt = %v, want %v", stats.LastConnectedAt, want)
+		}
+		if stats.LastError == nil || *stats.LastError != lost {
+			t.Errorf("LastError = %v, want %q", stats.LastError, lost)
+		}
+		if want := start.Add(230 * time.Second); stats.LastErrorAt == nil || !stats.LastErrorAt.Equal(want) {
+			t.Errorf("LastErrorAt = %v, want %v", stats.LastErrorAt, want)
+		}
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestRepositoryRefreshTokens(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		userID := createRepoUser(t, r)
+		now := dbNow()
+		first, second := testName("token"), testName("token")
+
+		sessionID, err := r.CreateAuthSession(userID, "test", "127.0.0.1", first, now, now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := r.GetRefreshToken(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.SessionID != sessionID || token.UsedAt != nil {
+			t.Fatalf("GetRefreshToken = %+v", token)
+		}
+		if err := r.RotateRefreshToken(token, second, now, now.Add(2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.RotateRefreshToken(token, testName("token"), now, now.Add(2*time.Hour)); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Errorf("rotating a used token: err = %v, want ErrRefreshTokenReused", err)
+		}
+
+		if token, err = r.GetRefreshToken(first); err != nil {
+			t.Fatal(err)
+		}
+		if token.UsedAt == nil {
+			t.Error("rotated token has no UsedAt")
+		}
+		if _, err := r.GetRefreshToken(second); err != nil {
+			t.Errorf("GetRefreshToken of the new token: %v", err)
+		}
+		if _, err := r.GetRefreshToken(testName("token")); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("GetRefreshToken of an unknown token: err = %v, want ErrInvalidRefreshToken", err)
+		}
+
+		session, err := r.GetAuthSession(sessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !session.ExpiresAt.Equal(now.Add(2 * time.Hour)) {
+			t.Errorf("ExpiresAt = %v, want the rotated expiry %v", session.ExpiresAt, now.Add(2*time.Hour))
+		}
+
+		if err := r.RevokeUserAuthSession(sessionID, userID, "logout", now); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.RevokeUserAuthSession(sessionID, userID, "logout", now); !errors.Is(err, ErrAuthSessionNotFound) {
+			t.Errorf("revoking twice: err = %v, want ErrAuthSessionNotFound", err)
+		}
+		active, err := r.GetActiveAuthSessions(userID, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(active) != 0 {
+			t.Errorf("GetActiveAuthSessions after revoke returned %d sessions", len(active))
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	SettingSessionIdleTimeout = "session_idle_timeout"
+	SettingSessionMaxDuration = "session_max_duration"
+	SettingSessionWarning     = "session_warning"
+
+	// DefaultSessionWarning is how long before a forced disconnect the user
+	// is warned, unless configured otherwise.
+	DefaultSessionWarning = 5 * 60
+
+	maxSessionLimit = 30 * 24 * 60 * 60
+)
+
+// durationSettingEnv is settingEnv for the session policy, whose values are
+// given as Go durations, e.g. "30m", and stored in seconds.
+var durationSettingEnv = map[string]string{
+	SettingSessionIdleTimeout: "SESSION_IDLE_TIMEOUT",
+	SettingSessionMaxDuration: "SESSION_MAX_DURATION",
+	SettingSessionWarning:     "SESSION_WARNING",
+}
+
+// SessionPolicy limits terminal sessions. Times are in seconds and 0 sets no
+// limit.
+type SessionPolicy struct {
+	IdleTimeout        int `json:"idle_timeout"`
+	MaxSessionDuration int `json:"max_session_duration"`
+	// Warning is how long before a limit is reached the user is warned.
+	Warning int `json:"warning"`
+}
+
+// TeamSessionPolicy is the session policy of a team. Nil limits are unset.
+type TeamSessionPolicy struct {
+	TeamID             int64  `json:"team_id"`
+	TeamName           string `json:"team_name"`
+	IdleTimeout        *int   `json:"idle_timeout"`
+	MaxSessionDuration *int   `json:"max_session_duration"`
+}
+
+func initDurationSettings() error {
+	for key, env := range durationSettingEnv {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("%s: invalid duration %q", env, v)
+		}
+		if err := SetIntSetting(key, int(d/time.Second)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSessionLimits(limits ...*int) error {
+	for _, limit := range limits {
+		if limit != nil && (*limit < 0 || *limit > maxSessionLimit) {
+			return invalidInput("Session limits must be between 0 and %d seconds", maxSessionLimit)
+		}
+	}
+	return nil
+}
+
+// GetGlobalSessionPolicy returns the session policy that applies to everyone.
+func GetGlobalSessionPolicy() (SessionPolicy, error) {
+	var policy SessionPolicy
+	var err error
+	if policy.IdleTimeout, err = GetIntSetting(SettingSessionIdleTimeout, 0); err != nil {
+		return policy, err
+	}
+	if policy.MaxSessionDuration, err = GetIntSetting(SettingSessionMaxDuration, 0); err != nil {
+		return policy, err
+	}
+	if policy.Warning, err = GetIntSetting(SettingSessionWarning, DefaultSessionWarning); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+func SetGlobalSessionPolicy(policy SessionPolicy) error {
+	if err := validateSessionLimits(&policy.IdleTimeout, &policy.MaxSessionDuration, &policy.Warning); err != nil {
+		return err
+	}
+	settings := map[string]int{
+		SettingSessionIdleTimeout: policy.IdleTimeout,
+		SettingSessionMaxDuration: policy.MaxSessionDuration,
+		SettingSessionWarning:     policy.Warning,
+	}
+	for key, value := range settings {
+		if err := SetIntSetting(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetTeamSessionPolicies() ([]TeamSessionPolicy, error) {
+	return repo.GetTeamSessionPolicies(0)
+}
+
+// SetTeamSessionPolicy sets a team's limits; nil clears a limit.
+func SetTeamSessionPolicy(teamID int64, idleTimeout, maxSessionDuration *int) error {
+	if err := validateSessionLimits(idleTimeout, maxSessionDuration); err != nil {
+		return err
+	}
+	return repo.SetTeamSessionPolicy(teamID, idleTimeout, maxSessionDuration)
+}
+
+// GetSessionPolicy returns the policy for the user's sessions on conn: for
+// each limit, the strictest of the global one, those of the user's teams and
+// the connection's own.
+func GetSessionPolicy(userID int64, conn *SSHConnection) (SessionPolicy, error) {
+	policy, err := GetGlobalSessionPolicy()
+	if err != nil {
+		return policy, err
+	}
+
+	teams, err := repo.GetTeamSessionPolicies(userID)
+	if err != nil {
+		return policy, err
+	}
+
+	for _, t := range teams {
+		policy.IdleTimeout = stricterLimit(policy.IdleTimeout, t.IdleTimeout)
+		policy.MaxSessionDuration = stricterLimit(policy.MaxSessionDuration, t.MaxSessionDuration)
+	}
+	policy.IdleTimeout = stricterLimit(policy.IdleTimeout, conn.IdleTimeout)
+	policy.MaxSessionDuration = stricterLimit(policy.MaxSessionDuration, conn.MaxSessionDuration)
+	return policy, nil
+}
+
+func stricterLimit(limit int, other *int) int {
+	if other == nil || *other == 0 {
+		return limit
+	}
+	if limit == 0 {
+		return *other
+	}
+	return min(limit, *other)
+}
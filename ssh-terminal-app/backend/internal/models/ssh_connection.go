@@ -2,99 +2,733 @@ package models
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"os"
+	"regexp"
 	"ssh-terminal-app/internal/crypto"
-	"ssh-terminal-app/internal/database"
+	"strings"
 	"time"
 )
 
+const (
+	maxTagsPerConnection = 32
+	maxTagLength         = 64
+
+	MaxKeepaliveInterval  = 3600
+	MaxKeepaliveMaxMissed = 100
+	MaxConnectionSessions = 100
+
+	SessionManagerTmux   = "tmux"
+	SessionManagerScreen = "screen"
+
+	DefaultConnectionPageSize = 100
+	MaxConnectionPageSize     = 500
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sessionNamePattern keeps session names safe to pass to a remote shell.
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Fields a connection can inherit from its template.
+const (
+	FieldPort             = "port"
+	FieldUsername         = "username"
+	FieldAuthType         = "auth_type"
+	FieldPassword         = "password"
+	FieldPrivateKey       = "private_key"
+	FieldJumpConnectionID = "jump_connection_id"
+	FieldTermType         = "term_type"
+
+	SourceConnection = "connection"
+	SourceTemplate   = "template"
+)
+
+var templateFields = []string{FieldPort, FieldUsername, FieldAuthType, FieldPassword, FieldPrivateKey, FieldJumpConnectionID, FieldTermType}
+
 type SSHConnection struct {
-	ID                  int64     `json:"id"`
-	UserID              int64     `json:"user_id"`
-	Name                string    `json:"name"`
-	Host                string    `json:"host"`
-	Port                int       `json:"port"`
-	Username            string    `json:"username"`
-	AuthType            string    `json:"auth_type"`
-	PasswordEncrypted   *string   `json:"-"`
-	PrivateKeyEncrypted *string   `json:"-"`
-	CreatedAt           time.Time `json:"created_at"`
-	UpdatedAt           time.Time `json:"updated_at"`
+	ID                  int64   `json:"id"`
+	UserID              int64   `json:"user_id"`
+	Name                string  `json:"name"`
+	Host                string  `json:"host"`
+	Port                int     `json:"port"`
+	Username            string  `json:"username"`
+	AuthType            string  `json:"auth_type"`
+	PasswordEncrypted   *string `json:"-"`
+	PrivateKeyEncrypted *string `json:"-"`
+	JumpConnectionID    *int64  `json:"jump_connection_id"`
+	TermType            string  `json:"term_type"`
+	// KeepaliveInterval is in seconds, 0 disables keepalives. Nil settings
+	// use the server defaults.
+	KeepaliveInterval  *int `json:"keepalive_interval"`
+	KeepaliveMaxMissed *int `json:"keepalive_max_missed"`
+	// AutoReconnect re-dials the connection when it drops while the
+	// terminal is open. SessionManager ("tmux" or "screen") runs the shell
+	// in the session SessionName, which a reconnect attaches to again.
+	AutoReconnect  bool   `json:"auto_reconnect"`
+	SessionManager string `json:"session_manager"`
+	SessionName    string `json:"session_name"`
+	// Terminal settings, see TerminalOptions.
+	InitialCols      int               `json:"initial_cols"`
+	InitialRows      int               `json:"initial_rows"`
+	TerminalModes    map[string]uint32 `json:"terminal_modes"`
+	Environment      map[string]string `json:"environment"`
+	StartupCommand   string            `json:"startup_command"`
+	WorkingDirectory string            `json:"working_directory"`
+	// IdleTimeout and MaxSessionDuration are in seconds. They and
+	// MaxSessions, a cap on open terminals, can only make the server's
+	// limits stricter.
+	IdleTimeout        *int       `json:"idle_timeout"`
+	MaxSessionDuration *int       `json:"max_session_duration"`
+	MaxSessions        *int       `json:"max_sessions"`
+	FolderID           *int64     `json:"folder_id"`
+	Tags               []string   `json:"tags"`
+	IsFavorite         bool       `json:"is_favorite"`
+	LastUsedAt         *time.Time `json:"last_used_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+
+	// TemplateID links the connection to an SSHTemplate. Fields listed in
+	// Overrides keep the connection's own value; every other template field
+	// is inherited when the connection is loaded.
+	TemplateID   *int64            `json:"template_id"`
+	TemplateName string            `json:"template_name,omitempty"`
+	Overrides    []string          `json:"overrides"`
+	Variables    map[string]string `json:"variables"`
+	FieldSources map[string]string `json:"field_sources"`
 }
 
+// SSHConnectionInput creates or replaces a connection. When the connection
+// has a template, every non-empty templatable field that differs from the
+// template becomes an override; empty fields and the template's own values
+// are inherited. Username is only required without a template.
 type SSHConnectionInput struct {
 	Name       string `json:"name" binding:"required"`
 	Host       string `json:"host" binding:"required"`
 	Port       int    `json:"port"`
-	Username   string `json:"username" binding:"required"`
+	Username   string `json:"username"`
 	AuthType   string `json:"auth_type"`
 	Password   string `json:"password"`
 	PrivateKey string `json:"private_key"`
+	TermType   string `json:"term_type"`
+	// KeepaliveInterval and KeepaliveMaxMissed are cleared when omitted.
+	KeepaliveInterval  *int              `json:"keepalive_interval"`
+	KeepaliveMaxMissed *int              `json:"keepalive_max_missed"`
+	AutoReconnect      bool              `json:"auto_reconnect"`
+	SessionManager     string            `json:"session_manager"`
+	SessionName        string            `json:"session_name"`
+	InitialCols        int               `json:"initial_cols"`
+	InitialRows        int               `json:"initial_rows"`
+	TerminalModes      map[string]uint32 `json:"terminal_modes"`
+	Environment        map[string]string `json:"environment"`
+	StartupCommand     string            `json:"startup_command"`
+	WorkingDirectory   string            `json:"working_directory"`
+	IdleTimeout        *int              `json:"idle_timeout"`
+	MaxSessionDuration *int              `json:"max_session_duration"`
+	MaxSessions        *int              `json:"max_sessions"`
+	// Tags replaces the connection's tags when present; omit it to keep them.
+	Tags []string `json:"tags"`
+	// FolderID moves the connection when present; 0 moves it to the root.
+	FolderID *int64 `json:"folder_id"`
+	// TemplateID attaches a template when present; 0 detaches it.
+	TemplateID *int64 `json:"template_id"`
+	// JumpConnectionID sets the bastion connection when present; 0 clears it.
+	JumpConnectionID *int64 `json:"jump_connection_id"`
+	// Variables replaces the connection's variables when present.
+	Variables map[string]string `json:"variables"`
+	// Inherit lists fields whose override is dropped in favor of the template.
+	Inherit []string `json:"inherit"`
+}
+
+// SSHConnectionFilter describes a page of the connection list.
+type SSHConnectionFilter struct {
+	Search    string
+	Tags      []string
+	FolderID  *int64 // 0 selects connections without a folder
+	Recursive bool   // include connections in subfolders of FolderID
+	Favorites bool   // only favorite connections
+	UsedOnly  bool   // only connections that have been opened at least once
+	Sort      string // "name", "last_used" or "created"
+	Order     string // "asc" or "desc"
+	Cursor    string
+	Limit     int
+}
+
+type SSHConnectionPage struct {
+	Connections []SSHConnection
+	NextCursor  string
+}
+
+type connectionCursor struct {
+	Sort     string     `json:"s"`
+	Order    string     `json:"o"`
+	Name     string     `json:"n,omitempty"`
+	LastUsed *time.Time `json:"l,omitempty"`
+	ID       int64      `json:"id"`
 }
 
 type SSHConnectionResponse struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Name      string    `json:"name"`
-	Host      string    `json:"host"`
-	Port      int       `json:"port"`
-	Username  string    `json:"username"`
-	AuthType  string    `json:"auth_type"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                 int64             `json:"id"`
+	UserID             int64             `json:"user_id"`
+	Name               string            `json:"name"`
+	Host               string            `json:"host"`
+	Port               int               `json:"port"`
+	Username           string            `json:"username"`
+	AuthType           string            `json:"auth_type"`
+	JumpConnectionID   *int64            `json:"jump_connection_id"`
+	TermType           string            `json:"term_type"`
+	KeepaliveInterval  *int              `json:"keepalive_interval"`
+	KeepaliveMaxMissed *int              `json:"keepalive_max_missed"`
+	AutoReconnect      bool              `json:"auto_reconnect"`
+	SessionManager     string            `json:"session_manager"`
+	SessionName        string            `json:"session_name"`
+	InitialCols        int               `json:"initial_cols"`
+	InitialRows        int               `json:"initial_rows"`
+	TerminalModes      map[string]uint32 `json:"terminal_modes"`
+	Environment        map[string]string `json:"environment"`
+	StartupCommand     string            `json:"startup_command"`
+	WorkingDirectory   string            `json:"working_directory"`
+	IdleTimeout        *int              `json:"idle_timeout"`
+	MaxSessionDuration *int              `json:"max_session_duration"`
+	MaxSessions        *int              `json:"max_sessions"`
+	FolderID           *int64            `json:"folder_id"`
+	Tags               []string          `json:"tags"`
+	IsFavorite         bool              `json:"is_favorite"`
+	LastUsedAt         *time.Time        `json:"last_used_at"`
+	TemplateID         *int64            `json:"template_id"`
+	TemplateName       string            `json:"template_name,omitempty"`
+	Overrides          []string          `json:"overrides"`
+	Variables          map[string]string `json:"variables"`
+	FieldSources       map[string]string `json:"field_sources"`
+	CreatedAt          time.Time         `json:"created_at"`
+	UpdatedAt          time.Time         `json:"updated_at"`
 }
 
 func (c *SSHConnection) ToResponse() SSHConnectionResponse {
+	tags := c.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	overrides := c.Overrides
+	if overrides == nil {
+		overrides = []string{}
+	}
+	variables := c.Variables
+	if variables == nil {
+		variables = map[string]string{}
+	}
+	terminalModes := c.TerminalModes
+	if terminalModes == nil {
+		terminalModes = map[string]uint32{}
+	}
+	environment := c.Environment
+	if environment == nil {
+		environment = map[string]string{}
+	}
 	return SSHConnectionResponse{
-		ID:        c.ID,
-		UserID:    c.UserID,
-		Name:      c.Name,
-		Host:      c.Host,
-		Port:      c.Port,
-		Username:  c.Username,
-		AuthType:  c.AuthType,
-		CreatedAt: c.CreatedAt,
-		UpdatedAt: c.UpdatedAt,
+		ID:                 c.ID,
+		UserID:             c.UserID,
+		Name:               c.Name,
+		Host:               c.Host,
+		Port:               c.Port,
+		Username:           c.Username,
+		AuthType:           c.AuthType,
+		JumpConnectionID:   c.JumpConnectionID,
+		TermType:           c.TermType,
+		KeepaliveInterval:  c.KeepaliveInterval,
+		KeepaliveMaxMissed: c.KeepaliveMaxMissed,
+		AutoReconnect:      c.AutoReconnect,
+		SessionManager:     c.SessionManager,
+		SessionName:        c.SessionName,
+		InitialCols:        c.InitialCols,
+		InitialRows:        c.InitialRows,
+		TerminalModes:      terminalModes,
+		Environment:        environment,
+		StartupCommand:     c.StartupCommand,
+		WorkingDirectory:   c.WorkingDirectory,
+		IdleTimeout:        c.IdleTimeout,
+		MaxSessionDuration: c.MaxSessionDuration,
+		MaxSessions:        c.MaxSessions,
+		FolderID:           c.FolderID,
+		Tags:               tags,
+		IsFavorite:         c.IsFavorite,
+		LastUsedAt:         c.LastUsedAt,
+		TemplateID:         c.TemplateID,
+		TemplateName:       c.TemplateName,
+		Overrides:          overrides,
+		Variables:          variables,
+		FieldSources:       c.FieldSources,
+		CreatedAt:          c.CreatedAt,
+		UpdatedAt:          c.UpdatedAt,
 	}
 }
 
-func CreateSSHConnection(userID int64, input SSHConnectionInput) (*SSHConnection, error) {
-	if input.Port == 0 {
-		input.Port = 22
+const sshConnectionColumns = `c.id, c.user_id, c.name, c.host, c.port, c.username, c.auth_type, c.password_encrypted, c.private_key_encrypted, 
+	c.folder_id, c.last_used_at, c.created_at, c.updated_at, 
+	c.template_id, c.overrides, c.jump_connection_id, c.term_type, c.variables,
+	c.keepalive_interval, c.keepalive_max_missed, c.auto_reconnect, c.session_manager, c.session_name,
+	c.initial_cols, c.initial_rows, c.terminal_modes, c.environment, c.startup_command, c.working_directory,
+	c.idle_timeout, c.max_session_duration, c.max_sessions,
+	EXISTS (SELECT 1 FROM ssh_favorites f WHERE f.connection_id = c.id AND f.user_id = c.user_id)`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSSHConnection(row rowScanner, conn *SSHConnection) error {
+	var folderID sql.NullInt64
+	var lastUsedAt sql.NullTime
+	var templateID sql.NullInt64
+	var overrides sql.NullString
+	var jumpConnectionID sql.NullInt64
+	var termType sql.NullString
+	var variables sql.NullString
+	var keepaliveInterval, keepaliveMaxMissed sql.NullInt64
+	var sessionManager, sessionName sql.NullString
+	var initialCols, initialRows sql.NullInt64
+	var idleTimeout, maxSessionDuration, maxSessions sql.NullInt64
+	var terminalModes, environment, startupCommand, workingDirectory sql.NullString
+	err := row.Scan(&conn.ID, &conn.UserID, &conn.Name, &conn.Host, &conn.Port, &conn.Username, &conn.AuthType, &conn.PasswordEncrypted, &conn.PrivateKeyEncrypted,
+		&folderID, &lastUsedAt, &conn.CreatedAt, &conn.UpdatedAt,
+		&templateID, &overrides, &jumpConnectionID, &termType, &variables,
+		&keepaliveInterval, &keepaliveMaxMissed, &conn.AutoReconnect, &sessionManager, &sessionName,
+		&initialCols, &initialRows, &terminalModes, &environment, &startupCommand, &workingDirectory,
+		&idleTimeout, &maxSessionDuration, &maxSessions,
+		&conn.IsFavorite)
+	if err != nil {
+		return err
 	}
 
-	if input.AuthType == "" {
-		input.AuthType = "password"
+	if templateID.Valid {
+		conn.TemplateID = &templateID.Int64
+	}
+	if overrides.Valid && overrides.String != "" {
+		conn.Overrides = strings.Split(overrides.String, ",")
+	}
+	if jumpConnectionID.Valid {
+		conn.JumpConnectionID = &jumpConnectionID.Int64
+	}
+	conn.TermType = termType.String
+	conn.KeepaliveInterval = optionalInt(keepaliveInterval)
+	conn.KeepaliveMaxMissed = optionalInt(keepaliveMaxMissed)
+	conn.SessionManager = sessionManager.String
+	conn.SessionName = sessionName.String
+	conn.InitialCols = int(initialCols.Int64)
+	conn.InitialRows = int(initialRows.Int64)
+	if terminalModes.Valid && terminalModes.String != "" {
+		if err := json.Unmarshal([]byte(terminalModes.String), &conn.TerminalModes); err != nil {
+			return err
+		}
+	}
+	if environment.Valid && environment.String != "" {
+		if err := json.Unmarshal([]byte(environment.String), &conn.Environment); err != nil {
+			return err
+		}
+	}
+	conn.StartupCommand = startupCommand.String
+	conn.WorkingDirectory = workingDirectory.String
+	conn.IdleTimeout = optionalInt(idleTimeout)
+	conn.MaxSessionDuration = optionalInt(maxSessionDuration)
+	conn.MaxSessions = optionalInt(maxSessions)
+	if conn.Variables, err = decodeVariables(variables); err != nil {
+		return err
 	}
 
-	var passwordEncrypted *string
-	if input.Password != "" {
-		encrypted, err := crypto.Encrypt(input.Password)
-		if err != nil {
-			return nil, err
+	if folderID.Valid {
+		conn.FolderID = &folderID.Int64
+	}
+	if lastUsedAt.Valid {
+		conn.LastUsedAt = &lastUsedAt.Time
+	}
+	return nil
+}
+
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, errors.New("tag is too long")
 		}
-		passwordEncrypted = &encrypted
+		seen[tag] = true
+		result = append(result, tag)
 	}
+	if len(result) > maxTagsPerConnection {
+		return nil, errors.New("too many tags")
+	}
+	return result, nil
+}
 
-	var privateKeyEncrypted *string
-	if input.PrivateKey != "" {
-		encrypted, err := crypto.Encrypt(input.PrivateKey)
-		if err != nil {
+// resolveFolderInput validates a folder reference from SSHConnectionInput and
+// returns the value to store: nil for the root folder.
+func resolveFolderInput(userID int64, folderID *int64) (*int64, error) {
+	if folderID == nil || *folderID == 0 {
+		return nil, nil
+	}
+	if _, err := GetFolderByID(*folderID, userID); err != nil {
+		return nil, err
+	}
+	return folderID, nil
+}
+
+func (c *SSHConnection) isOverridden(field string) bool {
+	for _, f := range c.Overrides {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTemplate replaces inherited fields with the template's values and
+// expands ${variable} references in the host and username.
+func (c *SSHConnection) applyTemplate(t *SSHTemplate) {
+	c.FieldSources = make(map[string]string, len(templateFields))
+	for _, field := range templateFields {
+		c.FieldSources[field] = SourceConnection
+	}
+
+	variables := map[string]string{}
+	if t != nil {
+		c.TemplateName = t.Name
+		for k, v := range t.Variables {
+			variables[k] = v
+		}
+
+		inherit := func(field string, hasValue bool, apply func()) {
+			if hasValue && !c.isOverridden(field) {
+				apply()
+				c.FieldSources[field] = SourceTemplate
+			}
+		}
+		inherit(FieldPort, t.Port != nil, func() { c.Port = *t.Port })
+		inherit(FieldUsername, t.Username != nil, func() { c.Username = *t.Username })
+		inherit(FieldAuthType, t.AuthType != nil, func() { c.AuthType = *t.AuthType })
+		inherit(FieldPassword, t.PasswordEncrypted != nil, func() { c.PasswordEncrypted = t.PasswordEncrypted })
+		inherit(FieldPrivateKey, t.PrivateKeyEncrypted != nil, func() { c.PrivateKeyEncrypted = t.PrivateKeyEncrypted })
+		inherit(FieldJumpConnectionID, t.JumpConnectionID != nil, func() { c.JumpConnectionID = t.JumpConnectionID })
+		inherit(FieldTermType, t.TermType != nil, func() { c.TermType = *t.TermType })
+	}
+	for k, v := range c.Variables {
+		variables[k] = v
+	}
+
+	variables["name"] = c.Name
+	c.Host = expandVariables(c.Host, variables)
+	variables["host"] = c.Host
+	c.Username = expandVariables(c.Username, variables)
+}
+
+func expandVariables(s string, variables map[string]string) string {
+	return os.Expand(s, func(name string) string {
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		return "${" + name + "}"
+	})
+}
+
+func applySSHTemplates(userID int64, connections []SSHConnection) error {
+	var templates map[int64]*SSHTemplate
+	for i := range connections {
+		if connections[i].TemplateID != nil && templates == nil {
+			list, err := GetSSHTemplatesByUserID(userID)
+			if err != nil {
+				return err
+			}
+			templates = make(map[int64]*SSHTemplate, len(list))
+			for j := range list {
+				templates[list[j].ID] = &list[j]
+			}
+		}
+	}
+
+	for i := range connections {
+		var t *SSHTemplate
+		if connections[i].TemplateID != nil {
+			t = templates[*connections[i].TemplateID]
+		}
+		connections[i].applyTemplate(t)
+	}
+	return nil
+}
+
+// ConnectionRecord is the stored form of a connection built from input.
+type ConnectionRecord struct {
+	Name                string
+	Host                string
+	Port                int
+	Username            string
+	AuthType            string
+	PasswordEncrypted   *string
+	PrivateKeyEncrypted *string
+	TermType            *string
+	KeepaliveInterval   *int
+	KeepaliveMaxMissed  *int
+	AutoReconnect       bool
+	SessionManager      *string
+	SessionName         *string
+	InitialCols         *int
+	InitialRows         *int
+	TerminalModes       *string
+	Environment         *string
+	StartupCommand      *string
+	WorkingDirectory    *string
+	IdleTimeout         *int
+	MaxSessionDuration  *int
+	MaxSessions         *int
+	FolderID            *int64
+	TemplateID          *int64
+	JumpConnectionID    *int64
+	Overrides           []string
+	Variables           *string
+
+	// On update, an empty secret keeps the stored one unless it is cleared.
+	ClearPassword   bool
+	ClearPrivateKey bool
+}
+
+// buildConnectionRecord validates input against the existing connection (nil
+// on create) and computes the values to store, including overrides.
+func buildConnectionRecord(userID int64, input SSHConnectionInput, existing *SSHConnection) (*ConnectionRecord, error) {
+	rec := &ConnectionRecord{
+		Name:     input.Name,
+		Host:     input.Host,
+		Port:     input.Port,
+		Username: input.Username,
+		AuthType: input.AuthType,
+		TermType: optionalString(input.TermType),
+
+		KeepaliveInterval:  input.KeepaliveInterval,
+		KeepaliveMaxMissed: input.KeepaliveMaxMissed,
+		AutoReconnect:      input.AutoReconnect,
+		SessionManager:     optionalString(input.SessionManager),
+		SessionName:        optionalString(input.SessionName),
+		StartupCommand:     optionalString(input.StartupCommand),
+		WorkingDirectory:   optionalString(input.WorkingDirectory),
+		IdleTimeout:        input.IdleTimeout,
+		MaxSessionDuration: input.MaxSessionDuration,
+		MaxSessions:        input.MaxSessions,
+	}
+
+	if rec.AuthType != "" && rec.AuthType != "password" && rec.AuthType != "key" {
+		return nil, invalidInput("Invalid auth_type. Must be 'password' or 'key'")
+	}
+	if rec.Port < 0 || rec.Port > 65535 {
+		return nil, invalidInput("Invalid port")
+	}
+	if v := rec.KeepaliveInterval; v != nil && (*v < 0 || *v > MaxKeepaliveInterval) {
+		return nil, invalidInput("keepalive_interval must be between 0 and %d seconds", MaxKeepaliveInterval)
+	}
+	if v := rec.KeepaliveMaxMissed; v != nil && (*v < 1 || *v > MaxKeepaliveMaxMissed) {
+		return nil, invalidInput("keepalive_max_missed must be between 1 and %d", MaxKeepaliveMaxMissed)
+	}
+	switch input.SessionManager {
+	case "":
+		if input.SessionName != "" {
+			return nil, invalidInput("session_name requires a session_manager")
+		}
+	case SessionManagerTmux, SessionManagerScreen:
+		if !sessionNamePattern.MatchString(input.SessionName) {
+			return nil, invalidInput("session_name must be 1 to 64 letters, digits, '.', '_' or '-'")
+		}
+	default:
+		return nil, invalidInput("Invalid session_manager. Must be %q or %q", SessionManagerTmux, SessionManagerScreen)
+	}
+	if err := validateSessionLimits(rec.IdleTimeout, rec.MaxSessionDuration); err != nil {
+		return nil, err
+	}
+	if v := rec.MaxSessions; v != nil && (*v < 1 || *v > MaxConnectionSessions) {
+		return nil, invalidInput("max_sessions must be between 1 and %d", MaxConnectionSessions)
+	}
+	if input.SessionManager != "" && input.StartupCommand != "" {
+		return nil, invalidInput("startup_command cannot be combined with session_manager")
+	}
+
+	terminal := TerminalOptions{
+		Term:    input.TermType,
+		Cols:    input.InitialCols,
+		Rows:    input.InitialRows,
+		Modes:   input.TerminalModes,
+		Env:     input.Environment,
+		Command: input.StartupCommand,
+		Cwd:     input.WorkingDirectory,
+	}
+	if err := terminal.Validate(); err != nil {
+		return nil, err
+	}
+	if input.InitialCols > 0 {
+		rec.InitialCols, rec.InitialRows = &input.InitialCols, &input.InitialRows
+	}
+	var err error
+	if rec.TerminalModes, err = encodeJSONObject(input.TerminalModes); err != nil {
+		return nil, err
+	}
+	if rec.Environment, err = encodeJSONObject(input.Environment); err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		rec.TemplateID = existing.TemplateID
+		// existing holds effective values; only keep a jump host that is
+		// the connection's own rather than inherited.
+		if existing.TemplateID == nil || existing.isOverridden(FieldJumpConnectionID) {
+			rec.JumpConnectionID = existing.JumpConnectionID
+		}
+	}
+	if input.TemplateID != nil {
+		rec.TemplateID = nil
+		if *input.TemplateID != 0 {
+			if _, err := GetSSHTemplateByID(*input.TemplateID, userID); err != nil {
+				return nil, invalidInput("Template not found")
+			}
+			rec.TemplateID = input.TemplateID
+		}
+	}
+	if input.JumpConnectionID != nil {
+		rec.JumpConnectionID = nil
+		if *input.JumpConnectionID != 0 {
+			if existing != nil && *input.JumpConnectionID == existing.ID {
+				return nil, invalidInput("A connection cannot be its own jump host")
+			}
+			if _, err := GetSSHConnectionByID(*input.JumpConnectionID, userID); err != nil {
+				return nil, invalidInput("Jump connection not found")
+			}
+			rec.JumpConnectionID = input.JumpConnectionID
+		}
+	}
+
+	if rec.PasswordEncrypted, err = encryptOptional(input.Password); err != nil {
+		return nil, err
+	}
+	if rec.PrivateKeyEncrypted, err = encryptOptional(input.PrivateKey); err != nil {
+		return nil, err
+	}
+
+	variables := input.Variables
+	if variables == nil && existing != nil {
+		variables = existing.Variables
+	}
+	if rec.Variables, err = encodeVariables(variables); err != nil {
+		return nil, err
+	}
+
+	var t *SSHTemplate
+	if rec.TemplateID != nil {
+		if t, err = GetSSHTemplateByID(*rec.TemplateID, userID); err != nil {
 			return nil, err
 		}
-		privateKeyEncrypted = &encrypted
 	}
 
-	result, err := database.DB.Exec(
-		`INSERT INTO ssh_connections (user_id, name, host, port, username, auth_type, password_encrypted, private_key_encrypted) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		userID, input.Name, input.Host, input.Port, input.Username, input.AuthType, passwordEncrypted, privateKeyEncrypted,
-	)
+	// Clients send back the effective values they were given, so a value
+	// equal to the template's is inherited rather than pinned.
+	sameAsTemplate := map[string]bool{}
+	if t != nil {
+		fromTemplate := &SSHConnection{Name: input.Name, Host: input.Host, Variables: variables}
+		fromTemplate.applyTemplate(t)
+		sameAsTemplate[FieldPort] = t.Port != nil && *t.Port == input.Port
+		sameAsTemplate[FieldUsername] = t.Username != nil &&
+			(input.Username == *t.Username || input.Username == fromTemplate.Username)
+		sameAsTemplate[FieldAuthType] = t.AuthType != nil && *t.AuthType == input.AuthType
+		sameAsTemplate[FieldJumpConnectionID] = t.JumpConnectionID != nil && rec.JumpConnectionID != nil &&
+			*t.JumpConnectionID == *rec.JumpConnectionID
+		sameAsTemplate[FieldTermType] = t.TermType != nil && *t.TermType == input.TermType
+	}
+
+	// Secrets left empty on update keep their stored value, so they also
+	// keep their override status.
+	inherit := make(map[string]bool)
+	for _, field := range input.Inherit {
+		inherit[field] = true
+	}
+	set := map[string]bool{
+		FieldPort:             input.Port != 0,
+		FieldUsername:         input.Username != "",
+		FieldAuthType:         input.AuthType != "",
+		FieldPassword:         input.Password != "" || (existing != nil && existing.isOverridden(FieldPassword)),
+		FieldPrivateKey:       input.PrivateKey != "" || (existing != nil && existing.isOverridden(FieldPrivateKey)),
+		FieldJumpConnectionID: rec.JumpConnectionID != nil,
+		FieldTermType:         input.TermType != "",
+	}
+	if rec.TemplateID != nil {
+		for _, field := range templateFields {
+			if set[field] && !inherit[field] && !sameAsTemplate[field] {
+				rec.Overrides = append(rec.Overrides, field)
+			}
+		}
+	}
+
+	// Check the effective result before storing anything.
+	preview := &SSHConnection{
+		Name:             input.Name,
+		Host:             input.Host,
+		Port:             rec.Port,
+		Username:         rec.Username,
+		AuthType:         rec.AuthType,
+		JumpConnectionID: rec.JumpConnectionID,
+		TemplateID:       rec.TemplateID,
+		Overrides:        rec.Overrides,
+		Variables:        variables,
+	}
+	if preview.AuthType == "" {
+		preview.AuthType = "password"
+	}
+	preview.PasswordEncrypted = rec.PasswordEncrypted
+	preview.PrivateKeyEncrypted = rec.PrivateKeyEncrypted
+	if existing != nil {
+		if preview.PasswordEncrypted == nil && !inherit[FieldPassword] {
+			preview.PasswordEncrypted = existing.PasswordEncrypted
+		}
+		if preview.PrivateKeyEncrypted == nil && !inherit[FieldPrivateKey] {
+			preview.PrivateKeyEncrypted = existing.PrivateKeyEncrypted
+		}
+	}
+	preview.applyTemplate(t)
+
+	if preview.Username == "" {
+		return nil, invalidInput("Username is required")
+	}
+	if preview.AuthType != "password" && preview.AuthType != "key" {
+		return nil, invalidInput("Invalid auth_type. Must be 'password' or 'key'")
+	}
+	if preview.AuthType == "password" && preview.PasswordEncrypted == nil {
+		return nil, invalidInput("Password is required for password authentication")
+	}
+	if preview.AuthType == "key" && preview.PrivateKeyEncrypted == nil {
+		return nil, invalidInput("Private key is required for key authentication")
+	}
+
+	if rec.Port == 0 {
+		rec.Port = 22
+	}
+	if rec.AuthType == "" {
+		rec.AuthType = "password"
+	}
+	return rec, nil
+}
+
+func CreateSSHConnection(userID int64, input SSHConnectionInput) (*SSHConnection, error) {
+	rec, err := buildConnectionRecord(userID, input, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	id, err := result.LastInsertId()
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if rec.FolderID, err = resolveFolderInput(userID, input.FolderID); err != nil {
+		return nil, err
+	}
+
+	id, err := repo.CreateConnection(userID, rec, tags)
 	if err != nil {
 		return nil, err
 	}
@@ -103,88 +737,138 @@ func CreateSSHConnection(userID int64, input SSHConnectionInput) (*SSHConnection
 }
 
 func GetSSHConnectionByID(id, userID int64) (*SSHConnection, error) {
-	conn := &SSHConnection{}
-	err := database.DB.QueryRow(
-		`SELECT id, user_id, name, host, port, username, auth_type, password_encrypted, private_key_encrypted, created_at, updated_at 
-		FROM ssh_connections WHERE id = ? AND user_id = ?`,
-		id, userID,
-	).Scan(&conn.ID, &conn.UserID, &conn.Name, &conn.Host, &conn.Port, &conn.Username, &conn.AuthType, &conn.PasswordEncrypted, &conn.PrivateKeyEncrypted, &conn.CreatedAt, &conn.UpdatedAt)
-
-	if err == sql.ErrNoRows {
-		return nil, errors.New("connection not found")
-	}
+	conn, err := repo.GetConnection(id, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	return conn, nil
+	connections := []SSHConnection{*conn}
+	if err := applySSHTemplates(userID, connections); err != nil {
+		return nil, err
+	}
+
+	return &connections[0], nil
 }
 
 func GetSSHConnectionsByUserID(userID int64) ([]SSHConnection, error) {
-	rows, err := database.DB.Query(
-		`SELECT id, user_id, name, host, port, username, auth_type, password_encrypted, private_key_encrypted, created_at, updated_at 
-		FROM ssh_connections WHERE user_id = ? ORDER BY created_at DESC`,
-		userID,
-	)
+	page, err := ListSSHConnections(userID, SSHConnectionFilter{Sort: "created", Limit: -1})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return page.Connections, nil
+}
 
-	var connections []SSHConnection
-	for rows.Next() {
-		var conn SSHConnection
-		err := rows.Scan(&conn.ID, &conn.UserID, &conn.Name, &conn.Host, &conn.Port, &conn.Username, &conn.AuthType, &conn.PasswordEncrypted, &conn.PrivateKeyEncrypted, &conn.CreatedAt, &conn.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		connections = append(connections, conn)
+func encodeConnectionCursor(cursor connectionCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeConnectionCursor(value string) (*connectionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
 	}
+	var cursor connectionCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
 
-	return connections, nil
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
 }
 
-func UpdateSSHConnection(id, userID int64, input SSHConnectionInput) (*SSHConnection, error) {
-	_, err := GetSSHConnectionByID(id, userID)
+// ListSSHConnections returns one page of the user's connections. A negative
+// Limit disables pagination.
+func ListSSHConnections(userID int64, filter SSHConnectionFilter) (*SSHConnectionPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = "created"
+	}
+	if filter.Order == "" {
+		if filter.Sort == "name" {
+			filter.Order = "asc"
+		} else {
+			filter.Order = "desc"
+		}
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultConnectionPageSize
+	}
+	if filter.Limit > MaxConnectionPageSize {
+		filter.Limit = MaxConnectionPageSize
+	}
+
+	tags, err := normalizeTags(filter.Tags)
 	if err != nil {
 		return nil, err
 	}
+	filter.Tags = tags
 
-	if input.Port == 0 {
-		input.Port = 22
+	page, err := repo.ListConnections(userID, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	if input.AuthType == "" {
-		input.AuthType = "password"
+	if err := applySSHTemplates(userID, page.Connections); err != nil {
+		return nil, err
 	}
+	return page, nil
+}
+
+// GetUserTags returns every tag used by the user with the number of
+// connections carrying it.
+func GetUserTags(userID int64) (map[string]int, error) {
+	return repo.GetUserTags(userID)
+}
+
+func SetSSHConnectionFavorite(id, userID int64, favorite bool) error {
+	if _, err := GetSSHConnectionByID(id, userID); err != nil {
+		return err
+	}
+	return repo.SetFavorite(id, userID, favorite)
+}
 
-	var passwordEncrypted *string
-	if input.Password != "" {
-		encrypted, err := crypto.Encrypt(input.Password)
+// TouchSSHConnection records that a terminal was opened on the connection.
+func TouchSSHConnection(id, userID int64) error {
+	return repo.TouchConnection(id, userID, dbNow())
+}
+
+func UpdateSSHConnection(id, userID int64, input SSHConnectionInput) (*SSHConnection, error) {
+	existing, err := GetSSHConnectionByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := buildConnectionRecord(userID, input, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.FolderID = existing.FolderID
+	if input.FolderID != nil {
+		rec.FolderID, err = resolveFolderInput(userID, input.FolderID)
 		if err != nil {
 			return nil, err
 		}
-		passwordEncrypted = &encrypted
 	}
 
-	var privateKeyEncrypted *string
-	if input.PrivateKey != "" {
-		encrypted, err := crypto.Encrypt(input.PrivateKey)
-		if err != nil {
+	inherit := make(map[string]bool)
+	for _, field := range input.Inherit {
+		inherit[field] = true
+	}
+	rec.ClearPassword = inherit[FieldPassword] && rec.PasswordEncrypted == nil
+	rec.ClearPrivateKey = inherit[FieldPrivateKey] && rec.PrivateKeyEncrypted == nil
+
+	var tags []string
+	if input.Tags != nil {
+		if tags, err = normalizeTags(input.Tags); err != nil {
 			return nil, err
 		}
-		privateKeyEncrypted = &encrypted
 	}
 
-	_, err = database.DB.Exec(
-		`UPDATE ssh_connections SET name = ?, host = ?, port = ?, username = ?, auth_type = ?, 
-		password_encrypted = COALESCE(?, password_encrypted), 
-		private_key_encrypted = COALESCE(?, private_key_encrypted),
-		updated_at = CURRENT_TIMESTAMP 
-		WHERE id = ? AND user_id = ?`,
-		input.Name, input.Host, input.Port, input.Username, input.AuthType, passwordEncrypted, privateKeyEncrypted, id, userID,
-	)
-	if err != nil {
+	if err := repo.UpdateConnection(id, userID, rec, tags); err != nil {
 		return nil, err
 	}
 
@@ -192,24 +876,7 @@ func UpdateSSHConnection(id, userID int64, input SSHConnectionInput) (*SSHConnec
 }
 
 func DeleteSSHConnection(id, userID int64) error {
-	result, err := database.DB.Exec(
-		`DELETE FROM ssh_connections WHERE id = ? AND user_id = ?`,
-		id, userID,
-	)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return errors.New("connection not found")
-	}
-
-	return nil
+	return repo.DeleteConnection(id, userID)
 }
 
 func (c *SSHConnection) GetDecryptedPassword() (string, error) {
@@ -225,3 +892,16 @@ func (c *SSHConnection) GetDecryptedPrivateKey() (string, error) {
 	}
 	return crypto.Decrypt(*c.PrivateKeyEncrypted)
 }
+
+// encodeJSONObject stores a map as JSON, or NULL when it is empty.
+func encodeJSONObject[V any](m map[string]V) (*string, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	encoded := string(data)
+	return &encoded, nil
+}
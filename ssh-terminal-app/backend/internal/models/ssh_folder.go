@@ -0,0 +1,161 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Folder struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ParentID  *int64    `json:"parent_id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type FolderInput struct {
+	Name     string `json:"name" binding:"required"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+var ErrFolderNotFound = errors.New("folder not found")
+
+func scanFolder(row rowScanner, folder *Folder) error {
+	var parentID sql.NullInt64
+	if err := row.Scan(&folder.ID, &folder.UserID, &parentID, &folder.Name, &folder.CreatedAt, &folder.UpdatedAt); err != nil {
+		return err
+	}
+	if parentID.Valid {
+		folder.ParentID = &parentID.Int64
+	}
+	return nil
+}
+
+// GetFoldersByUserID returns the user's folders ordered by path.
+func GetFoldersByUserID(userID int64) ([]Folder, error) {
+	folders, err := repo.GetFolders(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fillFolderPaths(folders)
+	sort.Slice(folders, func(i, j int) bool {
+		return strings.ToLower(folders[i].Path) < strings.ToLower(folders[j].Path)
+	})
+	return folders, nil
+}
+
+func GetFolderByID(id, userID int64) (*Folder, error) {
+	folders, err := GetFoldersByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range folders {
+		if folders[i].ID == id {
+			return &folders[i], nil
+		}
+	}
+	return nil, ErrFolderNotFound
+}
+
+func fillFolderPaths(folders []Folder) {
+	byID := make(map[int64]*Folder, len(folders))
+	for i := range folders {
+		byID[folders[i].ID] = &folders[i]
+	}
+
+	for i := range folders {
+		var parts []string
+		seen := make(map[int64]bool)
+		for f := &folders[i]; f != nil && !seen[f.ID]; {
+			seen[f.ID] = true
+			parts = append([]string{f.Name}, parts...)
+			if f.ParentID == nil {
+				break
+			}
+			f = byID[*f.ParentID]
+		}
+		folders[i].Path = strings.Join(parts, "/")
+	}
+}
+
+func validateFolderInput(input *FolderInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return errors.New("folder name is required")
+	}
+	if strings.Contains(input.Name, "/") {
+		return errors.New("folder name cannot contain '/'")
+	}
+	if input.ParentID != nil && *input.ParentID == 0 {
+		input.ParentID = nil
+	}
+	return nil
+}
+
+func CreateFolder(userID int64, input FolderInput) (*Folder, error) {
+	if err := validateFolderInput(&input); err != nil {
+		return nil, err
+	}
+	if input.ParentID != nil {
+		if _, err := GetFolderByID(*input.ParentID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := repo.CreateFolder(userID, input.ParentID, input.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetFolderByID(id, userID)
+}
+
+// UpdateFolder renames and/or moves a folder. A folder cannot be moved into
+// itself or one of its descendants.
+func UpdateFolder(id, userID int64, input FolderInput) (*Folder, error) {
+	if err := validateFolderInput(&input); err != nil {
+		return nil, err
+	}
+
+	folders, err := GetFoldersByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[int64]*int64, len(folders))
+	for _, f := range folders {
+		parents[f.ID] = f.ParentID
+	}
+	if _, ok := parents[id]; !ok {
+		return nil, ErrFolderNotFound
+	}
+
+	if input.ParentID != nil {
+		if _, ok := parents[*input.ParentID]; !ok {
+			return nil, ErrFolderNotFound
+		}
+		for p := input.ParentID; p != nil; p = parents[*p] {
+			if *p == id {
+				return nil, errors.New("a folder cannot be moved into itself")
+			}
+		}
+	}
+
+	if err := repo.UpdateFolder(id, userID, input.ParentID, input.Name); err != nil {
+		return nil, err
+	}
+
+	return GetFolderByID(id, userID)
+}
+
+// DeleteFolder removes a folder and its subfolders. Connections inside them
+// are moved to the root rather than deleted.
+func DeleteFolder(id, userID int64) error {
+	return repo.DeleteFolder(id, userID)
+}
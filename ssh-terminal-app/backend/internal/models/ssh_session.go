@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+const (
+	SessionStatusActive = "active"
+	SessionStatusClosed = "closed"
+	SessionStatusFailed = "failed"
+)
+
+type SSHSession struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	ConnectionID int64      `json:"connection_id"`
+	Status       string     `json:"status"`
+	ErrorMessage *string    `json:"error_message"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+}
+
+type SSHConnectionStats struct {
+	ConnectionID          int64      `json:"connection_id"`
+	OpenCount             int        `json:"open_count"`
+	FailedCount           int        `json:"failed_count"`
+	ActiveCount           int        `json:"active_count"`
+	TotalSessionSeconds   int64      `json:"total_session_seconds"`
+	LastConnectedAt       *time.Time `json:"last_connected_at"`
+	LastError             *string    `json:"last_error"`
+	LastErrorAt           *time.Time `json:"last_error_at"`
+	IsFavorite            bool       `json:"is_favorite"`
+	AverageSessionSeconds int64      `json:"average_session_seconds"`
+}
+
+// StartSSHSession records a terminal session attempt. It must be finished
+// with EndSSHSession.
+func StartSSHSession(userID, connectionID int64) (*SSHSession, error) {
+	now := dbNow()
+	id, err := repo.StartSession(userID, connectionID, NodeID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSHSession{
+		ID:           id,
+		UserID:       userID,
+		ConnectionID: connectionID,
+		Status:       SessionStatusActive,
+		StartedAt:    now,
+	}, nil
+}
+
+// EndSSHSession closes a session. A session that never reached a shell is
+// recorded as failed; errMsg is kept as the session's last error.
+func EndSSHSession(id int64, connected bool, errMsg string) error {
+	status := SessionStatusClosed
+	if !connected {
+		status = SessionStatusFailed
+	}
+
+	var message *string
+	if errMsg != "" {
+		message = &errMsg
+	}
+
+	return repo.EndSession(id, status, message, dbNow())
+}
+
+// CloseStaleSSHSessions marks sessions left active by a previous server
+// process on this node as closed.
+func CloseStaleSSHSessions() error {
+	return repo.CloseStaleSessions(NodeID, dbNow())
+}
+
+// GetSSHConnectionStats summarizes the connection's session history. Only
+// sessions that reached a shell count as opened; sessions still in progress
+// are reported as active.
+func GetSSHConnectionStats(connectionID, userID int64) (*SSHConnectionStats, error) {
+	conn, err := GetSSHConnectionByID(connectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := repo.GetConnectionStats(connectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.IsFavorite = conn.IsFavorite
+	if stats.OpenCount > 0 {
+		stats.AverageSessionSeconds = stats.TotalSessionSeconds / int64(stats.OpenCount)
+	}
+	return stats, nil
+}
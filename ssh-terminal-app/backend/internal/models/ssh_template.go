@@ -0,0 +1,303 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ssh-terminal-app/internal/crypto"
+	"time"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrTemplateInUse    = errors.New("template is used by one or more connections")
+	ErrInvalidInput     = errors.New("invalid input")
+)
+
+// InputError reports a validation failure; it matches ErrInvalidInput.
+type InputError struct {
+	Message string
+}
+
+func (e *InputError) Error() string {
+	return e.Message
+}
+
+func (e *InputError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+func invalidInput(format string, args ...any) error {
+	return &InputError{Message: fmt.Sprintf(format, args...)}
+}
+
+type SSHTemplate struct {
+	ID                  int64             `json:"id"`
+	UserID              int64             `json:"user_id"`
+	Name                string            `json:"name"`
+	Port                *int              `json:"port"`
+	Username            *string           `json:"username"`
+	AuthType            *string           `json:"auth_type"`
+	PasswordEncrypted   *string           `json:"-"`
+	PrivateKeyEncrypted *string           `json:"-"`
+	JumpConnectionID    *int64            `json:"jump_connection_id"`
+	TermType            *string           `json:"term_type"`
+	Variables           map[string]string `json:"variables"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+}
+
+type SSHTemplateInput struct {
+	Name             string            `json:"name" binding:"required"`
+	Port             int               `json:"port"`
+	Username         string            `json:"username"`
+	AuthType         string            `json:"auth_type"`
+	Password         string            `json:"password"`
+	PrivateKey       string            `json:"private_key"`
+	JumpConnectionID *int64            `json:"jump_connection_id"`
+	TermType         string            `json:"term_type"`
+	Variables        map[string]string `json:"variables"`
+}
+
+type SSHTemplateResponse struct {
+	ID               int64             `json:"id"`
+	UserID           int64             `json:"user_id"`
+	Name             string            `json:"name"`
+	Port             *int              `json:"port"`
+	Username         *string           `json:"username"`
+	AuthType         *string           `json:"auth_type"`
+	HasPassword      bool              `json:"has_password"`
+	HasPrivateKey    bool              `json:"has_private_key"`
+	JumpConnectionID *int64            `json:"jump_connection_id"`
+	TermType         *string           `json:"term_type"`
+	Variables        map[string]string `json:"variables"`
+	ConnectionCount  int               `json:"connection_count"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+}
+
+func (t *SSHTemplate) ToResponse(connectionCount int) SSHTemplateResponse {
+	variables := t.Variables
+	if variables == nil {
+		variables = map[string]string{}
+	}
+	return SSHTemplateResponse{
+		ID:               t.ID,
+		UserID:           t.UserID,
+		Name:             t.Name,
+		Port:             t.Port,
+		Username:         t.Username,
+		AuthType:         t.AuthType,
+		HasPassword:      t.PasswordEncrypted != nil,
+		HasPrivateKey:    t.PrivateKeyEncrypted != nil,
+		JumpConnectionID: t.JumpConnectionID,
+		TermType:         t.TermType,
+		Variables:        variables,
+		ConnectionCount:  connectionCount,
+		CreatedAt:        t.CreatedAt,
+		UpdatedAt:        t.UpdatedAt,
+	}
+}
+
+const sshTemplateColumns = `id, user_id, name, port, username, auth_type, password_encrypted, private_key_encrypted,
+	jump_connection_id, term_type, variables, created_at, updated_at`
+
+func scanSSHTemplate(row rowScanner, t *SSHTemplate) error {
+	var port sql.NullInt64
+	var jumpConnectionID sql.NullInt64
+	var variables sql.NullString
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &port, &t.Username, &t.AuthType, &t.PasswordEncrypted, &t.PrivateKeyEncrypted,
+		&jumpConnectionID, &t.TermType, &variables, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if port.Valid {
+		p := int(port.Int64)
+		t.Port = &p
+	}
+	if jumpConnectionID.Valid {
+		t.JumpConnectionID = &jumpConnectionID.Int64
+	}
+	t.Variables, err = decodeVariables(variables)
+	return err
+}
+
+func decodeVariables(value sql.NullString) (map[string]string, error) {
+	variables := map[string]string{}
+	if !value.Valid || value.String == "" {
+		return variables, nil
+	}
+	if err := json.Unmarshal([]byte(value.String), &variables); err != nil {
+		return nil, err
+	}
+	return variables, nil
+}
+
+func encodeVariables(variables map[string]string) (*string, error) {
+	if len(variables) == 0 {
+		return nil, nil
+	}
+	for name := range variables {
+		if !isVariableName(name) {
+			return nil, invalidInput("Invalid variable name %q", name)
+		}
+	}
+	data, err := json.Marshal(variables)
+	if err != nil {
+		return nil, err
+	}
+	encoded := string(data)
+	return &encoded, nil
+}
+
+func isVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func optionalInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
+
+func encryptOptional(s string) (*string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	encrypted, err := crypto.Encrypt(s)
+	if err != nil {
+		return nil, err
+	}
+	return &encrypted, nil
+}
+
+func validateTemplateInput(userID int64, input *SSHTemplateInput) error {
+	if input.AuthType != "" && input.AuthType != "password" && input.AuthType != "key" {
+		return invalidInput("Invalid auth_type. Must be 'password' or 'key'")
+	}
+	if input.Port < 0 || input.Port > 65535 {
+		return invalidInput("Invalid port")
+	}
+	if input.JumpConnectionID != nil && *input.JumpConnectionID == 0 {
+		input.JumpConnectionID = nil
+	}
+	if input.JumpConnectionID != nil {
+		if _, err := GetSSHConnectionByID(*input.JumpConnectionID, userID); err != nil {
+			return invalidInput("Jump connection not found")
+		}
+	}
+	return nil
+}
+
+// TemplateRecord is the stored form of a template built from input.
+type TemplateRecord struct {
+	Name                string
+	Port                *int
+	Username            *string
+	AuthType            *string
+	PasswordEncrypted   *string
+	PrivateKeyEncrypted *string
+	JumpConnectionID    *int64
+	TermType            *string
+	Variables           *string
+}
+
+func buildTemplateRecord(userID int64, input SSHTemplateInput) (*TemplateRecord, error) {
+	if err := validateTemplateInput(userID, &input); err != nil {
+		return nil, err
+	}
+
+	rec := &TemplateRecord{
+		Name:             input.Name,
+		Username:         optionalString(input.Username),
+		AuthType:         optionalString(input.AuthType),
+		JumpConnectionID: input.JumpConnectionID,
+		TermType:         optionalString(input.TermType),
+	}
+	if input.Port != 0 {
+		rec.Port = &input.Port
+	}
+
+	var err error
+	if rec.PasswordEncrypted, err = encryptOptional(input.Password); err != nil {
+		return nil, err
+	}
+	if rec.PrivateKeyEncrypted, err = encryptOptional(input.PrivateKey); err != nil {
+		return nil, err
+	}
+	if rec.Variables, err = encodeVariables(input.Variables); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func CreateSSHTemplate(userID int64, input SSHTemplateInput) (*SSHTemplate, error) {
+	rec, err := buildTemplateRecord(userID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := repo.CreateTemplate(userID, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetSSHTemplateByID(id, userID)
+}
+
+func GetSSHTemplateByID(id, userID int64) (*SSHTemplate, error) {
+	return repo.GetTemplate(id, userID)
+}
+
+func GetSSHTemplatesByUserID(userID int64) ([]SSHTemplate, error) {
+	return repo.GetTemplates(userID)
+}
+
+// UpdateSSHTemplate replaces the template's defaults. As with connections,
+// an empty password or private key keeps the stored secret. Every connection
+// derived from the template picks up the change on its next load.
+func UpdateSSHTemplate(id, userID int64, input SSHTemplateInput) (*SSHTemplate, error) {
+	if _, err := GetSSHTemplateByID(id, userID); err != nil {
+		return nil, err
+	}
+	rec, err := buildTemplateRecord(userID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := repo.UpdateTemplate(id, userID, rec); err != nil {
+		return nil, err
+	}
+
+	return GetSSHTemplateByID(id, userID)
+}
+
+func DeleteSSHTemplate(id, userID int64) error {
+	return repo.DeleteTemplate(id, userID)
+}
+
+func CountTemplateConnections(id, userID int64) (int, error) {
+	return repo.CountTemplateConnections(id, userID)
+}
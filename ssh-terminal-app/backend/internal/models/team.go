@@ -0,0 +1,34 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// TeamSourceLDAP marks memberships derived from LDAP group membership. They
+// are replaced on every LDAP login.
+const TeamSourceLDAP = "ldap"
+
+type Team struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func GetUserTeams(userID int64) ([]Team, error) {
+	return repo.GetUserTeams(userID)
+}
+
+// SyncUserTeams makes the user's memberships from source exactly the given
+// teams, creating teams that do not exist yet. Memberships from other sources
+// are left alone.
+func SyncUserTeams(userID int64, source string, names []string) error {
+	var trimmed []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			trimmed = append(trimmed, name)
+		}
+	}
+	return repo.SyncUserTeams(userID, source, trimmed, dbNow())
+}
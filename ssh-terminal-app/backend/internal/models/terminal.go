@@ -0,0 +1,128 @@
+package models
+
+import (
+	"maps"
+	"regexp"
+)
+
+const (
+	MaxTerminalSize         = 1000
+	maxEnvironmentVariables = 32
+	maxEnvironmentValue     = 4096
+	maxStartupCommand       = 4096
+	maxWorkingDirectory     = 1024
+)
+
+var (
+	termTypePattern = regexp.MustCompile(`^[A-Za-z0-9_.+-]{1,64}$`)
+	envNamePattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+)
+
+// TerminalModes maps the RFC 4254 terminal mode names to their opcodes.
+var TerminalModes = map[string]uint8{
+	"VINTR": 1, "VQUIT": 2, "VERASE": 3, "VKILL": 4, "VEOF": 5, "VEOL": 6, "VEOL2": 7,
+	"VSTART": 8, "VSTOP": 9, "VSUSP": 10, "VDSUSP": 11, "VREPRINT": 12, "VWERASE": 13,
+	"VLNEXT": 14, "VFLUSH": 15, "VSWTCH": 16, "VSTATUS": 17, "VDISCARD": 18,
+	"IGNPAR": 30, "PARMRK": 31, "INPCK": 32, "ISTRIP": 33, "INLCR": 34, "IGNCR": 35,
+	"ICRNL": 36, "IUCLC": 37, "IXON": 38, "IXANY": 39, "IXOFF": 40, "IMAXBEL": 41, "IUTF8": 42,
+	"ISIG": 50, "ICANON": 51, "XCASE": 52, "ECHO": 53, "ECHOE": 54, "ECHOK": 55, "ECHONL": 56,
+	"NOFLSH": 57, "TOSTOP": 58, "IEXTEN": 59, "ECHOCTL": 60, "ECHOKE": 61, "PENDIN": 62,
+	"OPOST": 70, "OLCUC": 71, "ONLCR": 72, "OCRNL": 73, "ONOCR": 74, "ONLRET": 75,
+	"CS7": 90, "CS8": 91, "PARENB": 92, "PARODD": 93,
+	"TTY_OP_ISPEED": 128, "TTY_OP_OSPEED": 129,
+}
+
+// TerminalOptions configure the PTY and the shell of a terminal. Zero values
+// leave the default in place.
+type TerminalOptions struct {
+	Term  string            `json:"term"`
+	Cols  int               `json:"cols"`
+	Rows  int               `json:"rows"`
+	Modes map[string]uint32 `json:"modes"`
+	Env   map[string]string `json:"env"`
+	// Command runs instead of the login shell, in Cwd when set.
+	Command string `json:"command"`
+	Cwd     string `json:"cwd"`
+}
+
+func (o TerminalOptions) Validate() error {
+	if o.Term != "" && !termTypePattern.MatchString(o.Term) {
+		return invalidInput("Invalid terminal type")
+	}
+	if o.Cols < 0 || o.Cols > MaxTerminalSize || o.Rows < 0 || o.Rows > MaxTerminalSize {
+		return invalidInput("Terminal size must be between 1 and %d", MaxTerminalSize)
+	}
+	if (o.Cols == 0) != (o.Rows == 0) {
+		return invalidInput("Terminal columns and rows must be set together")
+	}
+	for name := range o.Modes {
+		if _, ok := TerminalModes[name]; !ok {
+			return invalidInput("Unknown terminal mode %q", name)
+		}
+	}
+	if len(o.Env) > maxEnvironmentVariables {
+		return invalidInput("Too many environment variables")
+	}
+	for name, value := range o.Env {
+		if !envNamePattern.MatchString(name) {
+			return invalidInput("Invalid environment variable name %q", name)
+		}
+		if len(value) > maxEnvironmentValue {
+			return invalidInput("Environment variable %s is too long", name)
+		}
+	}
+	if len(o.Command) > maxStartupCommand {
+		return invalidInput("Startup command is too long")
+	}
+	if len(o.Cwd) > maxWorkingDirectory {
+		return invalidInput("Working directory is too long")
+	}
+	return nil
+}
+
+// Merge returns o with the options set in override taking precedence. Modes
+// and environment variables are merged by name.
+func (o TerminalOptions) Merge(override TerminalOptions) TerminalOptions {
+	if override.Term != "" {
+		o.Term = override.Term
+	}
+	if override.Cols > 0 {
+		o.Cols, o.Rows = override.Cols, override.Rows
+	}
+	if len(override.Modes) > 0 {
+		modes := maps.Clone(o.Modes)
+		if modes == nil {
+			modes = map[string]uint32{}
+		}
+		maps.Copy(modes, override.Modes)
+		o.Modes = modes
+	}
+	if len(override.Env) > 0 {
+		env := maps.Clone(o.Env)
+		if env == nil {
+			env = map[string]string{}
+		}
+		maps.Copy(env, override.Env)
+		o.Env = env
+	}
+	if override.Command != "" {
+		o.Command = override.Command
+	}
+	if override.Cwd != "" {
+		o.Cwd = override.Cwd
+	}
+	return o
+}
+
+// TerminalOptions returns the terminal settings stored on the connection.
+func (c *SSHConnection) TerminalOptions() TerminalOptions {
+	return TerminalOptions{
+		Term:    c.TermType,
+		Cols:    c.InitialCols,
+		Rows:    c.InitialRows,
+		Modes:   c.TerminalModes,
+		Env:     c.Environment,
+		Command: c.StartupCommand,
+		Cwd:     c.WorkingDirectory,
+	}
+}
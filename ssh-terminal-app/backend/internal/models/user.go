@@ -4,21 +4,23 @@ import (
 	"database/sql"
 	"errors"
 	"regexp"
-	"ssh-terminal-app/internal/database"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 type User struct {
-	ID           int64     `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Name         string    `json:"name"`
-	GoogleID     *string   `json:"-"`
-	AuthProvider string    `json:"auth_provider"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	PasswordHash    string     `json:"-"`
+	Name            string     `json:"name"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	DisabledAt      *time.Time `json:"disabled_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type RegisterInput struct {
@@ -27,8 +29,9 @@ type RegisterInput struct {
 	Name     string `json:"name" binding:"required"`
 }
 
+// LoginInput.Email also accepts a directory username when LDAP is enabled.
 type LoginInput struct {
-	Email    string `json:"email" binding:"required,email"`
+	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
@@ -61,15 +64,10 @@ func CreateUser(input RegisterInput) (*User, error) {
 		return nil, err
 	}
 
-	result, err := database.DB.Exec(
-		`INSERT INTO users (email, password_hash, name, auth_provider) VALUES (?, ?, ?, ?)`,
-		input.Email, string(hashedPassword), input.Name, "local",
-	)
-	if err != nil {
-		return nil, err
+	id, err := repo.CreateUser(input.Email, string(hashedPassword), input.Name)
+	if err == ErrEmailTaken {
+		return nil, errors.New("Bu email ile kayıtlı bir kullanıcı zaten mevcut")
 	}
-
-	id, err := result.LastInsertId()
 	if err != nil {
 		return nil, err
 	}
@@ -77,134 +75,80 @@ func CreateUser(input RegisterInput) (*User, error) {
 	return GetUserByID(id)
 }
 
-func CreateGoogleUser(email, name, googleID string) (*User, error) {
-	user, err := GetUserByGoogleID(googleID)
-	if err == nil && user != nil {
-		return user, nil
-	}
-
-	user, err = GetUserByEmail(email)
-	if err == nil && user != nil {
-		_, err = database.DB.Exec(
-			`UPDATE users SET google_id = ?, auth_provider = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
-			googleID, "google", user.ID,
-		)
-		if err != nil {
-			return nil, err
-		}
-		return GetUserByID(user.ID)
-	}
-
-	result, err := database.DB.Exec(
-		`INSERT INTO users (email, password_hash, name, google_id, auth_provider) VALUES (?, ?, ?, ?, ?)`,
-		email, "", name, googleID, "google",
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
+const userColumns = `id, email, password_hash, name, role, email_verified_at, disabled_at, created_at, updated_at`
 
-	return GetUserByID(id)
-}
-
-func GetUserByID(id int64) (*User, error) {
-	user := &User{}
+func scanUser(row rowScanner, user *User) error {
 	var passwordHash sql.NullString
 	var name sql.NullString
-	var googleID sql.NullString
+	var emailVerifiedAt, disabledAt sql.NullTime
 
-	err := database.DB.QueryRow(
-		`SELECT id, email, password_hash, name, google_id, auth_provider, created_at, updated_at 
-		FROM users WHERE id = ?`,
-		id,
-	).Scan(&user.ID, &user.Email, &passwordHash, &name, &googleID, &user.AuthProvider, &user.CreatedAt, &user.UpdatedAt)
-
-	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+	if err := row.Scan(&user.ID, &user.Email, &passwordHash, &name, &user.Role, &emailVerifiedAt, &disabledAt, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return err
 	}
-	if err != nil {
-		return nil, err
+	user.PasswordHash = passwordHash.String
+	user.Name = name.String
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
 	}
-
-	if passwordHash.Valid {
-		user.PasswordHash = passwordHash.String
-	}
-	if name.Valid {
-		user.Name = name.String
-	}
-	if googleID.Valid {
-		user.GoogleID = &googleID.String
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
 	}
+	return nil
+}
 
-	return user, nil
+func GetUserByID(id int64) (*User, error) {
+	return repo.GetUserByID(id)
 }
 
 func GetUserByEmail(email string) (*User, error) {
-	user := &User{}
-	var passwordHash sql.NullString
-	var name sql.NullString
-	var googleID sql.NullString
-
-	err := database.DB.QueryRow(
-		`SELECT id, email, password_hash, name, google_id, auth_provider, created_at, updated_at 
-		FROM users WHERE email = ?`,
-		email,
-	).Scan(&user.ID, &user.Email, &passwordHash, &name, &googleID, &user.AuthProvider, &user.CreatedAt, &user.UpdatedAt)
-
-	if err == sql.ErrNoRows {
+	user, err := repo.GetUserByEmail(email)
+	if err == ErrUserNotFound {
 		return nil, errors.New("Bu email ile kayıtlı bir kullanıcı bulunamadı")
 	}
-	if err != nil {
-		return nil, err
-	}
+	return user, err
+}
 
-	if passwordHash.Valid {
-		user.PasswordHash = passwordHash.String
-	}
-	if name.Valid {
-		user.Name = name.String
-	}
-	if googleID.Valid {
-		user.GoogleID = &googleID.String
-	}
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
 
-	return user, nil
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
-func GetUserByGoogleID(googleID string) (*User, error) {
-	user := &User{}
-	var passwordHash sql.NullString
-	var name sql.NullString
-	var gID sql.NullString
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
 
-	err := database.DB.QueryRow(
-		`SELECT id, email, password_hash, name, google_id, auth_provider, created_at, updated_at 
-		FROM users WHERE google_id = ?`,
-		googleID,
-	).Scan(&user.ID, &user.Email, &passwordHash, &name, &gID, &user.AuthProvider, &user.CreatedAt, &user.UpdatedAt)
+// ValidatePassword checks a new password against the strength rules.
+func ValidatePassword(password string) error {
+	if err := validateStrongPassword(password); err != nil {
+		return &InputError{Message: err.Error()}
+	}
+	return nil
+}
 
-	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+// SetUserPassword replaces the user's password after checking its strength.
+func SetUserPassword(userID int64, password string) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
 	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if passwordHash.Valid {
-		user.PasswordHash = passwordHash.String
-	}
-	if name.Valid {
-		user.Name = name.String
-	}
-	if gID.Valid {
-		user.GoogleID = &gID.String
-	}
+	return repo.SetUserPasswordHash(userID, string(hashedPassword))
+}
 
-	return user, nil
+// MarkEmailVerified records that the user proved ownership of email. It has
+// no effect if the account's address changed in the meantime.
+func MarkEmailVerified(userID int64, email string) error {
+	if err := repo.MarkEmailVerified(userID, email, dbNow()); err != nil {
+		return err
+	}
+	return repo.PromoteAdmins(userID, adminEmails)
 }
 
 func (u *User) CheckPassword(password string) bool {
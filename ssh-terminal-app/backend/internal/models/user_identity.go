@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrUnverifiedIdentityEmail = errors.New("an account with this email already exists")
+
+// UserIdentity links a user to an account at an external identity provider.
+// The (provider, subject) pair identifies the account; the email is only
+// informational since providers may let users change it.
+type UserIdentity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// ExternalIdentity is what an identity provider asserted about a login.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+func GetUserIdentities(userID int64) ([]UserIdentity, error) {
+	return repo.GetUserIdentities(userID)
+}
+
+// FindOrCreateUserForIdentity returns the user linked to an external identity.
+// An unknown identity is linked to the user with the same email only when the
+// provider has verified that email; otherwise a new user is created.
+func FindOrCreateUserForIdentity(identity ExternalIdentity) (*User, error) {
+	if identity.Provider == "" || identity.Subject == "" {
+		return nil, invalidInput("Identity provider and subject are required")
+	}
+	identity.Email = strings.TrimSpace(identity.Email)
+	if identity.Email == "" {
+		return nil, invalidInput("Identity provider did not return an email address")
+	}
+
+	userID, err := repo.FindOrCreateIdentityUser(identity, adminEmails, dbNow())
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(userID)
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"ssh-terminal-app/internal/crypto"
+	"time"
+)
+
+const (
+	UserTokenVerifyEmail   = "verify_email"
+	UserTokenResetPassword = "reset_password"
+
+	EmailVerificationTTL = 48 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+var ErrInvalidUserToken = errors.New("invalid or expired token")
+
+// UserToken is a redeemed email verification or password reset token.
+type UserToken struct {
+	UserID int64
+	Email  string
+}
+
+// CreateUserToken issues a token for purpose and invalidates the user's
+// earlier unused tokens for the same purpose. Only a hash of it is stored.
+func CreateUserToken(userID int64, purpose, email string, ttl time.Duration) (string, error) {
+	token, err := crypto.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := dbNow()
+	if err := repo.CreateUserToken(userID, purpose, crypto.HashToken(token), email, now, now.Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken redeems a token. Each token works once, and only while the
+// account still has the email address it was sent to.
+func ConsumeUserToken(token, purpose string) (*UserToken, error) {
+	if token == "" {
+		return nil, ErrInvalidUserToken
+	}
+
+	return repo.ConsumeUserToken(crypto.HashToken(token), purpose, dbNow())
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"ssh-terminal-app/internal/crypto"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	WebAuthnPurposeRegister = "register"
+	WebAuthnPurposeLogin    = "login"
+	WebAuthnPurposeMFA      = "mfa"
+)
+
+var (
+	ErrWebAuthnCredentialNotFound = errors.New("authenticator not found")
+	ErrWebAuthnCeremonyNotFound   = errors.New("webauthn ceremony not found or expired")
+)
+
+// WebAuthnCredential is the listing view of a registered authenticator. The
+// key material itself stays in the credential column.
+type WebAuthnCredential struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	Name         string     `json:"name"`
+	Transports   []string   `json:"transports"`
+	CloneWarning bool       `json:"clone_warning"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// WebAuthnCeremony is the stored server side of a begun registration or
+// login. UserID is nil for discoverable logins.
+type WebAuthnCeremony struct {
+	ID          string
+	UserID      *int64
+	Purpose     string
+	SessionData string
+	ExpiresAt   time.Time
+}
+
+// WebAuthnUser adapts a User to the webauthn.User interface.
+type WebAuthnUser struct {
+	User        *User
+	Handle      []byte
+	Credentials []webauthn.Credential
+}
+
+func (u *WebAuthnUser) WebAuthnID() []byte                         { return u.Handle }
+func (u *WebAuthnUser) WebAuthnName() string                       { return u.User.Email }
+func (u *WebAuthnUser) WebAuthnCredentials() []webauthn.Credential { return u.Credentials }
+
+func (u *WebAuthnUser) WebAuthnDisplayName() string {
+	if u.User.Name != "" {
+		return u.User.Name
+	}
+	return u.User.Email
+}
+
+// LoadWebAuthnUser returns the user together with their user handle and
+// registered credentials. A random handle is assigned on first use, since the
+// spec forbids deriving it from personal data like the email address.
+func LoadWebAuthnUser(user *User) (*WebAuthnUser, error) {
+	handle, err := repo.GetWebAuthnUserHandle(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if handle == "" {
+		token, err := crypto.GenerateRandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		handle, err = repo.SetWebAuthnUserHandle(user.ID, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	credentials, err := repo.GetWebAuthnCredentialData(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnUser{User: user, Handle: []byte(handle), Credentials: credentials}, nil
+}
+
+// GetWebAuthnUserByHandle resolves the user handle returned by a passkey.
+func GetWebAuthnUserByHandle(handle []byte) (*WebAuthnUser, error) {
+	userID, err := repo.GetUserIDByWebAuthnHandle(string(handle))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return LoadWebAuthnUser(user)
+}
+
+func HasWebAuthnCredentials(userID int64) (bool, error) {
+	count, err := repo.CountWebAuthnCredentials(userID)
+	return count > 0, err
+}
+
+func GetWebAuthnCredentials(userID int64) ([]WebAuthnCredential, error) {
+	return repo.GetWebAuthnCredentials(userID)
+}
+
+func webAuthnCredentialKey(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func normalizeCredentialName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) > 64 {
+		return "", invalidInput("Authenticator name must be at most 64 characters")
+	}
+	return name, nil
+}
+
+func CreateWebAuthnCredential(userID int64, name string, credential *webauthn.Credential) (*WebAuthnCredential, error) {
+	name, err := normalizeCredentialName(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = "Passkey"
+	}
+
+	id, err := repo.CreateWebAuthnCredential(userID, name, credential, dbNow())
+	if err != nil {
+		return nil, err
+	}
+	return GetWebAuthnCredentialByID(id, userID)
+}
+
+func GetWebAuthnCredentialByID(id, userID int64) (*WebAuthnCredential, error) {
+	credentials, err := GetWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range credentials {
+		if credentials[i].ID == id {
+			return &credentials[i], nil
+		}
+	}
+	return nil, ErrWebAuthnCredentialNotFound
+}
+
+// UpdateWebAuthnCredentialUsage stores the authenticator state after a
+// successful assertion, mainly the signature counter used for clone detection.
+func UpdateWebAuthnCredentialUsage(userID int64, credential *webauthn.Credential) error {
+	return repo.UpdateWebAuthnCredential(userID, credential, dbNow())
+}
+
+func RenameWebAuthnCredential(id, userID int64, name string) (*WebAuthnCredential, error) {
+	name, err := normalizeCredentialName(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, invalidInput("Authenticator name is required")
+	}
+
+	if err := repo.RenameWebAuthnCredential(id, userID, name); err != nil {
+		return nil, err
+	}
+	return GetWebAuthnCredentialByID(id, userID)
+}
+
+func DeleteWebAuthnCredential(id, userID int64) error {
+	return repo.DeleteWebAuthnCredential(id, userID)
+}
+
+// SaveWebAuthnCeremony stores the server side of a begun ceremony and returns
+// the id the client must send back with its response. userID is nil for
+// discoverable (passkey) logins, where the user is not known yet.
+func SaveWebAuthnCeremony(userID *int64, purpose string, session *webauthn.SessionData) (string, error) {
+	id, err := crypto.GenerateRandomToken(24)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := session.Expires
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(5 * time.Minute)
+	}
+
+	err = repo.SaveWebAuthnCeremony(&WebAuthnCeremony{
+		ID:          id,
+		UserID:      userID,
+		Purpose:     purpose,
+		SessionData: string(data),
+		ExpiresAt:   expiresAt.UTC().Truncate(time.Second),
+	}, dbNow())
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// TakeWebAuthnCeremony loads and deletes a ceremony, so each challenge can be
+// answered only once. userID must match the one the ceremony was begun for.
+func TakeWebAuthnCeremony(id string, userID *int64, purpose string) (*webauthn.SessionData, error) {
+	ceremony, err := repo.TakeWebAuthnCeremony(id, purpose, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if (userID == nil) != (ceremony.UserID == nil) || (userID != nil && *userID != *ceremony.UserID) {
+		return nil, ErrWebAuthnCeremonyNotFound
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(ceremony.SessionData), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,252 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"ssh-terminal-app/internal/database"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTooManyDials = errors.New("too many SSH connections are being opened, try again shortly")
+
+// Limit is a token bucket holding up to Burst tokens that refills at Burst
+// tokens per Interval. A nil Limit never limits.
+type Limit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+func (l *Limit) rate() float64 {
+	return float64(l.Burst) / l.Interval.Seconds()
+}
+
+// ParseLimit reads limits written as "<count>/<duration>", e.g. "10/1m".
+// "off" disables the limit.
+func ParseLimit(value string) (*Limit, error) {
+	if value == "off" {
+		return nil, nil
+	}
+	count, interval, ok := strings.Cut(value, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid limit %q, expected <count>/<duration>", value)
+	}
+	burst, err := strconv.Atoi(count)
+	if err != nil || burst <= 0 {
+		return nil, fmt.Errorf("invalid limit count in %q", value)
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid limit duration in %q", value)
+	}
+	return &Limit{Burst: burst, Interval: d}, nil
+}
+
+// Lockout locks an account after Threshold consecutive failures. The first
+// lock lasts Base and every further failure doubles it, up to Max.
+type Lockout struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	// Window is how long failures are remembered without new attempts.
+	Window time.Duration
+}
+
+// Limits configured for the server.
+var (
+	LoginIP      = &Limit{Burst: 20, Interval: time.Minute}
+	LoginAccount = &Limit{Burst: 10, Interval: time.Minute}
+	RegisterIP   = &Limit{Burst: 10, Interval: time.Hour}
+	AuthIP       = &Limit{Burst: 30, Interval: time.Minute}
+	ConnectUser  = &Limit{Burst: 30, Interval: time.Minute}
+	ConnectIP    = &Limit{Burst: 60, Interval: time.Minute}
+
+	LoginLockout = Lockout{Threshold: 5, Base: time.Minute, Max: time.Hour, Window: 24 * time.Hour}
+
+	MaxConcurrentDials = 3
+)
+
+var store Store = NewMemoryStore()
+
+// Init reads the RATE_LIMIT_* settings and selects the state store with
+// RATE_LIMIT_STORE ("memory", the default, or "database"). "sqlite" is the
+// older name of "database" and works with either database driver.
+func Init() error {
+	limits := []struct {
+		env   string
+		limit **Limit
+	}{
+		{"RATE_LIMIT_LOGIN_IP", &LoginIP},
+		{"RATE_LIMIT_LOGIN_ACCOUNT", &LoginAccount},
+		{"RATE_LIMIT_REGISTER_IP", &RegisterIP},
+		{"RATE_LIMIT_AUTH_IP", &AuthIP},
+		{"RATE_LIMIT_CONNECT_USER", &ConnectUser},
+		{"RATE_LIMIT_CONNECT_IP", &ConnectIP},
+	}
+	for _, l := range limits {
+		if v := os.Getenv(l.env); v != "" {
+			limit, err := ParseLimit(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", l.env, err)
+			}
+			*l.limit = limit
+		}
+	}
+
+	if v := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("LOGIN_LOCKOUT_THRESHOLD: invalid value %q", v)
+		}
+		LoginLockout.Threshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_DURATION")); err == nil && d > 0 {
+		LoginLockout.Base = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_MAX")); err == nil && d > 0 {
+		LoginLockout.Max = d
+	}
+
+	if v := os.Getenv("SSH_MAX_CONCURRENT_DIALS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("SSH_MAX_CONCURRENT_DIALS: invalid value %q", v)
+		}
+		MaxConcurrentDials = n
+	}
+
+	switch v := os.Getenv("RATE_LIMIT_STORE"); v {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "database", "sqlite":
+		store = NewDatabaseStore(database.DB)
+	default:
+		return fmt.Errorf("unknown RATE_LIMIT_STORE %q", v)
+	}
+	return nil
+}
+
+// Allow takes a token from the bucket for key. When the bucket is empty it
+// returns false and how long until a token is available.
+func Allow(key string, limit *Limit) (bool, time.Duration) {
+	if limit == nil {
+		return true, 0
+	}
+
+	var allowed bool
+	var retryAfter time.Duration
+	_, err := store.Update("bucket:"+key, limit.Interval, func(e *Entry, found bool) {
+		now := time.Now()
+		if !found {
+			e.Tokens = float64(limit.Burst)
+		} else {
+			elapsed := now.Sub(e.UpdatedAt).Seconds()
+			e.Tokens = math.Min(float64(limit.Burst), e.Tokens+elapsed*limit.rate())
+		}
+
+		if e.Tokens >= 1 {
+			e.Tokens--
+			allowed = true
+			return
+		}
+		retryAfter = time.Duration((1 - e.Tokens) / limit.rate() * float64(time.Second))
+	})
+	if err != nil {
+		// Limiter storage problems should not take logins down with them.
+		log.Printf("Rate limit store error: %v", err)
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+// LockedFor reports how much longer key is locked out, or zero.
+func LockedFor(key string, lockout Lockout) time.Duration {
+	if lockout.Threshold == 0 {
+		return 0
+	}
+
+	var remaining time.Duration
+	_, err := store.Update("lockout:"+key, lockout.Window, func(e *Entry, found bool) {
+		if found {
+			remaining = time.Until(e.Until)
+		}
+	})
+	if err != nil {
+		log.Printf("Rate limit store error: %v", err)
+		return 0
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// RecordFailure counts a failed attempt for key and returns the lock it
+// caused, if any.
+func RecordFailure(key string, lockout Lockout) time.Duration {
+	if lockout.Threshold == 0 {
+		return 0
+	}
+
+	var lockedFor time.Duration
+	_, err := store.Update("lockout:"+key, lockout.Window, func(e *Entry, found bool) {
+		e.Count++
+		if e.Count < lockout.Threshold {
+			return
+		}
+		lockedFor = lockout.Base << (e.Count - lockout.Threshold)
+		if lockedFor > lockout.Max || lockedFor <= 0 {
+			lockedFor = lockout.Max
+		}
+		e.Until = time.Now().Add(lockedFor)
+	})
+	if err != nil {
+		log.Printf("Rate limit store error: %v", err)
+		return 0
+	}
+	return lockedFor
+}
+
+// RecordSuccess clears the failure count for key.
+func RecordSuccess(key string) {
+	if err := store.Delete("lockout:" + key); err != nil {
+		log.Printf("Rate limit store error: %v", err)
+	}
+}
+
+var (
+	dialMu sync.Mutex
+	dials  = map[int64]int{}
+)
+
+// AcquireDial reserves one of the user's concurrent SSH dial slots. The
+// returned function releases it.
+func AcquireDial(userID int64) (func(), error) {
+	if MaxConcurrentDials == 0 {
+		return func() {}, nil
+	}
+
+	dialMu.Lock()
+	defer dialMu.Unlock()
+
+	if dials[userID] >= MaxConcurrentDials {
+		return nil, ErrTooManyDials
+	}
+	dials[userID]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			dialMu.Lock()
+			defer dialMu.Unlock()
+			if dials[userID]--; dials[userID] <= 0 {
+				delete(dials, userID)
+			}
+		})
+	}, nil
+}
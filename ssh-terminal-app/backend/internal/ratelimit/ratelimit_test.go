@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// useMemoryStore gives the test a store of its own.
+func useMemoryStore(t *testing.T) {
+	saved := store
+	store = NewMemoryStore()
+	t.Cleanup(func() { store = saved })
+}
+
+func TestAllowBurst(t *testing.T) {
+	useMemoryStore(t)
+	limit := &Limit{Burst: 3, Interval: time.Hour}
+
+	for i := 0; i < limit.Burst; i++ {
+		if ok, _ := Allow("key", limit); !ok {
+			t.Fatalf("request %d was refused within the burst", i+1)
+		}
+	}
+	ok, retryAfter := Allow("key", limit)
+	if ok {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	// One token refills in Interval/Burst.
+	if want := 20 * time.Minute; retryAfter <= 0 || retryAfter > want {
+		t.Errorf("retryAfter = %v, want up to %v", retryAfter, want)
+	}
+
+	if ok, _ := Allow("other", limit); !ok {
+		t.Error("another key shares the bucket")
+	}
+	if ok, _ := Allow("key", nil); !ok {
+		t.Error("a nil limit refused a request")
+	}
+}
+
+func TestAllowRefill(t *testing.T) {
+	useMemoryStore(t)
+	// A token every 20ms.
+	limit := &Limit{Burst: 2, Interval: 40 * time.Millisecond}
+
+	Allow("key", limit)
+	Allow("key", limit)
+	ok, retryAfter := Allow("key", limit)
+	if ok {
+		t.Fatal("request beyond the burst was allowed")
+	}
+
+	time.Sleep(retryAfter + 5*time.Millisecond)
+	if ok, _ := Allow("key", limit); !ok {
+		t.Fatal("no token after waiting retryAfter")
+	}
+
+	// A long wait refills the bucket only up to the burst.
+	time.Sleep(10 * limit.Interval)
+	for i := 0; i < limit.Burst; i++ {
+		if ok, _ := Allow("key", limit); !ok {
+			t.Fatalf("request %d was refused after a full refill", i+1)
+		}
+	}
+	if ok, _ := Allow("key", limit); ok {
+		t.Error("the bucket refilled beyond the burst")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  *Limit
+		err   bool
+	}{
+		{"10/1m", &Limit{Burst: 10, Interval: time.Minute}, false},
+		{"5/30s", &Limit{Burst: 5, Interval: 30 * time.Second}, false},
+		{"off", nil, false},
+		{"10", nil, true},
+		{"0/1m", nil, true},
+		{"10/0s", nil, true},
+		{"x/1m", nil, true},
+		{"10/soon", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseLimit(%q) error = %v, want error %v", tt.value, err, tt.err)
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Entry is the state kept per key: a token bucket for rate limits, or a
+// failure counter and lock expiry for lockouts.
+type Entry struct {
+	Tokens    float64
+	Count     int
+	Until     time.Time
+	UpdatedAt time.Time
+}
+
+// Store keeps limiter state. Update runs fn on the entry for key atomically
+// and keeps the result until ttl has passed without another update.
+type Store interface {
+	Update(key string, ttl time.Duration, fn func(e *Entry, found bool)) (Entry, error)
+	Delete(key string) error
+}
+
+const sweepInterval = time.Minute
+
+// MemoryStore keeps state in process memory; it is lost on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	Entry
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}}
+}
+
+func (s *MemoryStore) Update(key string, ttl time.Duration, fn func(e *Entry, found bool)) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, e := range s.entries {
+			if now.After(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	e, found := s.entries[key]
+	if found && now.After(e.expiresAt) {
+		found = false
+	}
+	if !found {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+
+	fn(&e.Entry, found)
+	e.UpdatedAt = now
+	e.expiresAt = now.Add(ttl)
+	return e.Entry, nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// DatabaseStore keeps state in the rate_limits table of the application
+// database, SQLite or PostgreSQL, so limits and lockouts survive restarts.
+type DatabaseStore struct {
+	db        *sql.DB
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewDatabaseStore(db *sql.DB) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+func (s *DatabaseStore) Update(key string, ttl time.Duration, fn func(e *Entry, found bool)) (Entry, error) {
+	// Updates are read-modify-write; serializing them here avoids SQLite
+	// lock upgrade failures between concurrent transactions.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		if _, err := s.db.Exec(`DELETE FROM rate_limits WHERE expires_at < ?`, now); err != nil {
+			return Entry{}, err
+		}
+		s.lastSweep = now
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Entry{}, err
+	}
+	defer tx.Rollback()
+
+	var e Entry
+	var until sql.NullTime
+	var expiresAt time.Time
+	err = tx.QueryRow(
+		`SELECT tokens, count, until, updated_at, expires_at FROM rate_limits WHERE key = ?`, key,
+	).Scan(&e.Tokens, &e.Count, &until, &e.UpdatedAt, &expiresAt)
+	found := err == nil && now.Before(expiresAt)
+	if err != nil && err != sql.ErrNoRows {
+		return Entry{}, err
+	}
+	if !found {
+		e = Entry{}
+	} else if until.Valid {
+		e.Until = until.Time
+	}
+
+	fn(&e, found)
+	e.UpdatedAt = now
+
+	var untilValue any
+	if !e.Until.IsZero() {
+		untilValue = e.Until.UTC()
+	}
+	_, err = tx.Exec(
+		`INSERT INTO rate_limits (key, tokens, count, until, updated_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET tokens = excluded.tokens, count = excluded.count, until = excluded.until,
+			updated_at = excluded.updated_at, expires_at = excluded.expires_at`,
+		key, e.Tokens, e.Count, untilValue, now, now.Add(ttl),
+	)
+	if err != nil {
+		return Entry{}, err
+	}
+	return e, tx.Commit()
+}
+
+func (s *DatabaseStore) Delete(key string) error {
+	_, err := s.db.Exec(`DELETE FROM rate_limits WHERE key = ?`, key)
+	return err
+}
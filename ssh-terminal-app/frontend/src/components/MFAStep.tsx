@@ -0,0 +1,193 @@
+import React, { useEffect, useState } from 'react';
+import { useNavigate } from 'react-router-dom';
+import { useAuth } from '../context/AuthContext';
+import type { MFAChallenge } from '../context/AuthContext';
+import { authAPI } from '../lib/api';
+import { ShieldCheck, KeyRound, Fingerprint } from 'lucide-react';
+import { isWebAuthnSupported } from '../lib/webauthn';
+
+interface MFAStepProps {
+  challenge: MFAChallenge;
+  onCancel: () => void;
+}
+
+const MFAStep: React.FC<MFAStepProps> = ({ challenge, onCancel }) => {
+  const { verifyMFA, verifyMFAWithPasskey, confirmMFAEnrollment } = useAuth();
+  const navigate = useNavigate();
+  const [code, setCode] = useState('');
+  const [useRecoveryCode, setUseRecoveryCode] = useState(false);
+  const [enrollment, setEnrollment] = useState<{ secret: string; otpauth_uri: string } | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
+  const [finish, setFinish] = useState<(() => void) | null>(null);
+  const [error, setError] = useState<string | null>(null);
+  const [isLoading, setIsLoading] = useState(false);
+
+  const isEnrollment = !!challenge.mfa_enrollment_required;
+  const methods = challenge.methods ?? [];
+  const canUsePasskey = methods.includes('webauthn') && isWebAuthnSupported();
+  const canUseCode = methods.includes('totp');
+
+  useEffect(() => {
+    if (!isEnrollment) return;
+    authAPI
+      .beginMFAEnrollment(challenge.mfa_token)
+      .then((response) => setEnrollment(response.data))
+      .catch((err) => setError(err.response?.data?.error || 'Kurulum başlatılamadı'));
+  }, [challenge.mfa_token, isEnrollment]);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+    setIsLoading(true);
+
+    try {
+      if (isEnrollment) {
+        const result = await confirmMFAEnrollment(challenge.mfa_token, code);
+        setRecoveryCodes(result.recoveryCodes);
+        setFinish(() => result.finish);
+      } else {
+        await verifyMFA(challenge.mfa_token, code, useRecoveryCode);
+        navigate('/');
+      }
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Doğrulama başarısız');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handlePasskey = async () => {
+    setError(null);
+    setIsLoading(true);
+    try {
+      await verifyMFAWithPasskey(challenge.mfa_token);
+      navigate('/');
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Güvenlik anahtarı doğrulaması başarısız');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  if (recoveryCodes && finish) {
+    return (
+      <div className="space-y-5">
+        <p className="text-gray-400 text-sm">
+          İki adımlı doğrulama etkinleştirildi. Aşağıdaki kurtarma kodlarını güvenli bir yere kaydedin;
+          her kod yalnızca bir kez kullanılabilir.
+        </p>
+        <div className="grid grid-cols-2 gap-2 p-4 bg-dark-900 border border-dark-600 rounded-lg font-mono text-sm">
+          {recoveryCodes.map((c) => (
+            <span key={c}>{c}</span>
+          ))}
+        </div>
+        <button
+          onClick={() => {
+            finish();
+            navigate('/');
+          }}
+          className="w-full py-3 bg-accent-cyan text-dark-900 font-semibold rounded-lg hover:bg-opacity-90 transition-colors"
+        >
+          Kodları kaydettim, devam et
+        </button>
+      </div>
+    );
+  }
+
+  return (
+    <div>
+      {error && (
+        <div className="mb-6 p-4 bg-red-500/10 border border-red-500/30 rounded-lg text-red-400 text-sm">
+          {error}
+        </div>
+      )}
+
+      {isEnrollment ? (
+        <div className="mb-5 space-y-3 text-sm text-gray-400">
+          <p>
+            Bu hesap için iki adımlı doğrulama zorunludur. Doğrulayıcı uygulamanıza aşağıdaki anahtarı
+            ekleyin ve üretilen kodu girin.
+          </p>
+          {enrollment && (
+            <>
+              <div className="p-3 bg-dark-900 border border-dark-600 rounded-lg font-mono break-all text-gray-200">
+                {enrollment.secret}
+              </div>
+              <a href={enrollment.otpauth_uri} className="text-accent-cyan hover:underline">
+                Doğrulayıcı uygulamada aç
+              </a>
+            </>
+          )}
+        </div>
+      ) : canUseCode && (
+        <p className="mb-5 text-sm text-gray-400">
+          {useRecoveryCode
+            ? 'Kurtarma kodlarınızdan birini girin.'
+            : 'Doğrulayıcı uygulamanızdaki 6 haneli kodu girin.'}
+        </p>
+      )}
+
+      {canUsePasskey && (
+        <button
+          type="button"
+          onClick={handlePasskey}
+          disabled={isLoading}
+          className="w-full mb-5 flex items-center justify-center gap-3 py-3 border border-dark-600 rounded-lg hover:bg-dark-700 transition-colors disabled:opacity-50"
+        >
+          <Fingerprint className="w-5 h-5 text-gray-400" />
+          <span>Passkey / güvenlik anahtarı kullan</span>
+        </button>
+      )}
+
+      {(isEnrollment || canUseCode) && (
+        <form onSubmit={handleSubmit} className="space-y-5">
+          <div className="relative">
+            {useRecoveryCode ? (
+              <KeyRound className="absolute left-4 top-1/2 -translate-y-1/2 w-5 h-5 text-gray-500" />
+            ) : (
+              <ShieldCheck className="absolute left-4 top-1/2 -translate-y-1/2 w-5 h-5 text-gray-500" />
+            )}
+            <input
+              type="text"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              placeholder={useRecoveryCode ? 'xxxxx-xxxxx' : '123456'}
+              autoComplete="one-time-code"
+              inputMode={useRecoveryCode ? 'text' : 'numeric'}
+              className="w-full pl-12 pr-4 py-3 bg-dark-900 border border-dark-600 rounded-lg focus:border-accent-cyan focus:ring-1 focus:ring-accent-cyan transition-colors"
+              autoFocus
+              required
+            />
+          </div>
+
+          <button
+            type="submit"
+            disabled={isLoading}
+            className="w-full py-3 bg-accent-cyan text-dark-900 font-semibold rounded-lg hover:bg-opacity-90 transition-colors disabled:opacity-50 disabled:cursor-not-allowed"
+          >
+            {isLoading ? 'Doğrulanıyor...' : 'Doğrula'}
+          </button>
+        </form>
+      )}
+
+      <div className="mt-6 flex justify-between text-sm">
+        <button onClick={onCancel} className="text-gray-500 hover:text-gray-300">
+          Geri dön
+        </button>
+        {canUseCode && (
+          <button
+            onClick={() => {
+              setUseRecoveryCode((v) => !v);
+              setCode('');
+            }}
+            className="text-accent-cyan hover:underline"
+          >
+            {useRecoveryCode ? 'Doğrulama kodu kullan' : 'Kurtarma kodu kullan'}
+          </button>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default MFAStep;
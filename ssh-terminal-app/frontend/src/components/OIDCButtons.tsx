@@ -0,0 +1,47 @@
+import React, { useEffect, useState } from 'react';
+import { authAPI } from '../lib/api';
+import { Chrome, LogIn } from 'lucide-react';
+
+interface OIDCProvider {
+  name: string;
+  display_name: string;
+  login_url: string;
+}
+
+interface OIDCButtonsProps {
+  actionLabel: string;
+}
+
+// Renders one button per identity provider configured on the backend.
+const OIDCButtons: React.FC<OIDCButtonsProps> = ({ actionLabel }) => {
+  const [providers, setProviders] = useState<OIDCProvider[]>([]);
+
+  useEffect(() => {
+    authAPI
+      .getOIDCProviders()
+      .then((response) => setProviders(response.data.providers ?? []))
+      .catch(() => setProviders([]));
+  }, []);
+
+  return (
+    <div className="space-y-3">
+      {providers.map((provider) => {
+        const Icon = provider.name === 'google' ? Chrome : LogIn;
+        return (
+          <button
+            key={provider.name}
+            onClick={() => authAPI.oidcLogin(provider.login_url)}
+            className="w-full flex items-center justify-center gap-3 py-3 border border-dark-600 rounded-lg hover:bg-dark-700 transition-colors"
+          >
+            <Icon className="w-5 h-5 text-gray-400" />
+            <span>
+              {provider.display_name} {actionLabel}
+            </span>
+          </button>
+        );
+      })}
+    </div>
+  );
+};
+
+export default OIDCButtons;
@@ -19,9 +19,9 @@ const Terminal: React.FC<TerminalProps> = ({ connection, onClose }) => {
   const [isFullscreen, setIsFullscreen] = React.useState(false);
   const [statusMessage, setStatusMessage] = React.useState<string>('Bağlanıyor...');
 
-  const handleOutput = useCallback((data: string) => {
+  const handleOutput = useCallback((data: string | Uint8Array, ack?: () => void) => {
     if (xtermRef.current) {
-      xtermRef.current.write(data);
+      xtermRef.current.write(data, ack);
     }
   }, []);
 
@@ -39,6 +39,15 @@ const Terminal: React.FC<TerminalProps> = ({ connection, onClose }) => {
     }
   }, []);
 
+  const droppedRef = useRef(0);
+  const handleFlow = useCallback((paused: boolean, dropped: number) => {
+    setStatusMessage(paused ? 'Çıktı bekletiliyor' : 'Bağlandı');
+    if (dropped > droppedRef.current && xtermRef.current) {
+      xtermRef.current.writeln(`\r\n\x1b[33m[${dropped - droppedRef.current} bayt çıktı atlandı]\x1b[0m\r\n`);
+    }
+    droppedRef.current = dropped;
+  }, []);
+
   const handleConnect = useCallback(() => {
     setStatusMessage('Bağlandı');
   }, []);
@@ -62,6 +71,7 @@ const Terminal: React.FC<TerminalProps> = ({ connection, onClose }) => {
     onOutput: handleOutput,
     onStatus: handleStatus,
     onError: handleError,
+    onFlow: handleFlow,
     onConnect: handleConnect,
     onDisconnect: handleDisconnect,
   });
@@ -130,7 +140,7 @@ const Terminal: React.FC<TerminalProps> = ({ connection, onClose }) => {
     window.addEventListener('resize', handleResize);
 
     // Connect to SSH
-    connect();
+    connect({ cols: xterm.cols, rows: xterm.rows });
 
     // Initial message
     xterm.writeln('\x1b[36m╔══════════════════════════════════════════════╗\x1b[0m');
@@ -1,22 +1,44 @@
 import React, { createContext, useContext, useState, useEffect } from 'react';
 import type { ReactNode } from "react";
 import { authAPI } from '../lib/api';
+import { getAssertion } from '../lib/webauthn';
 
 interface User {
   id: number;
   email: string;
   name: string;
-  auth_provider: string;
+  role: 'user' | 'admin';
+  email_verified_at: string | null;
+  disabled_at: string | null;
   created_at: string;
 }
 
+// Returned by login/register when a second factor is needed before a session
+// is issued.
+export interface MFAChallenge {
+  mfa_token: string;
+  mfa_required?: boolean;
+  mfa_enrollment_required?: boolean;
+  methods?: string[];
+}
+
+// Returned by register when the new account cannot log in right away.
+export interface RegisterResult {
+  challenge?: MFAChallenge;
+  emailVerificationRequired?: boolean;
+}
+
 interface AuthContextType {
   user: User | null;
   token: string | null;
   isLoading: boolean;
   isAuthenticated: boolean;
-  login: (email: string, password: string) => Promise<void>;
-  register: (email: string, password: string, name: string) => Promise<void>;
+  login: (email: string, password: string) => Promise<MFAChallenge | null>;
+  register: (email: string, password: string, name: string) => Promise<RegisterResult>;
+  verifyMFA: (mfaToken: string, code: string, isRecoveryCode?: boolean) => Promise<void>;
+  verifyMFAWithPasskey: (mfaToken: string) => Promise<void>;
+  loginWithPasskey: () => Promise<void>;
+  confirmMFAEnrollment: (mfaToken: string, code: string) => Promise<{ recoveryCodes: string[]; finish: () => void }>;
   logout: () => Promise<void>;
   setAuthData: (user: User, token: string) => void;
 }
@@ -70,9 +92,8 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
   }, []);
 
 
-  const login = async (email: string, password: string) => {
-    const response = await authAPI.login({ email, password });
-    const { user: userData, token: authToken } = response.data;
+  const applyAuthResponse = (data: any) => {
+    const { user: userData, token: authToken } = data;
 
     setUser(userData ?? null);
     setToken(authToken ?? null);
@@ -81,22 +102,57 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
     else localStorage.removeItem('token');
 
     if (userData) localStorage.setItem('user', JSON.stringify(userData));
-    else localStorage.removeItem('user'); 
+    else localStorage.removeItem('user');
+  };
+
+  const login = async (email: string, password: string) => {
+    const response = await authAPI.login({ email, password });
+    if (response.data.mfa_token) return response.data as MFAChallenge;
+    applyAuthResponse(response.data);
+    return null;
   };
 
   const register = async (email: string, password: string, name: string) => {
     const response = await authAPI.register({ email, password, name });
-    const { user: userData, token: authToken } = response.data;
+    if (response.data.email_verification_required) return { emailVerificationRequired: true };
+    if (response.data.mfa_token) return { challenge: response.data as MFAChallenge };
+    applyAuthResponse(response.data);
+    return {};
+  };
 
-    setUser(userData ?? null);
-    setToken(authToken ?? null);
+  const verifyMFA = async (mfaToken: string, code: string, isRecoveryCode = false) => {
+    const response = await authAPI.verifyMFA(
+      isRecoveryCode ? { mfa_token: mfaToken, recovery_code: code } : { mfa_token: mfaToken, code }
+    );
+    applyAuthResponse(response.data);
+  };
 
-    if (authToken) localStorage.setItem('token', authToken);
-    else localStorage.removeItem('token');
+  const verifyMFAWithPasskey = async (mfaToken: string) => {
+    const begin = await authAPI.beginWebAuthnMFA(mfaToken);
+    const credential = await getAssertion(begin.data.options);
+    const response = await authAPI.finishWebAuthnMFA({
+      mfa_token: mfaToken,
+      ceremony_id: begin.data.ceremony_id,
+      credential,
+    });
+    applyAuthResponse(response.data);
+  };
 
-    if (userData) localStorage.setItem('user', JSON.stringify(userData));
-    else localStorage.removeItem('user');
+  const loginWithPasskey = async () => {
+    const begin = await authAPI.beginPasskeyLogin();
+    const credential = await getAssertion(begin.data.options);
+    const response = await authAPI.finishPasskeyLogin({ ceremony_id: begin.data.ceremony_id, credential });
+    applyAuthResponse(response.data);
+  };
 
+  // The session is only applied by finish(), so the caller can show the
+  // recovery codes before the app navigates away from the login page.
+  const confirmMFAEnrollment = async (mfaToken: string, code: string) => {
+    const response = await authAPI.confirmMFAEnrollment({ mfa_token: mfaToken, code });
+    return {
+      recoveryCodes: (response.data.recovery_codes ?? []) as string[],
+      finish: () => applyAuthResponse(response.data),
+    };
   };
 
   const logout = async () => {
@@ -133,6 +189,10 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
         isAuthenticated: !!user && !!token,
         login,
         register,
+        verifyMFA,
+        verifyMFAWithPasskey,
+        loginWithPasskey,
+        confirmMFAEnrollment,
         logout,
         setAuthData,
       }}
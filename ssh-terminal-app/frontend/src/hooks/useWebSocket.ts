@@ -1,18 +1,39 @@
 import { useState, useRef, useCallback, useEffect } from 'react';
-import { getWebSocketURL } from '../lib/api';
+import { getFreshToken, getWebSocketURL, type TerminalSize } from '../lib/api';
 import { useAuth } from '../context/AuthContext';
 
 interface WebSocketMessage {
-  type: 'output' | 'status' | 'error';
+  type: 'output' | 'status' | 'error' | 'pong';
   message?: string;
   data?: string;
 }
 
+// Binary terminal protocol: every frame starts with a one byte type.
+const BINARY_PROTOCOL = 'ssh-terminal.binary.v1';
+const FRAME_DATA = 0;
+const FRAME_RESIZE = 1;
+const FRAME_STATUS = 2;
+const FRAME_ERROR = 3;
+const FRAME_ACK = 6;
+const FRAME_FLOW = 7;
+
+const textEncoder = new TextEncoder();
+const textDecoder = new TextDecoder();
+
+const binaryFrame = (type: number, payload: Uint8Array) => {
+  const frame = new Uint8Array(1 + payload.length);
+  frame[0] = type;
+  frame.set(payload, 1);
+  return frame;
+};
+
 interface UseWebSocketTerminalOptions {
   connectionId: number;
-  onOutput?: (data: string) => void;
+  // ack must be called once the output has been rendered.
+  onOutput?: (data: string | Uint8Array, ack?: () => void) => void;
   onStatus?: (message: string) => void;
   onError?: (message: string) => void;
+  onFlow?: (paused: boolean, dropped: number) => void;
   onConnect?: () => void;
   onDisconnect?: () => void;
 }
@@ -22,6 +43,7 @@ export const useWebSocketTerminal = ({
   onOutput,
   onStatus,
   onError,
+  onFlow,
   onConnect,
   onDisconnect,
 }: UseWebSocketTerminalOptions) => {
@@ -30,14 +52,26 @@ export const useWebSocketTerminal = ({
   const [isConnecting, setIsConnecting] = useState(false);
   const wsRef = useRef<WebSocket | null>(null);
   const reconnectTimeoutRef = useRef<ReturnType<typeof setTimeout> | null>(null);
+  const connectAttemptRef = useRef(0);
 
-  const connect = useCallback(() => {
+  const connect = useCallback(async (size?: TerminalSize) => {
     if (!user || wsRef.current?.readyState === WebSocket.OPEN) return;
 
     setIsConnecting(true);
+    const attempt = ++connectAttemptRef.current;
 
-    const wsUrl = getWebSocketURL(connectionId, user.id);
-    const ws = new WebSocket(wsUrl);
+    // Access tokens are short-lived, so make sure the handshake carries a valid one.
+    const token = await getFreshToken();
+    if (attempt !== connectAttemptRef.current) return;
+    if (!token) {
+      setIsConnecting(false);
+      onError?.('Session expired, please log in again');
+      return;
+    }
+
+    const wsUrl = getWebSocketURL(connectionId, token, size);
+    const ws = new WebSocket(wsUrl, [BINARY_PROTOCOL]);
+    ws.binaryType = 'arraybuffer';
 
     ws.onopen = () => {
       setIsConnected(true);
@@ -46,6 +80,37 @@ export const useWebSocketTerminal = ({
     };
 
     ws.onmessage = (event) => {
+      if (event.data instanceof ArrayBuffer) {
+        const frame = new Uint8Array(event.data);
+        if (frame.length === 0) return;
+        const payload = frame.subarray(1);
+
+        switch (frame[0]) {
+          case FRAME_DATA: {
+            const ack = new Uint8Array(4);
+            new DataView(ack.buffer).setUint32(0, payload.length);
+            onOutput?.(payload, () => {
+              if (ws.readyState === WebSocket.OPEN) {
+                ws.send(binaryFrame(FRAME_ACK, ack));
+              }
+            });
+            break;
+          }
+          case FRAME_STATUS:
+            onStatus?.(textDecoder.decode(payload));
+            break;
+          case FRAME_ERROR:
+            onError?.(textDecoder.decode(payload));
+            break;
+          case FRAME_FLOW: {
+            const view = new DataView(payload.buffer, payload.byteOffset, payload.byteLength);
+            onFlow?.(view.getUint8(0) === 1, Number(view.getBigUint64(1)));
+            break;
+          }
+        }
+        return;
+      }
+
       try {
         const message: WebSocketMessage = JSON.parse(event.data);
 
@@ -85,9 +150,10 @@ export const useWebSocketTerminal = ({
     };
 
     wsRef.current = ws;
-  }, [connectionId, user, onOutput, onStatus, onError, onConnect, onDisconnect]);
+  }, [connectionId, user, onOutput, onStatus, onError, onFlow, onConnect, onDisconnect]);
 
   const disconnect = useCallback(() => {
+    connectAttemptRef.current++;
     if (reconnectTimeoutRef.current) {
       clearTimeout(reconnectTimeoutRef.current);
       reconnectTimeoutRef.current = null;
@@ -103,14 +169,28 @@ export const useWebSocketTerminal = ({
   }, []);
 
   const sendInput = useCallback((data: string) => {
-    if (wsRef.current?.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify({ type: 'input', data }));
+    const ws = wsRef.current;
+    if (ws?.readyState !== WebSocket.OPEN) return;
+
+    if (ws.protocol === BINARY_PROTOCOL) {
+      ws.send(binaryFrame(FRAME_DATA, textEncoder.encode(data)));
+    } else {
+      ws.send(JSON.stringify({ type: 'input', data }));
     }
   }, []);
 
   const sendResize = useCallback((cols: number, rows: number) => {
-    if (wsRef.current?.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify({ type: 'resize', cols, rows }));
+    const ws = wsRef.current;
+    if (ws?.readyState !== WebSocket.OPEN) return;
+
+    if (ws.protocol === BINARY_PROTOCOL) {
+      const size = new Uint8Array(4);
+      const view = new DataView(size.buffer);
+      view.setUint16(0, cols);
+      view.setUint16(2, rows);
+      ws.send(binaryFrame(FRAME_RESIZE, size));
+    } else {
+      ws.send(JSON.stringify({ type: 'resize', cols, rows }));
     }
   }, []);
 
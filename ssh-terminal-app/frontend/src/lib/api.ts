@@ -18,11 +18,82 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
+// Refresh the access token using the refresh token cookie. Concurrent
+// callers share one in-flight request, since each refresh token is single-use.
+let refreshPromise: Promise<string> | null = null;
+
+export const refreshAccessToken = (): Promise<string> => {
+  if (!refreshPromise) {
+    refreshPromise = axios
+      .post('/api/auth/refresh', null, { withCredentials: true })
+      .then((response) => {
+        const token: string = response.data.token;
+        localStorage.setItem('token', token);
+        return token;
+      })
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+};
+
+const tokenExpiresSoon = (token: string) => {
+  try {
+    const payload = JSON.parse(atob(token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')));
+    return typeof payload.exp !== 'number' || payload.exp * 1000 - Date.now() < 30_000;
+  } catch {
+    return true;
+  }
+};
+
+// Returns a valid access token, refreshing it first if it is about to expire.
+export const getFreshToken = async (): Promise<string | null> => {
+  const token = localStorage.getItem('token');
+  if (token && !tokenExpiresSoon(token)) {
+    return token;
+  }
+  try {
+    return await refreshAccessToken();
+  } catch {
+    return null;
+  }
+};
+
+const skipRefreshURLs = [
+  '/api/auth/login',
+  '/api/auth/register',
+  '/api/auth/refresh',
+  '/api/auth/logout',
+  '/api/auth/exchange',
+  '/api/auth/verify-email',
+  '/api/auth/forgot-password',
+  '/api/auth/reset-password',
+  '/api/auth/mfa/verify',
+  '/api/auth/mfa/enroll',
+  '/api/auth/mfa/enroll/confirm',
+  '/api/auth/webauthn/login/begin',
+  '/api/auth/webauthn/login/finish',
+  '/api/auth/webauthn/mfa/begin',
+  '/api/auth/webauthn/mfa/finish',
+];
+
 // Handle auth errors
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const config = error.config;
     if (error.response?.status === 401) {
+      if (config && !config._retried && !skipRefreshURLs.includes(config.url)) {
+        config._retried = true;
+        try {
+          const token = await refreshAccessToken();
+          config.headers.Authorization = `Bearer ${token}`;
+          return api(config);
+        } catch {
+          // fall through to logout
+        }
+      }
       localStorage.removeItem('token');
       localStorage.removeItem('user');
       window.location.href = '/login';
@@ -41,11 +112,106 @@ export const authAPI = {
 
   logout: () => api.post('/api/auth/logout'),
 
+  exchangeCode: (code: string) => api.post('/api/auth/exchange', { code }),
+
+  verifyEmail: (token: string) => api.post('/api/auth/verify-email', { token }),
+
+  resendVerificationEmail: (email: string) => api.post('/api/auth/verify-email/resend', { email }),
+
+  forgotPassword: (email: string) => api.post('/api/auth/forgot-password', { email }),
+
+  resetPassword: (data: { token: string; password: string }) => api.post('/api/auth/reset-password', data),
+
+  changePassword: (data: { current_password: string; new_password: string }) =>
+    api.post('/api/auth/change-password', data),
+
+  refresh: () => refreshAccessToken(),
+
+  getSessions: () => api.get('/api/auth/sessions'),
+
+  revokeSession: (id: number) => api.delete(`/api/auth/sessions/${id}`),
+
+  revokeOtherSessions: () => api.post('/api/auth/sessions/revoke-others'),
+
+  verifyMFA: (data: { mfa_token: string; code?: string; recovery_code?: string }) =>
+    api.post('/api/auth/mfa/verify', data),
+
+  beginMFAEnrollment: (mfaToken: string) =>
+    api.post('/api/auth/mfa/enroll', { mfa_token: mfaToken }),
+
+  confirmMFAEnrollment: (data: { mfa_token: string; code: string }) =>
+    api.post('/api/auth/mfa/enroll/confirm', data),
+
+  getMFAStatus: () => api.get('/api/auth/mfa'),
+
+  setupTOTP: () => api.post('/api/auth/mfa/totp/setup'),
+
+  confirmTOTP: (code: string) => api.post('/api/auth/mfa/totp/confirm', { code }),
+
+  disableTOTP: (data: { password?: string; code?: string; recovery_code?: string }) =>
+    api.post('/api/auth/mfa/totp/disable', data),
+
+  regenerateRecoveryCodes: (data: { password?: string; code?: string; recovery_code?: string }) =>
+    api.post('/api/auth/mfa/recovery-codes', data),
+
+  beginPasskeyLogin: () => api.post('/api/auth/webauthn/login/begin'),
+
+  finishPasskeyLogin: (data: { ceremony_id: string; credential: unknown }) =>
+    api.post('/api/auth/webauthn/login/finish', data),
+
+  beginWebAuthnMFA: (mfaToken: string) => api.post('/api/auth/webauthn/mfa/begin', { mfa_token: mfaToken }),
+
+  finishWebAuthnMFA: (data: { mfa_token: string; ceremony_id: string; credential: unknown }) =>
+    api.post('/api/auth/webauthn/mfa/finish', data),
+
+  beginWebAuthnRegistration: () => api.post('/api/auth/webauthn/register/begin'),
+
+  finishWebAuthnRegistration: (data: { ceremony_id: string; name: string; credential: unknown }) =>
+    api.post('/api/auth/webauthn/register/finish', data),
+
+  getWebAuthnCredentials: () => api.get('/api/auth/webauthn/credentials'),
+
+  renameWebAuthnCredential: (id: number, name: string) =>
+    api.put(`/api/auth/webauthn/credentials/${id}`, { name }),
+
+  deleteWebAuthnCredential: (id: number) => api.delete(`/api/auth/webauthn/credentials/${id}`),
+
   getMe: () => api.get('/api/auth/me'),
 
-  googleLogin: () => {
-  window.location.href = '/api/auth/google';
-},
+  getOIDCProviders: () => api.get('/api/auth/oidc/providers'),
+
+  getIdentities: () => api.get('/api/auth/identities'),
+
+  getAPITokens: () => api.get('/api/tokens'),
+
+  createAPIToken: (data: { name: string; scopes: string[]; expires_at?: string }) =>
+    api.post('/api/tokens', data),
+
+  deleteAPIToken: (id: number) => api.delete(`/api/tokens/${id}`),
+
+  oidcLogin: (loginURL: string) => {
+    window.location.href = loginURL;
+  },
+};
+
+// Admin API
+export const adminAPI = {
+  getUsers: (params?: { q?: string; role?: string; status?: string; cursor?: string; limit?: number }) =>
+    api.get('/api/admin/users', { params }),
+
+  getUser: (id: number) => api.get(`/api/admin/users/${id}`),
+
+  disableUser: (id: number) => api.post(`/api/admin/users/${id}/disable`),
+
+  enableUser: (id: number) => api.post(`/api/admin/users/${id}/enable`),
+
+  logoutUser: (id: number) => api.post(`/api/admin/users/${id}/logout`),
+
+  resetUserMFA: (id: number) => api.post(`/api/admin/users/${id}/reset-mfa`),
+
+  setUserRole: (id: number, role: 'user' | 'admin') => api.put(`/api/admin/users/${id}/role`, { role }),
+
+  deleteUser: (id: number) => api.delete(`/api/admin/users/${id}`),
 };
 
 // SSH Connections API
@@ -77,12 +243,25 @@ export const sshAPI = {
   deleteConnection: (id: number) => api.delete(`/api/ssh/connections/${id}`),
 
   testConnection: (id: number) => api.post(`/api/ssh/connections/${id}/test`),
+
+  execCommand: (id: number, data: { command: string; timeout?: number }) =>
+    api.post(`/api/ssh/connections/${id}/exec`, data),
 };
 
-export const getWebSocketURL = (connectionId: number, userId: number) => {
+export interface TerminalSize {
+  cols: number;
+  rows: number;
+}
+
+// size, when known, is the initial size of the remote PTY.
+export const getWebSocketURL = (connectionId: number, token: string, size?: TerminalSize) => {
   const wsProtocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-  const token = localStorage.getItem('token');
-  return `${wsProtocol}//${window.location.host}/ws/ssh/${connectionId}?user_id=${userId}&token=${token}`;
+  const params = new URLSearchParams({ token });
+  if (size && size.cols > 0 && size.rows > 0) {
+    params.set('cols', String(size.cols));
+    params.set('rows', String(size.rows));
+  }
+  return `${wsProtocol}//${window.location.host}/ws/ssh/${connectionId}?${params}`;
 };
 
 export default api;
@@ -0,0 +1,78 @@
+// Helpers for running WebAuthn ceremonies with the options sent by the
+// backend, which encodes all binary fields as base64url.
+
+const fromBase64URL = (value: string): ArrayBuffer => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4);
+  const binary = atob(padded);
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) bytes[i] = binary.charCodeAt(i);
+  return bytes.buffer;
+};
+
+const toBase64URL = (buffer: ArrayBuffer | null): string | undefined => {
+  if (!buffer) return undefined;
+  const bytes = new Uint8Array(buffer);
+  let binary = '';
+  for (let i = 0; i < bytes.length; i++) binary += String.fromCharCode(bytes[i]);
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+};
+
+export const isWebAuthnSupported = () =>
+  typeof window !== 'undefined' && !!window.PublicKeyCredential && !!navigator.credentials;
+
+export const createCredential = async (options: any) => {
+  const publicKey = options.publicKey;
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...publicKey,
+      challenge: fromBase64URL(publicKey.challenge),
+      user: { ...publicKey.user, id: fromBase64URL(publicKey.user.id) },
+      excludeCredentials: (publicKey.excludeCredentials ?? []).map((c: any) => ({
+        ...c,
+        id: fromBase64URL(c.id),
+      })),
+    },
+  })) as PublicKeyCredential | null;
+  if (!credential) throw new Error('Registration was cancelled');
+
+  const response = credential.response as AuthenticatorAttestationResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64URL(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64URL(response.clientDataJSON),
+      attestationObject: toBase64URL(response.attestationObject),
+      transports: response.getTransports?.() ?? [],
+    },
+  };
+};
+
+export const getAssertion = async (options: any) => {
+  const publicKey = options.publicKey;
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...publicKey,
+      challenge: fromBase64URL(publicKey.challenge),
+      allowCredentials: (publicKey.allowCredentials ?? []).map((c: any) => ({
+        ...c,
+        id: fromBase64URL(c.id),
+      })),
+    },
+  })) as PublicKeyCredential | null;
+  if (!credential) throw new Error('Login was cancelled');
+
+  const response = credential.response as AuthenticatorAssertionResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64URL(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64URL(response.clientDataJSON),
+      authenticatorData: toBase64URL(response.authenticatorData),
+      signature: toBase64URL(response.signature),
+      userHandle: toBase64URL(response.userHandle),
+    },
+  };
+};
@@ -1,6 +1,7 @@
-import React, { useEffect } from 'react';
+import React, { useEffect, useRef } from 'react';
 import { useNavigate, useSearchParams } from 'react-router-dom';
 import { useAuth } from '../context/AuthContext';
+import type { MFAChallenge } from '../context/AuthContext';
 import { authAPI } from '../lib/api';
 import { Terminal } from 'lucide-react';
 
@@ -9,8 +10,12 @@ const AuthCallback: React.FC = () => {
   const navigate = useNavigate();
   const { setAuthData } = useAuth();
 
+  // Exchange codes are single use, so make sure the effect only redeems it
+  // once even when it runs twice in development.
+  const exchangedRef = useRef(false);
+
   useEffect(() => {
-    const token = searchParams.get('token');
+    const code = searchParams.get('code');
     const error = searchParams.get('error');
 
     if (error) {
@@ -18,21 +23,26 @@ const AuthCallback: React.FC = () => {
       return;
     }
 
-    if (token) {
-      localStorage.setItem('token', token);
-      
-      authAPI.getMe()
-        .then(response => {
-          setAuthData(response.data.user, token);
-          navigate('/');
-        })
-        .catch(() => {
-          localStorage.removeItem('token');
-          navigate('/login?error=auth_failed');
-        });
-    } else {
+    if (!code) {
       navigate('/login');
+      return;
     }
+    if (exchangedRef.current) return;
+    exchangedRef.current = true;
+
+    authAPI.exchangeCode(code)
+      .then(response => {
+        // The identity provider login succeeded but a second factor is needed.
+        if (response.data.mfa_token) {
+          navigate('/login', { replace: true, state: { challenge: response.data as MFAChallenge } });
+          return;
+        }
+        setAuthData(response.data.user, response.data.token);
+        navigate('/', { replace: true });
+      })
+      .catch(() => {
+        navigate('/login?error=auth_failed', { replace: true });
+      });
   }, [searchParams, navigate, setAuthData]);
 
   return (
@@ -0,0 +1,90 @@
+import React, { useState } from 'react';
+import { Link } from 'react-router-dom';
+import { authAPI } from '../lib/api';
+import { Terminal, Mail } from 'lucide-react';
+
+const ForgotPassword: React.FC = () => {
+  const [email, setEmail] = useState('');
+  const [error, setError] = useState<string | null>(null);
+  const [isSent, setIsSent] = useState(false);
+  const [isLoading, setIsLoading] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+    setIsLoading(true);
+
+    try {
+      await authAPI.forgotPassword(email);
+      setIsSent(true);
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'İstek gönderilemedi');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center px-4 grid-bg">
+      <div className="w-full max-w-md">
+        <div className="text-center mb-8">
+          <div className="inline-flex items-center justify-center w-16 h-16 bg-accent-cyan/10 rounded-2xl mb-4">
+            <Terminal className="w-8 h-8 text-accent-cyan" />
+          </div>
+          <h1 className="text-3xl font-bold gradient-text">Şifremi Unuttum</h1>
+          <p className="text-gray-500 mt-2">Şifre sıfırlama bağlantısı alın</p>
+        </div>
+
+        <div className="bg-dark-800 border border-dark-600 rounded-2xl p-8">
+          {error && (
+            <div className="mb-6 p-4 bg-red-500/10 border border-red-500/30 rounded-lg text-red-400 text-sm">
+              {error}
+            </div>
+          )}
+
+          {isSent ? (
+            <p className="text-gray-400 text-sm">
+              Bu e-posta adresiyle kayıtlı bir hesap varsa, şifre sıfırlama bağlantısı gönderildi. Gelen
+              kutunuzu kontrol edin.
+            </p>
+          ) : (
+            <form onSubmit={handleSubmit} className="space-y-5">
+              <div>
+                <label className="block text-sm font-medium text-gray-400 mb-2">
+                  Email
+                </label>
+                <div className="relative">
+                  <Mail className="absolute left-4 top-1/2 -translate-y-1/2 w-5 h-5 text-gray-500" />
+                  <input
+                    type="email"
+                    value={email}
+                    onChange={(e) => setEmail(e.target.value)}
+                    placeholder="ornek@email.com"
+                    className="w-full pl-12 pr-4 py-3 bg-dark-900 border border-dark-600 rounded-lg focus:border-accent-cyan focus:ring-1 focus:ring-accent-cyan transition-colors"
+                    required
+                  />
+                </div>
+              </div>
+
+              <button
+                type="submit"
+                disabled={isLoading}
+                className="w-full py-3 bg-accent-cyan text-dark-900 font-semibold rounded-lg hover:bg-opacity-90 transition-colors disabled:opacity-50 disabled:cursor-not-allowed"
+              >
+                {isLoading ? 'Gönderiliyor...' : 'Bağlantı Gönder'}
+              </button>
+            </form>
+          )}
+
+          <p className="mt-6 text-center text-gray-500">
+            <Link to="/login" className="text-accent-cyan hover:underline">
+              Girişe dön
+            </Link>
+          </p>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default ForgotPassword;
@@ -1,8 +1,12 @@
 import React, { useState } from 'react';
-import { Link, useNavigate } from 'react-router-dom';
+import { Link, useLocation, useNavigate } from 'react-router-dom';
 import { useAuth } from '../context/AuthContext';
+import type { MFAChallenge } from '../context/AuthContext';
+import OIDCButtons from '../components/OIDCButtons';
+import MFAStep from '../components/MFAStep';
+import { Terminal, Mail, Lock, Eye, EyeOff, Fingerprint } from 'lucide-react';
+import { isWebAuthnSupported } from '../lib/webauthn';
 import { authAPI } from '../lib/api';
-import { Terminal, Mail, Lock, Chrome, Eye, EyeOff } from 'lucide-react';
 
 const Login: React.FC = () => {
   const [email, setEmail] = useState('');
@@ -10,26 +14,62 @@ const Login: React.FC = () => {
   const [error, setError] = useState<string | null>(null);
   const [isLoading, setIsLoading] = useState(false);
   const [showPassword, setShowPassword] = useState(false);
-  const { login } = useAuth();
+  const { login, loginWithPasskey } = useAuth();
   const navigate = useNavigate();
+  const location = useLocation();
+  const locationState = location.state as { challenge?: MFAChallenge; notice?: string } | null;
+  const [challenge, setChallenge] = useState<MFAChallenge | null>(locationState?.challenge ?? null);
+  const [notice, setNotice] = useState<string | undefined>(locationState?.notice);
+  const [verificationRequired, setVerificationRequired] = useState(false);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setError(null);
+    setVerificationRequired(false);
     setIsLoading(true);
 
     try {
-      await login(email, password);
+      const mfaChallenge = await login(email, password);
+      if (mfaChallenge) {
+        setChallenge(mfaChallenge);
+        return;
+      }
       navigate('/');
     } catch (err: any) {
       setError(err.response?.data?.error || 'Giriş başarısız');
+      setVerificationRequired(!!err.response?.data?.email_verification_required);
     } finally {
       setIsLoading(false);
     }
   };
 
-  const handleGoogleLogin = () => {
-    authAPI.googleLogin();
+  const handleResendVerification = async () => {
+    setIsLoading(true);
+
+    try {
+      await authAPI.resendVerificationEmail(email);
+      setError(null);
+      setVerificationRequired(false);
+      setNotice('Doğrulama bağlantısı e-posta adresinize tekrar gönderildi.');
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Doğrulama e-postası gönderilemedi');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handlePasskeyLogin = async () => {
+    setError(null);
+    setIsLoading(true);
+
+    try {
+      await loginWithPasskey();
+      navigate('/');
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Passkey ile giriş başarısız');
+    } finally {
+      setIsLoading(false);
+    }
   };
 
   return (
@@ -44,23 +84,47 @@ const Login: React.FC = () => {
           <p className="text-gray-500 mt-2">Hesabınıza giriş yapın</p>
         </div>
 
+        {/* Second factor */}
+        {challenge && (
+          <div className="bg-dark-800 border border-dark-600 rounded-2xl p-8">
+            <MFAStep challenge={challenge} onCancel={() => setChallenge(null)} />
+          </div>
+        )}
+
         {/* Login Form */}
-        <div className="bg-dark-800 border border-dark-600 rounded-2xl p-8">
+        <div className={`bg-dark-800 border border-dark-600 rounded-2xl p-8 ${challenge ? 'hidden' : ''}`}>
+          {notice && !error && (
+            <div className="mb-6 p-4 bg-accent-cyan/10 border border-accent-cyan/30 rounded-lg text-accent-cyan text-sm">
+              {notice}
+            </div>
+          )}
+
           {error && (
             <div className="mb-6 p-4 bg-red-500/10 border border-red-500/30 rounded-lg text-red-400 text-sm">
               {error}
+              {verificationRequired && (
+                <button
+                  type="button"
+                  onClick={handleResendVerification}
+                  disabled={isLoading}
+                  className="block mt-2 text-accent-cyan hover:underline disabled:opacity-50"
+                >
+                  Doğrulama e-postasını tekrar gönder
+                </button>
+              )}
             </div>
           )}
 
           <form onSubmit={handleSubmit} className="space-y-5">
             <div>
               <label className="block text-sm font-medium text-gray-400 mb-2">
-                Email
+                Email veya kullanıcı adı
               </label>
               <div className="relative">
                 <Mail className="absolute left-4 top-1/2 -translate-y-1/2 w-5 h-5 text-gray-500" />
                 <input
-                  type="email"
+                  type="text"
+                  autoComplete="username"
                   value={email}
                   onChange={(e) => setEmail(e.target.value)}
                   placeholder="ornek@email.com"
@@ -94,6 +158,12 @@ const Login: React.FC = () => {
               </div>
             </div>
 
+            <div className="text-right -mt-2">
+              <Link to="/forgot-password" className="text-sm text-accent-cyan hover:underline">
+                Şifremi unuttum
+              </Link>
+            </div>
+
             <button
               type="submit"
               disabled={isLoading}
@@ -112,13 +182,18 @@ const Login: React.FC = () => {
             </div>
           </div>
 
-          <button
-            onClick={handleGoogleLogin}
-            className="w-full flex items-center justify-center gap-3 py-3 border border-dark-600 rounded-lg hover:bg-dark-700 transition-colors"
-          >
-            <Chrome className="w-5 h-5 text-gray-400" />
-            <span>Google ile Giriş Yap</span>
-          </button>
+          {isWebAuthnSupported() && (
+            <button
+              onClick={handlePasskeyLogin}
+              disabled={isLoading}
+              className="w-full mb-3 flex items-center justify-center gap-3 py-3 border border-dark-600 rounded-lg hover:bg-dark-700 transition-colors disabled:opacity-50"
+            >
+              <Fingerprint className="w-5 h-5 text-gray-400" />
+              <span>Passkey ile Giriş Yap</span>
+            </button>
+          )}
+
+          <OIDCButtons actionLabel="ile Giriş Yap" />
 
           <p className="mt-6 text-center text-gray-500">
             Hesabınız yok mu?{' '}
@@ -1,8 +1,8 @@
 import React, { useState } from 'react';
 import { Link, useNavigate } from 'react-router-dom';
 import { useAuth } from '../context/AuthContext';
-import { authAPI } from '../lib/api';
-import { Terminal, Mail, Lock, User, Chrome, Eye, EyeOff } from 'lucide-react';
+import OIDCButtons from '../components/OIDCButtons';
+import { Terminal, Mail, Lock, User, Eye, EyeOff } from 'lucide-react';
 
 
 const Register: React.FC = () => {
@@ -36,7 +36,17 @@ const Register: React.FC = () => {
     setIsLoading(true);
 
     try {
-      await register(email, password, name);
+      const result = await register(email, password, name);
+      if (result.emailVerificationRequired) {
+        navigate('/login', {
+          state: { notice: 'Kaydınız oluşturuldu. Giriş yapmadan önce e-postanıza gönderilen bağlantı ile adresinizi doğrulayın.' },
+        });
+        return;
+      }
+      if (result.challenge) {
+        navigate('/login', { state: { challenge: result.challenge } });
+        return;
+      }
       navigate('/');
     } catch (err: any) {
       setError(err.response?.data?.error || 'Kayıt başarısız');
@@ -45,10 +55,6 @@ const Register: React.FC = () => {
     }
   };
 
-  const handleGoogleLogin = () => {
-    authAPI.googleLogin();
-  };
-
   return (
     <div className="min-h-screen flex items-center justify-center px-4 grid-bg py-12">
       <div className="w-full max-w-md">
@@ -179,13 +185,7 @@ const Register: React.FC = () => {
             </div>
           </div>
 
-          <button
-            onClick={handleGoogleLogin}
-            className="w-full flex items-center justify-center gap-3 py-3 border border-dark-600 rounded-lg hover:bg-dark-700 transition-colors"
-          >
-            <Chrome className="w-5 h-5 text-gray-400" />
-            <span>Google ile Kayıt Ol</span>
-          </button>
+          <OIDCButtons actionLabel="ile Kayıt Ol" />
 
           <p className="mt-6 text-center text-gray-500">
             Zaten hesabınız var mı?{' '}
@@ -0,0 +1,61 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { authAPI } from '../lib/api';
+import { Terminal } from 'lucide-react';
+
+const VerifyEmail: React.FC = () => {
+  const [searchParams] = useSearchParams();
+  const [status, setStatus] = useState<'pending' | 'verified' | 'failed'>('pending');
+  const [error, setError] = useState<string | null>(null);
+  // Verification tokens are single use; avoid a second request when the
+  // effect runs twice in development.
+  const sentRef = useRef(false);
+
+  useEffect(() => {
+    const token = searchParams.get('token');
+    if (!token) {
+      setStatus('failed');
+      return;
+    }
+    if (sentRef.current) return;
+    sentRef.current = true;
+
+    authAPI
+      .verifyEmail(token)
+      .then(() => setStatus('verified'))
+      .catch((err) => {
+        setError(err.response?.data?.error || null);
+        setStatus('failed');
+      });
+  }, [searchParams]);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center px-4 grid-bg">
+      <div className="text-center max-w-md">
+        <div className="inline-flex items-center justify-center w-16 h-16 bg-accent-cyan/10 rounded-2xl mb-4">
+          <Terminal className={`w-8 h-8 text-accent-cyan ${status === 'pending' ? 'animate-pulse' : ''}`} />
+        </div>
+        {status === 'pending' && <h2 className="text-xl font-semibold mb-2">E-posta doğrulanıyor...</h2>}
+        {status === 'verified' && (
+          <>
+            <h2 className="text-xl font-semibold mb-2">E-posta adresiniz doğrulandı</h2>
+            <p className="text-gray-500">Artık hesabınızı kullanabilirsiniz.</p>
+          </>
+        )}
+        {status === 'failed' && (
+          <>
+            <h2 className="text-xl font-semibold mb-2">Doğrulama başarısız</h2>
+            <p className="text-gray-500">{error || 'Doğrulama bağlantısı geçersiz veya süresi dolmuş.'}</p>
+          </>
+        )}
+        {status !== 'pending' && (
+          <Link to="/" className="inline-block mt-6 text-accent-cyan hover:underline">
+            Devam et
+          </Link>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default VerifyEmail;